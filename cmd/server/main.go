@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"regexp"
 	"time"
 
 	dbx "github.com/go-ozzo/ozzo-dbx"
@@ -14,14 +15,22 @@ import (
 	"github.com/go-ozzo/ozzo-routing/v2/content"
 	"github.com/go-ozzo/ozzo-routing/v2/cors"
 	_ "github.com/lib/pq"
+	"github.com/nvnoskov/dynamo-backend/internal/aircraft"
+	"github.com/nvnoskov/dynamo-backend/internal/airport"
 	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/booking"
+	"github.com/nvnoskov/dynamo-backend/internal/claim"
 	"github.com/nvnoskov/dynamo-backend/internal/config"
 	"github.com/nvnoskov/dynamo-backend/internal/errors"
 	"github.com/nvnoskov/dynamo-backend/internal/flight"
 	"github.com/nvnoskov/dynamo-backend/internal/healthcheck"
+	"github.com/nvnoskov/dynamo-backend/internal/itinerary"
+	"github.com/nvnoskov/dynamo-backend/internal/passenger"
+	"github.com/nvnoskov/dynamo-backend/internal/schedule"
 	"github.com/nvnoskov/dynamo-backend/pkg/accesslog"
 	"github.com/nvnoskov/dynamo-backend/pkg/dbcontext"
 	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/nvnoskov/dynamo-backend/pkg/mail"
 )
 
 // Version indicates the current version of the application.
@@ -55,11 +64,48 @@ func main() {
 		}
 	}()
 
+	dbc := dbcontext.New(db)
+
+	// load the airport reference data
+	if cfg.AirportsFile != "" {
+		if err := importAirports(cfg.AirportsFile, dbc, logger); err != nil {
+			logger.Errorf("failed to import airports: %s", err)
+			os.Exit(-1)
+		}
+	}
+
+	// keep the flights of the recurring schedules generated
+	aircraftRepo := aircraft.NewRepository(dbc, logger)
+	go generateFlights(schedule.NewService(
+		schedule.NewRepository(dbc, aircraftRepo, logger),
+		dbc.Transactional,
+		airport.NewService(airport.NewRepository(dbc, logger), logger),
+		aircraft.NewService(aircraftRepo, logger),
+		cfg.ScheduleHorizon,
+		logger,
+	), logger)
+
+	// release the seats of the bookings whose hold has ended
+	go expireHolds(booking.NewService(
+		booking.NewRepository(dbc, logger),
+		dbc.Transactional,
+		claim.NewService(claim.NewRepository(dbc, logger), dbc.Transactional, logger),
+		time.Duration(cfg.HoldTTL)*time.Minute,
+		logger,
+	), logger)
+
+	// load the JWT signing keys
+	keys, err := loadKeys(cfg)
+	if err != nil {
+		logger.Errorf("failed to load JWT signing keys: %s", err)
+		os.Exit(-1)
+	}
+
 	// build HTTP server
 	address := fmt.Sprintf(":%v", cfg.ServerPort)
 	hs := &http.Server{
 		Addr:    address,
-		Handler: buildHandler(logger, dbcontext.New(db), cfg),
+		Handler: buildHandler(logger, dbc, cfg, keys),
 	}
 
 	// start the HTTP server with graceful shutdown
@@ -72,7 +118,7 @@ func main() {
 }
 
 // buildHandler sets up the HTTP routing and builds an HTTP handler.
-func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config) http.Handler {
+func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config, keys *auth.KeySet) http.Handler {
 	router := routing.New()
 
 	router.Use(
@@ -83,33 +129,159 @@ func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config) http.
 	)
 
 	healthcheck.RegisterHandlers(router, Version)
+	auth.RegisterKeyHandlers(router, keys)
 
 	rg := router.Group("/v1")
 
-	authHandler := auth.Handler(cfg.JWTSigningKey)
+	authService := auth.NewService(
+		auth.NewRepository(db, logger),
+		db.Transactional,
+		keys,
+		mail.NewLocalMailer(cfg.MailDir, cfg.MailLogBodies, logger),
+		time.Duration(cfg.JWTExpirationMinutes)*time.Minute,
+		time.Duration(cfg.RefreshExpiration)*time.Hour,
+		time.Duration(cfg.PasswordResetExpiration)*time.Minute,
+		time.Duration(cfg.EmailVerificationExpiration)*time.Hour,
+		cfg.RequireEmailVerification,
+		cfg.AdminEmail,
+		logger,
+	)
+	authHandler := auth.Handler(keys, authService)
+
+	airportService := airport.NewService(airport.NewRepository(db, logger), logger)
+
+	airport.RegisterHandlers(rg.Group(""),
+		airportService,
+		authHandler,
+		logger,
+	)
+
+	aircraftRepo := aircraft.NewRepository(db, logger)
+	aircraftService := aircraft.NewService(aircraftRepo, logger)
+
+	aircraft.RegisterHandlers(rg.Group(""),
+		aircraftService,
+		authHandler,
+		logger,
+	)
+
+	claimService := claim.NewService(claim.NewRepository(db, logger), db.Transactional, logger)
 
 	flight.RegisterHandlers(rg.Group(""),
-		flight.NewService(flight.NewRepository(db, logger), logger),
+		flight.NewService(flight.NewRepository(db, aircraftRepo, logger), db.Transactional, airportService, aircraftService,
+			claimService, cfg.ExchangeRates, cfg.CursorSigningKey, logger),
+		authHandler,
+		logger,
+	)
+
+	passenger.RegisterHandlers(rg.Group(""),
+		passenger.NewService(passenger.NewRepository(db, logger), logger),
+		authHandler,
+		logger,
+	)
+
+	claim.RegisterHandlers(rg.Group(""),
+		claimService,
+		authHandler,
+		logger,
+	)
+
+	schedule.RegisterHandlers(rg.Group(""),
+		schedule.NewService(schedule.NewRepository(db, aircraftRepo, logger), db.Transactional, airportService, aircraftService, cfg.ScheduleHorizon, logger),
+		authHandler,
+		logger,
+	)
+
+	booking.RegisterHandlers(rg.Group(""),
+		booking.NewService(booking.NewRepository(db, logger), db.Transactional, claimService, time.Duration(cfg.HoldTTL)*time.Minute, logger),
+		authHandler,
+		logger,
+	)
+
+	itinerary.RegisterHandlers(rg.Group(""),
+		itinerary.NewService(itinerary.NewRepository(db, logger), airportService, cfg.ExchangeRates, logger),
 		authHandler,
 		logger,
 	)
 
 	auth.RegisterHandlers(rg.Group(""),
-		auth.NewService(
-			auth.NewRepository(db, logger),
-			cfg.JWTSigningKey,
-			cfg.JWTExpiration,
-			logger,
-		),
+		authService,
+		authHandler,
 		logger,
 	)
 
 	return router
 }
 
-// logDBQuery returns a logging function that can be used to log SQL queries.
+// loadKeys loads the JWT signing keys from their PEM data or files.
+func loadKeys(cfg *config.Config) (*auth.KeySet, error) {
+	var keys []auth.SigningKey
+	for _, k := range cfg.JWTKeys {
+		var key auth.SigningKey
+		var err error
+		if k.PEM != "" {
+			key, err = auth.ParseSigningKey(k.ID, []byte(k.PEM), k.ActiveFrom)
+		} else {
+			key, err = auth.LoadSigningKey(k.ID, k.File, k.ActiveFrom)
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return auth.NewKeySet(keys, time.Duration(cfg.JWTExpirationMinutes)*time.Minute)
+}
+
+// importAirports loads the airport reference data from the given CSV file into the database.
+func importAirports(file string, db *dbcontext.DB, logger log.Logger) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	count, err := airport.NewService(airport.NewRepository(db, logger), logger).Import(context.Background(), f)
+	if err != nil {
+		return err
+	}
+	logger.Infof("imported %v airports from %v", count, file)
+	return nil
+}
+
+// generateFlights generates the flights of the recurring schedules on startup and then every hour,
+// so that the flights keep covering the configured horizon.
+func generateFlights(service schedule.Service, logger log.Logger) {
+	for ; ; time.Sleep(time.Hour) {
+		count, err := service.Generate(context.Background())
+		if err != nil {
+			logger.Errorf("failed to generate scheduled flights: %s", err)
+			continue
+		}
+		logger.Infof("generated %v scheduled flights", count)
+	}
+}
+
+// expireHolds releases the seats of the expired holds every minute.
+func expireHolds(service booking.Service, logger log.Logger) {
+	for ; ; time.Sleep(time.Minute) {
+		if _, err := service.Expire(context.Background()); err != nil {
+			logger.Errorf("failed to expire seat holds: %s", err)
+		}
+	}
+}
+
+// stringLiteralRegex matches the string literals of an SQL statement.
+var stringLiteralRegex = regexp.MustCompile(`'(?:[^']|'')*'`)
+
+// redactSQL replaces the string literals of an SQL statement with '?'. The statements are logged with
+// their parameters interpolated, which would otherwise put personal data like document numbers in the logs.
+func redactSQL(sql string) string {
+	return stringLiteralRegex.ReplaceAllString(sql, "'?'")
+}
+
+// logDBQuery returns a logging function that can be used to log SQL queries without their string parameters.
 func logDBQuery(logger log.Logger) dbx.QueryLogFunc {
 	return func(ctx context.Context, t time.Duration, sql string, rows *sql.Rows, err error) {
+		sql = redactSQL(sql)
 		if err == nil {
 			logger.With(ctx, "duration", t.Milliseconds(), "sql", sql).Info("DB query successful")
 		} else {
@@ -118,9 +290,10 @@ func logDBQuery(logger log.Logger) dbx.QueryLogFunc {
 	}
 }
 
-// logDBExec returns a logging function that can be used to log SQL executions.
+// logDBExec returns a logging function that can be used to log SQL executions without their string parameters.
 func logDBExec(logger log.Logger) dbx.ExecLogFunc {
 	return func(ctx context.Context, t time.Duration, sql string, result sql.Result, err error) {
+		sql = redactSQL(sql)
 		if err == nil {
 			logger.With(ctx, "duration", t.Milliseconds(), "sql", sql).Info("DB execution successful")
 		} else {
@@ -2,10 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/nvnoskov/dynamo-backend/internal/config"
 	"github.com/nvnoskov/dynamo-backend/pkg/log"
 	"github.com/stretchr/testify/assert"
 )
@@ -39,3 +48,57 @@ func Test_logDBExec(t *testing.T) {
 		assert.Equal(t, "DB execution error: test", entries.All()[0].Message)
 	}
 }
+
+func Test_redactSQL(t *testing.T) {
+	assert.Equal(t, `SELECT * FROM "passenger" WHERE "document_number"='?' AND "flight_id"='?' LIMIT 1`,
+		redactSQL(`SELECT * FROM "passenger" WHERE "document_number"='AB1234567' AND "flight_id"='f1' LIMIT 1`))
+	assert.Equal(t, `INSERT INTO "passenger" ("last_name", "age") VALUES ('?', 42)`,
+		redactSQL(`INSERT INTO "passenger" ("last_name", "age") VALUES ('O''Brien', 42)`))
+}
+
+func Test_logDB_redacted(t *testing.T) {
+	logger, entries := log.NewForTest()
+	sql := `INSERT INTO "passenger" ("document_number") VALUES ('AB1234567')`
+	logDBQuery(logger)(context.Background(), time.Millisecond, sql, nil, nil)
+	logDBExec(logger)(context.Background(), time.Millisecond, sql, nil, nil)
+	logDBExec(logger)(context.Background(), time.Millisecond, sql, nil, fmt.Errorf("test"))
+	if assert.Equal(t, 3, entries.Len()) {
+		for _, entry := range entries.All() {
+			assert.Equal(t, `INSERT INTO "passenger" ("document_number") VALUES ('?')`, entry.ContextMap()["sql"])
+		}
+	}
+}
+
+func Test_loadKeys(t *testing.T) {
+	// the development key isn't committed, so a key is generated like by "make keys"
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	assert.Nil(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	dir, err := ioutil.TempDir("", "keys")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "local.pem")
+	assert.Nil(t, ioutil.WriteFile(file, data, 0600))
+
+	// the keys set by the JWT_KEYS environment variable are parsed as JSON
+	value, _ := json.Marshal([]map[string]string{
+		{"id": "k1", "file": file},
+		{"id": "k2", "pem": string(data), "active_from": "2021-01-01T00:00:00Z"},
+	})
+	cfg := &config.Config{JWTExpirationMinutes: 15}
+	assert.Nil(t, json.Unmarshal(value, &cfg.JWTKeys))
+	if assert.Equal(t, 2, len(cfg.JWTKeys)) {
+		assert.Nil(t, cfg.JWTKeys[1].Validate())
+		assert.Equal(t, 2021, cfg.JWTKeys[1].ActiveFrom.Year())
+	}
+	keys, err := loadKeys(cfg)
+	assert.Nil(t, err)
+	key, _ := keys.SigningKey(time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, "k2", key.ID)
+
+	cfg.JWTKeys = []config.JWTKey{{ID: "k3", PEM: "invalid"}}
+	_, err = loadKeys(cfg)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,79 @@
+package aircraft
+
+import (
+	"net/http"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/errors"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/nvnoskov/dynamo-backend/pkg/pagination"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	// the following endpoints require a valid JWT
+	r.Use(authHandler)
+	r.Get("/aircraft/<id>", res.get)
+	r.Get("/aircraft", res.query)
+
+	// the following endpoints require the admin or operator role as well
+	manage := auth.RequireRole(entity.RoleAdmin, entity.RoleOperator)
+	r.Post("/aircraft", manage, res.create)
+	r.Delete("/aircraft/<id>", manage, res.delete)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	aircraft, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(aircraft)
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	aircraft, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = aircraft
+	return c.Write(pages)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input CreateAircraftRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	aircraft, err := r.service.Create(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(aircraft, http.StatusCreated)
+}
+
+func (r resource) delete(c *routing.Context) error {
+	aircraft, err := r.service.Delete(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(aircraft)
+}
@@ -0,0 +1,49 @@
+package aircraft
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{items: []entity.Aircraft{
+		{
+			ID:        "123",
+			Name:      "A320",
+			Cabins:    entity.Cabins{{Class: entity.CabinEconomy, FirstRow: 1, LastRow: 30, Letters: "ABCDEF"}},
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, logger)
+	header := auth.MockRoleAuthHeader(entity.RoleAdmin)
+	customer := auth.MockRoleAuthHeader(entity.RoleCustomer)
+
+	body := `{"name":"E190","cabins":[{"class":"business","first_row":1,"last_row":3,"letters":"ACD"},{"class":"economy","first_row":4,"last_row":25,"letters":"ACDF"}]}`
+	tests := []test.APITestCase{
+		{"get all", "GET", "/aircraft", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get 123", "GET", "/aircraft/123", "", header, http.StatusOK, `*"capacity":180*`},
+		{"get unknown", "GET", "/aircraft/1234", "", header, http.StatusNotFound, ""},
+		{"create ok", "POST", "/aircraft", body, header, http.StatusCreated, `*"capacity":97*`},
+		{"create ok count", "GET", "/aircraft", "", header, http.StatusOK, `*"total_count":2*`},
+		{"create auth error", "POST", "/aircraft", body, nil, http.StatusUnauthorized, ""},
+		{"create customer", "POST", "/aircraft", body, customer, http.StatusForbidden, ""},
+		{"create input error", "POST", "/aircraft", `"name":"test"}`, header, http.StatusBadRequest, ""},
+		{"create validation error", "POST", "/aircraft", `{"name":"test","cabins":[{"class":"economy","first_row":1,"last_row":30,"letters":"AAB"}]}`, header, http.StatusBadRequest, `*"field":"cabins"*`},
+		{"delete customer", "DELETE", "/aircraft/123", ``, customer, http.StatusForbidden, ""},
+		{"delete ok", "DELETE", "/aircraft/123", ``, header, http.StatusOK, "*A320*"},
+		{"delete verify", "DELETE", "/aircraft/123", ``, header, http.StatusNotFound, ""},
+		{"delete auth error", "DELETE", "/aircraft/123", ``, nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
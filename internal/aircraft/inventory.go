@@ -0,0 +1,71 @@
+package aircraft
+
+import (
+	"context"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/errors"
+)
+
+// generateSeatsSQL inserts a seat for every row and letter of the cabins of the aircraft configuration
+// of the flight bound to the "flight" parameter.
+const generateSeatsSQL = `INSERT INTO seat (flight_id, number, cabin, "row", letter, status)
+SELECT flight.id, r::text || l, c->>'class', r, l, 'available'
+FROM flight
+JOIN aircraft ON aircraft.id = flight.aircraft_id,
+jsonb_array_elements(aircraft.cabins) c,
+generate_series((c->>'first_row')::int, (c->>'last_row')::int) r,
+regexp_split_to_table(c->>'letters', '') l
+WHERE flight.id = {:flight}`
+
+// ErrSeatsTaken is returned when the seats of a flight can't be replaced or deleted because some are held or booked.
+var ErrSeatsTaken = errors.Conflict("the flight has held or booked seats")
+
+// SameID reports whether both aircraft configuration IDs are absent or equal,
+// i.e. whether the seats of a flight stay the same when its aircraft configuration ID changes from a to b.
+func SameID(a, b *string) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+// GenerateSeats replaces the seat inventory of the flight with the seats of its aircraft configuration in the database.
+// A flight without an aircraft configuration is left without seats.
+func (r repository) GenerateSeats(ctx context.Context, flightID string) error {
+	if err := r.DeleteSeats(ctx, flightID); err != nil {
+		return err
+	}
+	_, err := r.db.With(ctx).NewQuery(generateSeatsSQL).Bind(dbx.Params{"flight": flightID}).Execute()
+	return err
+}
+
+// DeleteSeats deletes the seats of the flights with the specified IDs from the database.
+// ErrSeatsTaken is returned if any of them is held or booked.
+// It should be called in a transaction, which keeps the seats locked until they are deleted.
+func (r repository) DeleteSeats(ctx context.Context, flightIDs ...string) error {
+	if len(flightIDs) == 0 {
+		return nil
+	}
+	where := dbx.In("flight_id", values(flightIDs)...)
+	// the seats are locked while checked, so that none can be held meanwhile
+	var statuses []string
+	query := r.db.With(ctx).Select("status").From("seat").Where(where).OrderBy("flight_id", "number").Build()
+	if err := r.db.With(ctx).NewQuery(query.SQL() + " FOR UPDATE").Bind(query.Params()).Column(&statuses); err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if status != entity.SeatAvailable {
+			return ErrSeatsTaken
+		}
+	}
+	_, err := r.db.With(ctx).Delete("seat", where).Execute()
+	return err
+}
+
+// values converts the strings into the values of an IN expression.
+func values(s []string) []interface{} {
+	result := make([]interface{}, len(s))
+	for i, v := range s {
+		result[i] = v
+	}
+	return result
+}
@@ -0,0 +1,46 @@
+package aircraft
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+)
+
+// MockAircraft is the only aircraft configuration known to MockService, with 8 business class seats.
+var MockAircraft = Aircraft{Aircraft: entity.Aircraft{
+	ID:     "a320",
+	Name:   "A320",
+	Cabins: entity.Cabins{{Class: entity.CabinBusiness, FirstRow: 1, LastRow: 2, Letters: "ACDF"}},
+}, Capacity: 8}
+
+// MockService is an aircraft configuration service for testing purpose, which knows MockAircraft.
+type MockService struct{}
+
+// Get returns MockAircraft if the ID is its ID.
+func (m MockService) Get(ctx context.Context, id string) (Aircraft, error) {
+	if id == MockAircraft.ID {
+		return MockAircraft, nil
+	}
+	return Aircraft{}, sql.ErrNoRows
+}
+
+// Query returns no aircraft configurations.
+func (m MockService) Query(ctx context.Context, offset, limit int) ([]Aircraft, error) {
+	return nil, nil
+}
+
+// Count returns zero.
+func (m MockService) Count(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+// Create creates nothing.
+func (m MockService) Create(ctx context.Context, input CreateAircraftRequest) (Aircraft, error) {
+	return Aircraft{}, nil
+}
+
+// Delete deletes nothing.
+func (m MockService) Delete(ctx context.Context, id string) (Aircraft, error) {
+	return Aircraft{}, nil
+}
@@ -0,0 +1,32 @@
+package aircraft
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// ValidateReference checks that the aircraft configuration with the given ID, if any, is known to the service
+// and has room for the given number of seats on sale. The errors are added to errs under the "aircraft_id"
+// and "capacity" keys. It returns the number of seats on sale, which defaults to the capacity of
+// the aircraft configuration if 0.
+func ValidateReference(ctx context.Context, service Service, id string, capacity int, errs validation.Errors) (int, error) {
+	if id == "" {
+		return capacity, nil
+	}
+	a, err := service.Get(ctx, id)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+		errs["aircraft_id"] = errors.New("must be a known aircraft configuration")
+	} else if capacity == 0 {
+		capacity = a.Capacity
+	} else if capacity > a.Capacity {
+		errs["capacity"] = fmt.Errorf("must be no greater than the %v seats of the aircraft configuration", a.Capacity)
+	}
+	return capacity, nil
+}
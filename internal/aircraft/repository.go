@@ -0,0 +1,104 @@
+package aircraft
+
+import (
+	"context"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/dbcontext"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+// Repository encapsulates the logic to access aircraft configurations from the data source.
+type Repository interface {
+	// Get returns the aircraft configuration with the specified ID.
+	Get(ctx context.Context, id string) (entity.Aircraft, error)
+	// Count returns the number of aircraft configurations.
+	Count(ctx context.Context) (int, error)
+	// Query returns the list of aircraft configurations with the given offset and limit.
+	Query(ctx context.Context, offset, limit int) ([]entity.Aircraft, error)
+	// Create saves a new aircraft configuration in the storage.
+	Create(ctx context.Context, aircraft entity.Aircraft) error
+	// Delete removes the aircraft configuration with given ID from the storage.
+	// It fails with ErrInUse if flights or schedules use the aircraft configuration.
+	Delete(ctx context.Context, id string) error
+	// GenerateSeats replaces the seats of the flight with given ID with the seats of its aircraft configuration.
+	// It should be called in the transaction that saves the flight,
+	// and fails with ErrSeatsTaken if seats of the flight are held or booked.
+	GenerateSeats(ctx context.Context, flightID string) error
+	// DeleteSeats removes the seats of the flights with given IDs from the storage.
+	// It should be called in the transaction that deletes the flights,
+	// and fails with ErrSeatsTaken if seats of the flights are held or booked.
+	DeleteSeats(ctx context.Context, flightIDs ...string) error
+}
+
+// repository persists aircraft configurations in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new aircraft configuration repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the aircraft configuration with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Aircraft, error) {
+	var aircraft entity.Aircraft
+	err := r.db.With(ctx).Select().Model(id, &aircraft)
+	return aircraft, err
+}
+
+// Create saves a new aircraft configuration record in the database.
+func (r repository) Create(ctx context.Context, aircraft entity.Aircraft) error {
+	return r.db.With(ctx).Model(&aircraft).Insert()
+}
+
+// Delete deletes the aircraft configuration with the specified ID from the database unless it is in use.
+// The aircraft configuration is locked while checking, so that no flight or schedule can start using it meanwhile.
+func (r repository) Delete(ctx context.Context, id string) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		var aircraft entity.Aircraft
+		query := r.db.With(ctx).Select().From("aircraft").Where(dbx.HashExp{"id": id}).Build()
+		if err := r.db.With(ctx).NewQuery(query.SQL() + " FOR UPDATE").Bind(query.Params()).One(&aircraft); err != nil {
+			return err
+		}
+		if used, err := r.inUse(ctx, id); err != nil {
+			return err
+		} else if used {
+			return ErrInUse
+		}
+		return r.db.With(ctx).Model(&aircraft).Delete()
+	})
+}
+
+// Count returns the number of the aircraft configuration records in the database.
+func (r repository) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("aircraft").Row(&count)
+	return count, err
+}
+
+// Query retrieves the aircraft configuration records with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Aircraft, error) {
+	var aircraft []entity.Aircraft
+	err := r.db.With(ctx).
+		Select().
+		From("aircraft").
+		OrderBy("name", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&aircraft)
+	return aircraft, err
+}
+
+// inUse checks whether any flight or schedule refers to the aircraft configuration in the database.
+func (r repository) inUse(ctx context.Context, id string) (bool, error) {
+	var used bool
+	err := r.db.With(ctx).NewQuery("SELECT EXISTS (SELECT 1 FROM flight WHERE aircraft_id={:id})" +
+		" OR EXISTS (SELECT 1 FROM schedule WHERE aircraft_id={:id})").
+		Bind(dbx.Params{"id": id}).
+		Row(&used)
+	return used, err
+}
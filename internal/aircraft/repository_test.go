@@ -0,0 +1,77 @@
+package aircraft
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "aircraft", "flight", "schedule")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+
+	// create
+	err := repo.Create(ctx, entity.Aircraft{
+		ID:   "a320",
+		Name: "A320",
+		Cabins: entity.Cabins{
+			{Class: entity.CabinBusiness, FirstRow: 1, LastRow: 3, Letters: "ACDF"},
+			{Class: entity.CabinEconomy, FirstRow: 10, LastRow: 30, Letters: "ABCDEF"},
+		},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	assert.Nil(t, err)
+	count, err := repo.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	// get
+	aircraft, err := repo.Get(ctx, "a320")
+	assert.Nil(t, err)
+	assert.Equal(t, "A320", aircraft.Name)
+	if assert.Equal(t, 2, len(aircraft.Cabins)) {
+		assert.Equal(t, "ABCDEF", aircraft.Cabins[1].Letters)
+	}
+	_, err = repo.Get(ctx, "b737")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// query
+	items, err := repo.Query(ctx, 0, count)
+	assert.Nil(t, err)
+	assert.Equal(t, count, len(items))
+
+	// delete fails while a flight uses the configuration
+	_, err = db.DB().Insert("flight", map[string]interface{}{
+		"id": "f1", "name": "flight1", "number": "F1", "departure": "MSQ", "destination": "ARN",
+		"departure_time": time.Now(), "arrival_time": time.Now().Add(time.Hour), "fare": "100EUR",
+		"fare_amount": 10000, "fare_currency": "EUR", "duration_minutes": 60, "aircraft_id": "a320",
+		"created_at": time.Now(), "updated_at": time.Now(),
+	}).Execute()
+	assert.Nil(t, err)
+	err = repo.Delete(ctx, "a320")
+	assert.Equal(t, ErrInUse, err)
+	_, err = repo.Get(ctx, "a320")
+	assert.Nil(t, err)
+	_, err = db.DB().Delete("flight", dbx.HashExp{"id": "f1"}).Execute()
+	assert.Nil(t, err)
+
+	// delete
+	err = repo.Delete(ctx, "a320")
+	assert.Nil(t, err)
+	_, err = repo.Get(ctx, "a320")
+	assert.Equal(t, sql.ErrNoRows, err)
+	err = repo.Delete(ctx, "a320")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
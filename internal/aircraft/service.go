@@ -0,0 +1,173 @@
+package aircraft
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/errors"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+// maxCapacity is the largest number of seats of an aircraft configuration.
+const maxCapacity = 1000
+
+// Service encapsulates usecase logic for aircraft configurations.
+type Service interface {
+	Get(ctx context.Context, id string) (Aircraft, error)
+	Query(ctx context.Context, offset, limit int) ([]Aircraft, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, input CreateAircraftRequest) (Aircraft, error)
+	Delete(ctx context.Context, id string) (Aircraft, error)
+}
+
+// Aircraft represents the data about an aircraft configuration.
+type Aircraft struct {
+	entity.Aircraft
+	Capacity int `json:"capacity"` // number of seats
+}
+
+// CreateAircraftRequest represents an aircraft configuration creation request.
+type CreateAircraftRequest struct {
+	Name   string         `json:"name"`   // configuration name, e.g. "A320 2-class"
+	Cabins []CabinRequest `json:"cabins"` // cabins from the front to the back of the aircraft
+}
+
+// CabinRequest represents a cabin of an aircraft configuration creation request.
+type CabinRequest struct {
+	Class    string `json:"class"`     // cabin class: "first", "business", "premium_economy" or "economy"
+	FirstRow int    `json:"first_row"` // number of the first row of the cabin
+	LastRow  int    `json:"last_row"`  // number of the last row of the cabin
+	Letters  string `json:"letters"`   // seat letters of every row from left to right, e.g. "ABCDEF"
+}
+
+var lettersRegex = regexp.MustCompile(`^[A-K]{1,10}$`)
+
+// Validate validates the CreateAircraftRequest fields.
+func (m CreateAircraftRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.Cabins, validation.Required, validation.Length(0, 4), validation.By(validateLayout)),
+	)
+}
+
+// Validate validates the CabinRequest fields.
+func (m CabinRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Class, validation.Required, validation.In(
+			entity.CabinFirst, entity.CabinBusiness, entity.CabinPremiumEconomy, entity.CabinEconomy)),
+		validation.Field(&m.FirstRow, validation.Required, validation.Min(1), validation.Max(99)),
+		validation.Field(&m.LastRow, validation.Required, validation.Min(m.FirstRow).Error("must not be less than first_row"),
+			validation.Max(99)),
+		validation.Field(&m.Letters, validation.Required,
+			validation.Match(lettersRegex).Error("must be seat letters from A to K, e.g. ABCDEF"),
+			validation.By(validateDistinct)),
+	)
+}
+
+// validateLayout checks that the cabins follow each other without sharing rows
+// and that the aircraft has no more than maxCapacity seats.
+func validateLayout(value interface{}) error {
+	cabins, _ := value.([]CabinRequest)
+	capacity := 0
+	for i, cabin := range cabins {
+		if i > 0 && cabin.FirstRow <= cabins[i-1].LastRow {
+			return validation.NewError("validation_cabin_rows", "must list the cabins from the front to the back without sharing rows")
+		}
+		if cabin.LastRow >= cabin.FirstRow {
+			capacity += (cabin.LastRow - cabin.FirstRow + 1) * len(cabin.Letters)
+		}
+	}
+	if capacity > maxCapacity {
+		return validation.NewError("validation_capacity", "must not have more than 1000 seats")
+	}
+	return nil
+}
+
+// validateDistinct checks that no seat letter is repeated.
+func validateDistinct(value interface{}) error {
+	s, _ := value.(string)
+	for i, c := range s {
+		if strings.ContainsRune(s[i+1:], c) {
+			return validation.NewError("validation_letters_distinct", "must not repeat a seat letter")
+		}
+	}
+	return nil
+}
+
+// ErrInUse is returned when deleting an aircraft configuration that flights or schedules are operated with.
+var ErrInUse = errors.Conflict("The aircraft configuration is used by flights or schedules.")
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// NewService creates a new aircraft configuration service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// Get returns the aircraft configuration with the specified ID.
+func (s service) Get(ctx context.Context, id string) (Aircraft, error) {
+	aircraft, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Aircraft{}, err
+	}
+	return Aircraft{aircraft, aircraft.Capacity()}, nil
+}
+
+// Create creates a new aircraft configuration.
+func (s service) Create(ctx context.Context, req CreateAircraftRequest) (Aircraft, error) {
+	if err := req.Validate(); err != nil {
+		return Aircraft{}, err
+	}
+	now := time.Now()
+	aircraft := entity.Aircraft{
+		ID:        entity.GenerateID(),
+		Name:      req.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for _, cabin := range req.Cabins {
+		aircraft.Cabins = append(aircraft.Cabins, entity.Cabin(cabin))
+	}
+	if err := s.repo.Create(ctx, aircraft); err != nil {
+		return Aircraft{}, err
+	}
+	return s.Get(ctx, aircraft.ID)
+}
+
+// Delete deletes the aircraft configuration with the specified ID.
+// ErrInUse is returned if flights or schedules are operated with it.
+func (s service) Delete(ctx context.Context, id string) (Aircraft, error) {
+	aircraft, err := s.Get(ctx, id)
+	if err != nil {
+		return Aircraft{}, err
+	}
+	if err = s.repo.Delete(ctx, id); err != nil {
+		return Aircraft{}, err
+	}
+	return aircraft, nil
+}
+
+// Count returns the number of aircraft configurations.
+func (s service) Count(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
+}
+
+// Query returns the aircraft configurations with the specified offset and limit.
+func (s service) Query(ctx context.Context, offset, limit int) ([]Aircraft, error) {
+	items, err := s.repo.Query(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Aircraft{}
+	for _, item := range items {
+		result = append(result, Aircraft{item, item.Capacity()})
+	}
+	return result, nil
+}
@@ -0,0 +1,198 @@
+package aircraft
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var errCRUD = errors.New("error crud")
+
+func TestCreateAircraftRequest_Validate(t *testing.T) {
+	economy := CabinRequest{Class: "economy", FirstRow: 10, LastRow: 30, Letters: "ABCDEF"}
+	tests := []struct {
+		name      string
+		model     CreateAircraftRequest
+		wantError bool
+	}{
+		{"success", CreateAircraftRequest{Name: "A320", Cabins: []CabinRequest{
+			{Class: "business", FirstRow: 1, LastRow: 3, Letters: "ACDF"}, economy}}, false},
+		{"required", CreateAircraftRequest{}, true},
+		{"unknown class", CreateAircraftRequest{Name: "A320", Cabins: []CabinRequest{
+			{Class: "luxury", FirstRow: 1, LastRow: 3, Letters: "ACDF"}}}, true},
+		{"rows reversed", CreateAircraftRequest{Name: "A320", Cabins: []CabinRequest{
+			{Class: "economy", FirstRow: 30, LastRow: 10, Letters: "ABC"}}}, true},
+		{"invalid letters", CreateAircraftRequest{Name: "A320", Cabins: []CabinRequest{
+			{Class: "economy", FirstRow: 1, LastRow: 10, Letters: "ABZ"}}}, true},
+		{"repeated letters", CreateAircraftRequest{Name: "A320", Cabins: []CabinRequest{
+			{Class: "economy", FirstRow: 1, LastRow: 10, Letters: "ABA"}}}, true},
+		{"overlapping cabins", CreateAircraftRequest{Name: "A320", Cabins: []CabinRequest{
+			{Class: "business", FirstRow: 1, LastRow: 10, Letters: "ACDF"}, economy}}, true},
+		{"too many seats", CreateAircraftRequest{Name: "A380", Cabins: []CabinRequest{
+			{Class: "economy", FirstRow: 1, LastRow: 99, Letters: "ABCDEFGHJK"},
+			{Class: "economy", FirstRow: 1, LastRow: 1, Letters: "A"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_CRUD(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, logger)
+
+	ctx := context.Background()
+
+	// initial count
+	count, _ := s.Count(ctx)
+	assert.Equal(t, 0, count)
+
+	// successful creation
+	aircraft, err := s.Create(ctx, CreateAircraftRequest{Name: "A320", Cabins: []CabinRequest{
+		{Class: "business", FirstRow: 1, LastRow: 3, Letters: "ACDF"},
+		{Class: "economy", FirstRow: 10, LastRow: 30, Letters: "ABCDEF"},
+	}})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, aircraft.ID)
+	id := aircraft.ID
+	assert.Equal(t, "A320", aircraft.Name)
+	assert.Equal(t, 138, aircraft.Capacity)
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 1, count)
+
+	// validation error in creation
+	_, err = s.Create(ctx, CreateAircraftRequest{Name: "A320"})
+	assert.NotNil(t, err)
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 1, count)
+
+	// unexpected error in creation
+	_, err = s.Create(ctx, CreateAircraftRequest{Name: "error", Cabins: []CabinRequest{
+		{Class: "economy", FirstRow: 1, LastRow: 30, Letters: "ABCDEF"},
+	}})
+	assert.Equal(t, errCRUD, err)
+
+	// get
+	_, err = s.Get(ctx, "none")
+	assert.NotNil(t, err)
+	aircraft, err = s.Get(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(aircraft.Cabins))
+
+	// query
+	items, _ := s.Query(ctx, 0, 0)
+	assert.Equal(t, 1, len(items))
+	assert.Equal(t, 138, items[0].Capacity)
+
+	// delete
+	repo.used = true
+	_, err = s.Delete(ctx, id)
+	assert.Equal(t, ErrInUse, err)
+	repo.used = false
+	_, err = s.Delete(ctx, "none")
+	assert.NotNil(t, err)
+	aircraft, err = s.Delete(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, id, aircraft.ID)
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 0, count)
+}
+
+func TestValidateReference(t *testing.T) {
+	ctx := context.Background()
+
+	// the capacity defaults to the capacity of the aircraft configuration
+	errs := validation.Errors{}
+	capacity, err := ValidateReference(ctx, MockService{}, "a320", 0, errs)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, capacity)
+	assert.Empty(t, errs)
+
+	// no aircraft configuration
+	capacity, err = ValidateReference(ctx, MockService{}, "", 100, errs)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, capacity)
+	assert.Empty(t, errs)
+
+	// more seats than the aircraft configuration has
+	_, err = ValidateReference(ctx, MockService{}, "a320", 9, errs)
+	assert.Nil(t, err)
+	assert.Contains(t, errs, "capacity")
+
+	// unknown aircraft configuration
+	errs = validation.Errors{}
+	_, err = ValidateReference(ctx, MockService{}, "b737", 0, errs)
+	assert.Nil(t, err)
+	assert.Contains(t, errs, "aircraft_id")
+}
+
+func TestSameID(t *testing.T) {
+	a320, b737 := "a320", "b737"
+	assert.True(t, SameID(nil, nil))
+	assert.True(t, SameID(&a320, &a320))
+	assert.False(t, SameID(&a320, &b737))
+	assert.False(t, SameID(nil, &a320))
+	assert.False(t, SameID(&a320, nil))
+}
+
+type mockRepository struct {
+	items []entity.Aircraft
+	used  bool
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.Aircraft, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.Aircraft{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context) (int, error) {
+	return len(m.items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.Aircraft, error) {
+	return m.items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, aircraft entity.Aircraft) error {
+	if aircraft.Name == "error" {
+		return errCRUD
+	}
+	m.items = append(m.items, aircraft)
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	if m.used {
+		return ErrInUse
+	}
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items[i] = m.items[len(m.items)-1]
+			m.items = m.items[:len(m.items)-1]
+			break
+		}
+	}
+	return nil
+}
+
+func (m mockRepository) GenerateSeats(ctx context.Context, flightID string) error {
+	return nil
+}
+
+func (m mockRepository) DeleteSeats(ctx context.Context, flightIDs ...string) error {
+	return nil
+}
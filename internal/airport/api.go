@@ -0,0 +1,48 @@
+package airport
+
+import (
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/nvnoskov/dynamo-backend/pkg/pagination"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	// the following endpoints require a valid JWT
+	r.Use(authHandler)
+	r.Get("/airports/<code>", res.get)
+	r.Get("/airports", res.query)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	airport, err := r.service.Get(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(airport)
+}
+
+func (r resource) query(c *routing.Context) error {
+	search := c.Query("q")
+
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx, search)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	airports, err := r.service.Query(ctx, search, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = airports
+	return c.Write(pages)
+}
@@ -0,0 +1,36 @@
+package airport
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{items: []entity.Airport{
+		{Code: "ARN", ICAO: "ESSA", Name: "Stockholm Arlanda Airport", City: "Stockholm", Country: "Sweden", Timezone: "Europe/Stockholm"},
+		{Code: "MMX", ICAO: "ESMS", Name: "Malmö Sturup Airport", City: "Malmö", Country: "Sweden", Timezone: "Europe/Stockholm"},
+		{Code: "MZH", ICAO: "LTAP", Name: "Amasya Merzifon Airport", City: "Merzifon", Country: "Turkey", Timezone: "Europe/Istanbul"},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/airports", "", header, http.StatusOK, `*"total_count":3*`},
+		{"search by code", "GET", "/airports?q=arn", "", header, http.StatusOK, `*"total_count":1*`},
+		{"search by city", "GET", "/airports?q=M", "", header, http.StatusOK, `*"total_count":2*`},
+		{"get ARN", "GET", "/airports/ARN", "", header, http.StatusOK, `*Stockholm Arlanda Airport*`},
+		{"get lowercase", "GET", "/airports/mzh", "", header, http.StatusOK, `*"timezone":"Europe/Istanbul"*`},
+		{"get unknown", "GET", "/airports/XXX", "", header, http.StatusNotFound, ""},
+		{"get auth error", "GET", "/airports", "", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
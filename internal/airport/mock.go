@@ -0,0 +1,45 @@
+package airport
+
+import (
+	"context"
+	"database/sql"
+	"io"
+
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+)
+
+// MockAirports maps the codes of the airports known to MockService to their time zones.
+var MockAirports = map[string]string{
+	"ARN": "Europe/Stockholm",
+	"LED": "Europe/Moscow",
+	"MMX": "Europe/Stockholm",
+	"MSQ": "Europe/Minsk",
+	"MZH": "Europe/Istanbul",
+	"SVO": "Europe/Moscow",
+}
+
+// MockService is an airport service for testing purpose, which knows the airports of MockAirports.
+type MockService struct{}
+
+// Get returns the airport with the given code if it is one of MockAirports.
+func (m MockService) Get(ctx context.Context, code string) (Airport, error) {
+	if timezone, ok := MockAirports[code]; ok {
+		return Airport{entity.Airport{Code: code, Timezone: timezone}}, nil
+	}
+	return Airport{}, sql.ErrNoRows
+}
+
+// Query returns no airports.
+func (m MockService) Query(ctx context.Context, search string, offset, limit int) ([]Airport, error) {
+	return nil, nil
+}
+
+// Count returns zero.
+func (m MockService) Count(ctx context.Context, search string) (int, error) {
+	return 0, nil
+}
+
+// Import imports nothing.
+func (m MockService) Import(ctx context.Context, r io.Reader) (int, error) {
+	return 0, nil
+}
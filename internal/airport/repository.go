@@ -0,0 +1,87 @@
+package airport
+
+import (
+	"context"
+	"strings"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/dbcontext"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+// Repository encapsulates the logic to access airports from the data source.
+type Repository interface {
+	// Get returns the airport with the specified IATA code.
+	Get(ctx context.Context, code string) (entity.Airport, error)
+	// Count returns the number of airports matching the search term.
+	Count(ctx context.Context, search string) (int, error)
+	// Query returns the list of airports matching the search term with the given offset and limit.
+	Query(ctx context.Context, search string, offset, limit int) ([]entity.Airport, error)
+	// Save creates the airport or updates it if an airport with the same code exists.
+	Save(ctx context.Context, airport entity.Airport) error
+}
+
+// repository persists airports in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new airport repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the airport with the specified code from the database.
+func (r repository) Get(ctx context.Context, code string) (entity.Airport, error) {
+	var airport entity.Airport
+	err := r.db.With(ctx).Select().Model(code, &airport)
+	return airport, err
+}
+
+// Save upserts the airport record in the database.
+func (r repository) Save(ctx context.Context, airport entity.Airport) error {
+	_, err := r.db.With(ctx).Upsert("airport", dbx.Params{
+		"code":      airport.Code,
+		"icao":      airport.ICAO,
+		"name":      airport.Name,
+		"city":      airport.City,
+		"country":   airport.Country,
+		"latitude":  airport.Latitude,
+		"longitude": airport.Longitude,
+		"timezone":  airport.Timezone,
+	}, "code").Execute()
+	return err
+}
+
+// Count returns the number of the airport records matching the search term in the database.
+func (r repository) Count(ctx context.Context, search string) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("airport").Where(searchExp(search)).Row(&count)
+	return count, err
+}
+
+// Query retrieves the airport records matching the search term with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, search string, offset, limit int) ([]entity.Airport, error) {
+	var airports []entity.Airport
+	err := r.db.With(ctx).
+		Select().
+		Where(searchExp(search)).
+		OrderBy("code").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&airports)
+	return airports, err
+}
+
+// searchExp builds the condition matching airports whose IATA code, ICAO code or city starts with the search term.
+// The codes are stored in upper case, and the city is compared in lower case, so that the prefix indexes apply.
+func searchExp(search string) dbx.Expression {
+	if search == "" {
+		return nil
+	}
+	prefix := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search) + "%"
+	return dbx.NewExp("code LIKE {:code} OR icao LIKE {:code} OR lower(city) LIKE {:city}",
+		dbx.Params{"code": strings.ToUpper(prefix), "city": strings.ToLower(prefix)})
+}
@@ -0,0 +1,70 @@
+package airport
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "airport")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+
+	// save
+	airport := entity.Airport{
+		Code:      "ARN",
+		ICAO:      "ESSA",
+		Name:      "Stockholm Arlanda Airport",
+		City:      "Stockholm",
+		Country:   "Sweden",
+		Latitude:  59.651901,
+		Longitude: 17.9186,
+		Timezone:  "Europe/Stockholm",
+	}
+	err := repo.Save(ctx, airport)
+	assert.Nil(t, err)
+	count, _ := repo.Count(ctx, "")
+	assert.Equal(t, 1, count)
+
+	// save existing
+	airport.Name = "Arlanda"
+	err = repo.Save(ctx, airport)
+	assert.Nil(t, err)
+	count, _ = repo.Count(ctx, "")
+	assert.Equal(t, 1, count)
+
+	// get
+	airport, err = repo.Get(ctx, "ARN")
+	assert.Nil(t, err)
+	assert.Equal(t, "Arlanda", airport.Name)
+	_, err = repo.Get(ctx, "XXX")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// query by code and city prefix
+	airports, err := repo.Query(ctx, "ar", 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(airports))
+	airports, err = repo.Query(ctx, "stock", 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(airports))
+	count, _ = repo.Count(ctx, "minsk")
+	assert.Equal(t, 0, count)
+}
+
+func Test_searchExp(t *testing.T) {
+	assert.Nil(t, searchExp(""))
+	params := dbx.Params{}
+	assert.Equal(t, "code LIKE {:code} OR icao LIKE {:code} OR lower(city) LIKE {:city}", searchExp("Mi_").Build(nil, params))
+	assert.Equal(t, `MI\_%`, params["code"])
+	assert.Equal(t, `mi\_%`, params["city"])
+}
@@ -0,0 +1,171 @@
+package airport
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+// Service encapsulates usecase logic for airports.
+type Service interface {
+	Get(ctx context.Context, code string) (Airport, error)
+	Query(ctx context.Context, search string, offset, limit int) ([]Airport, error)
+	Count(ctx context.Context, search string) (int, error)
+	Import(ctx context.Context, r io.Reader) (int, error)
+}
+
+// Airport represents the data about an airport.
+type Airport struct {
+	entity.Airport
+}
+
+// Location returns the time zone of the airport.
+func (a Airport) Location() (*time.Location, error) {
+	return time.LoadLocation(a.Timezone)
+}
+
+var (
+	// CodeRegex matches IATA airport codes.
+	CodeRegex = regexp.MustCompile(`^[A-Z]{3}$`)
+	icaoRegex = regexp.MustCompile(`^[A-Z0-9]{4}$`)
+)
+
+// Validate validates the Airport fields.
+func (a Airport) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.Code, validation.Required, validation.Match(CodeRegex)),
+		validation.Field(&a.ICAO, validation.Required, validation.Match(icaoRegex)),
+		validation.Field(&a.Name, validation.Required, validation.Length(0, 128)),
+		validation.Field(&a.City, validation.Required, validation.Length(0, 100)),
+		validation.Field(&a.Country, validation.Required, validation.Length(0, 100)),
+		validation.Field(&a.Latitude, validation.Min(-90.0), validation.Max(90.0)),
+		validation.Field(&a.Longitude, validation.Min(-180.0), validation.Max(180.0)),
+		validation.Field(&a.Timezone, validation.Required, validation.By(validateTimezone)),
+	)
+}
+
+// validateTimezone checks that the value is a known IANA time zone name.
+func validateTimezone(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	_, err := time.LoadLocation(s)
+	return err
+}
+
+// ValidateCodes checks that the airports with the given IATA codes are known to the service.
+// The codes are keyed by the names of the fields holding them, and an error is returned for each field
+// with an unknown code.
+func ValidateCodes(ctx context.Context, service Service, codes map[string]string) (validation.Errors, error) {
+	errs := validation.Errors{}
+	for field, code := range codes {
+		if _, err := service.Get(ctx, code); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return nil, err
+			}
+			errs[field] = errors.New("must be a known airport code")
+		}
+	}
+	return errs, nil
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// NewService creates a new airport service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// Get returns the airport with the specified IATA code.
+func (s service) Get(ctx context.Context, code string) (Airport, error) {
+	airport, err := s.repo.Get(ctx, strings.ToUpper(code))
+	if err != nil {
+		return Airport{}, err
+	}
+	return Airport{airport}, nil
+}
+
+// Count returns the number of airports matching the search term.
+func (s service) Count(ctx context.Context, search string) (int, error) {
+	return s.repo.Count(ctx, search)
+}
+
+// Query returns the airports matching the search term with the specified offset and limit.
+func (s service) Query(ctx context.Context, search string, offset, limit int) ([]Airport, error) {
+	items, err := s.repo.Query(ctx, search, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Airport{}
+	for _, item := range items {
+		result = append(result, Airport{item})
+	}
+	return result, nil
+}
+
+// Import loads airports from CSV data and saves them in the storage.
+// The first CSV row is a header naming the columns: code, icao, name, city, country, latitude, longitude and timezone.
+// It returns the number of the airports imported.
+func (s service) Import(ctx context.Context, r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return 0, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"code", "icao", "name", "city", "country", "latitude", "longitude", "timezone"} {
+		if _, ok := columns[name]; !ok {
+			return 0, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	count := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		airport := Airport{entity.Airport{
+			Code:     record[columns["code"]],
+			ICAO:     record[columns["icao"]],
+			Name:     record[columns["name"]],
+			City:     record[columns["city"]],
+			Country:  record[columns["country"]],
+			Timezone: record[columns["timezone"]],
+		}}
+		if airport.Latitude, err = strconv.ParseFloat(record[columns["latitude"]], 64); err != nil {
+			return count, fmt.Errorf("airport %v: invalid latitude: %v", airport.Code, err)
+		}
+		if airport.Longitude, err = strconv.ParseFloat(record[columns["longitude"]], 64); err != nil {
+			return count, fmt.Errorf("airport %v: invalid longitude: %v", airport.Code, err)
+		}
+		if err := airport.Validate(); err != nil {
+			return count, fmt.Errorf("airport %v: %v", airport.Code, err)
+		}
+		if err := s.repo.Save(ctx, airport.Airport); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
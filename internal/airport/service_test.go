@@ -0,0 +1,166 @@
+package airport
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAirport_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     Airport
+		wantError bool
+	}{
+		{"success", Airport{entity.Airport{
+			Code:      "ARN",
+			ICAO:      "ESSA",
+			Name:      "Stockholm Arlanda Airport",
+			City:      "Stockholm",
+			Country:   "Sweden",
+			Latitude:  59.651901,
+			Longitude: 17.9186,
+			Timezone:  "Europe/Stockholm",
+		}}, false},
+		{"required", Airport{entity.Airport{Code: ""}}, true},
+		{"invalid timezone", Airport{entity.Airport{
+			Code:     "ARN",
+			ICAO:     "ESSA",
+			Name:     "Stockholm Arlanda Airport",
+			City:     "Stockholm",
+			Country:  "Sweden",
+			Timezone: "Europe/Nowhere",
+		}}, true},
+		{"invalid latitude", Airport{entity.Airport{
+			Code:     "ARN",
+			ICAO:     "ESSA",
+			Name:     "Stockholm Arlanda Airport",
+			City:     "Stockholm",
+			Country:  "Sweden",
+			Latitude: 120,
+			Timezone: "Europe/Stockholm",
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_Import(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, logger)
+	ctx := context.Background()
+
+	count, err := s.Import(ctx, strings.NewReader(`code,icao,name,city,country,latitude,longitude,timezone
+ARN,ESSA,Stockholm Arlanda Airport,Stockholm,Sweden,59.651901,17.9186,Europe/Stockholm
+MMX,ESMS,Malmö Sturup Airport,Malmö,Sweden,55.536305,13.376198,Europe/Stockholm
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	// re-importing updates the existing airports
+	count, err = s.Import(ctx, strings.NewReader(`code,icao,name,city,country,latitude,longitude,timezone
+ARN,ESSA,Arlanda,Stockholm,Sweden,59.651901,17.9186,Europe/Stockholm
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	total, _ := s.Count(ctx, "")
+	assert.Equal(t, 2, total)
+
+	airport, err := s.Get(ctx, "arn")
+	assert.Nil(t, err)
+	assert.Equal(t, "Arlanda", airport.Name)
+	loc, err := airport.Location()
+	assert.Nil(t, err)
+	assert.Equal(t, "Europe/Stockholm", loc.String())
+
+	// missing column
+	_, err = s.Import(ctx, strings.NewReader("code,icao,name\nARN,ESSA,Arlanda\n"))
+	assert.NotNil(t, err)
+
+	// invalid record
+	_, err = s.Import(ctx, strings.NewReader(`code,icao,name,city,country,latitude,longitude,timezone
+ARN,ESSA,Arlanda,Stockholm,Sweden,north,17.9186,Europe/Stockholm
+`))
+	assert.NotNil(t, err)
+}
+
+func TestValidateCodes(t *testing.T) {
+	errs, err := ValidateCodes(context.Background(), MockService{}, map[string]string{"departure": "ARN", "destination": "XXX"})
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(errs)) {
+		assert.Equal(t, "must be a known airport code", errs["destination"].Error())
+	}
+}
+
+func Test_service_Query(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewService(&mockRepository{items: []entity.Airport{
+		{Code: "ARN", ICAO: "ESSA", City: "Stockholm"},
+		{Code: "MMX", ICAO: "ESMS", City: "Malmö"},
+		{Code: "MSQ", ICAO: "UMMS", City: "Minsk"},
+	}}, logger)
+	ctx := context.Background()
+
+	airports, err := s.Query(ctx, "m", 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(airports))
+	count, _ := s.Count(ctx, "es")
+	assert.Equal(t, 2, count)
+
+	_, err = s.Get(ctx, "XXX")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+type mockRepository struct {
+	items []entity.Airport
+}
+
+func (m mockRepository) Get(ctx context.Context, code string) (entity.Airport, error) {
+	for _, item := range m.items {
+		if item.Code == code {
+			return item, nil
+		}
+	}
+	return entity.Airport{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context, search string) (int, error) {
+	items, _ := m.Query(ctx, search, 0, len(m.items))
+	return len(items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, search string, offset, limit int) ([]entity.Airport, error) {
+	var result []entity.Airport
+	prefix := strings.ToLower(search)
+	for _, item := range m.items {
+		if strings.HasPrefix(strings.ToLower(item.Code), prefix) ||
+			strings.HasPrefix(strings.ToLower(item.ICAO), prefix) ||
+			strings.HasPrefix(strings.ToLower(item.City), prefix) {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockRepository) Save(ctx context.Context, airport entity.Airport) error {
+	for i, item := range m.items {
+		if item.Code == airport.Code {
+			m.items[i] = airport
+			return nil
+		}
+	}
+	m.items = append(m.items, airport)
+	sort.Slice(m.items, func(i, j int) bool { return m.items[i].Code < m.items[j].Code })
+	return nil
+}
@@ -1,15 +1,37 @@
 package auth
 
 import (
+	"net/http"
+	"time"
+
 	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
 	"github.com/nvnoskov/dynamo-backend/internal/errors"
 	"github.com/nvnoskov/dynamo-backend/pkg/log"
 )
 
 // RegisterHandlers registers handlers for different HTTP requests.
-func RegisterHandlers(rg *routing.RouteGroup, service Service, logger log.Logger) {
+func RegisterHandlers(rg *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
 	rg.Post("/login", login(service, logger))
 	rg.Post("/register", register(service, logger))
+	rg.Post("/token/refresh", refresh(service, logger))
+	rg.Post("/logout", authHandler, logout(service))
+	rg.Post("/password/forgot", forgotPassword(service, logger))
+	rg.Post("/password/reset", resetPassword(service, logger))
+	rg.Get("/verify-email", verifyEmail(service))
+	rg.Post("/verify-email/resend", resendVerification(service, logger))
+	rg.Put("/users/<id>/role", authHandler, RequireRole(entity.RoleAdmin), setRole(service, logger))
+}
+
+// RegisterKeyHandlers registers the handler that publishes the public keys of the key set as a JWK set,
+// so that other services can verify the JWT tokens without holding any secret.
+func RegisterKeyHandlers(router *routing.Router, keys *KeySet) {
+	router.Get("/.well-known/jwks.json", func(c *routing.Context) error {
+		c.Response.Header().Set("Cache-Control", "public, max-age=300")
+		return c.Write(struct {
+			Keys []JWK `json:"keys"`
+		}{keys.JWKS(time.Now())})
+	})
 }
 
 // login returns a handler that handles user login request.
@@ -25,17 +47,116 @@ func login(service Service, logger log.Logger) routing.Handler {
 			return errors.BadRequest("")
 		}
 
-		token, err := service.Login(c.Request.Context(), req.Username, req.Password)
+		tokens, err := service.Login(c.Request.Context(), req.Username, req.Password)
 		if err != nil {
 			return err
 		}
-		return c.Write(struct {
-			Token string `json:"token"`
-		}{token})
+		return c.Write(tokens)
 	}
 }
 
-// login returns a handler that handles user login request.
+// refresh returns a handler that exchanges a refresh token for new tokens.
+func refresh(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		tokens, err := service.Refresh(c.Request.Context(), req.RefreshToken)
+		if err != nil {
+			return err
+		}
+		return c.Write(tokens)
+	}
+}
+
+// logout returns a handler that revokes the tokens of the current login session.
+func logout(service Service) routing.Handler {
+	return func(c *routing.Context) error {
+		if err := service.Logout(c.Request.Context()); err != nil {
+			return err
+		}
+		c.Response.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+// forgotPassword returns a handler that mails a password reset token to a user.
+// It responds the same whether the email address is known or not.
+func forgotPassword(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req struct {
+			Email string `json:"email"`
+		}
+
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		if err := service.ForgotPassword(c.Request.Context(), req.Email); err != nil {
+			return err
+		}
+		c.Response.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+// resetPassword returns a handler that resets the password of a user with a password reset token.
+func resetPassword(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req ResetPasswordRequest
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		if err := service.ResetPassword(c.Request.Context(), req); err != nil {
+			return err
+		}
+		c.Response.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+// verifyEmail returns a handler that verifies the email address of a user with the token given as a query parameter.
+func verifyEmail(service Service) routing.Handler {
+	return func(c *routing.Context) error {
+		if err := service.VerifyEmail(c.Request.Context(), c.Query("token")); err != nil {
+			return err
+		}
+		c.Response.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+// resendVerification returns a handler that mails a new email verification token to a user.
+// It responds the same whether the email address is known or not.
+func resendVerification(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req struct {
+			Email string `json:"email"`
+		}
+
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		if err := service.ResendVerification(c.Request.Context(), req.Email); err != nil {
+			return err
+		}
+		c.Response.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+// register returns a handler that handles user registration request.
 func register(service Service, logger log.Logger) routing.Handler {
 
 	return func(c *routing.Context) error {
@@ -51,9 +172,31 @@ func register(service Service, logger log.Logger) routing.Handler {
 			return err
 		}
 		return c.Write(struct {
-			ID    string `json:"id"`
-			Name  string `json:"name"`
-			Email string `json:"email"`
-		}{user.ID, user.Name, user.Email})
+			ID            string `json:"id"`
+			Name          string `json:"name"`
+			Email         string `json:"email"`
+			EmailVerified bool   `json:"email_verified"`
+		}{user.ID, user.Name, user.Email, user.EmailVerified()})
+	}
+}
+
+// setRole returns a handler that changes the role of a user.
+func setRole(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req SetRoleRequest
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		user, err := service.SetRole(c.Request.Context(), c.Param("id"), req)
+		if err != nil {
+			return err
+		}
+		return c.Write(struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			Role string `json:"role"`
+		}{user.ID, user.Name, user.Role})
 	}
 }
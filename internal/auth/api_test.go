@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	RegisterKeyHandlers(router, mockKeys)
+	repo := &mockRepository{items: []entity.User{{ID: "100", Name: "demo", Email: "demo@demo.com"}}}
+	RegisterHandlers(router.Group(""), service{repo, mockTransactional, mockKeys, &mockMailer{}, time.Hour, time.Hour, time.Hour, time.Hour, false, "", logger}, MockAuthHandler, logger)
+
+	admin := MockRoleAuthHeader(entity.RoleAdmin)
+
+	tests := []test.APITestCase{
+		{"jwks", "GET", "/.well-known/jwks.json", "", nil, http.StatusOK, `{"keys":[{"kty":"OKP","kid":"k1","use":"sig","alg":"EdDSA","crv":"Ed25519",*`},
+		{"forgot password", "POST", "/password/forgot", `{"email":"demo@demo.com"}`, nil, http.StatusNoContent, ""},
+		{"forgot password unknown", "POST", "/password/forgot", `{"email":"none@demo.com"}`, nil, http.StatusNoContent, ""},
+		{"forgot password input error", "POST", "/password/forgot", `"email"}`, nil, http.StatusBadRequest, ""},
+		{"reset password invalid token", "POST", "/password/reset", `{"token":"bad","password":"new"}`, nil, http.StatusBadRequest, `*"field":"token"*`},
+		{"verify email invalid token", "GET", "/verify-email?token=bad", "", nil, http.StatusBadRequest, `*"field":"token"*`},
+		{"verify email no token", "GET", "/verify-email", "", nil, http.StatusBadRequest, `*"field":"token"*`},
+		{"resend verification", "POST", "/verify-email/resend", `{"email":"demo@demo.com"}`, nil, http.StatusNoContent, ""},
+		{"resend verification unknown", "POST", "/verify-email/resend", `{"email":"none@demo.com"}`, nil, http.StatusNoContent, ""},
+		{"resend verification input error", "POST", "/verify-email/resend", `"email"}`, nil, http.StatusBadRequest, ""},
+		{"register invalid email", "POST", "/register", `{"username":"new","password":"pass","email":"new"}`, nil, http.StatusBadRequest, `*"field":"email"*`},
+		{"register", "POST", "/register", `{"username":"new","password":"pass","email":"new@demo.com"}`, nil, http.StatusOK, `*"email_verified":false}`},
+		{"reset password input error", "POST", "/password/reset", `"token"}`, nil, http.StatusBadRequest, ""},
+		{"set role unauthorized", "PUT", "/users/100/role", `{"role":"operator"}`, nil, http.StatusUnauthorized, ""},
+		{"set role forbidden", "PUT", "/users/100/role", `{"role":"operator"}`, MockAuthHeader(), http.StatusForbidden, ""},
+		{"set role invalid", "PUT", "/users/100/role", `{"role":"pilot"}`, admin, http.StatusBadRequest, `*"field":"role"*`},
+		{"set role unknown", "PUT", "/users/none/role", `{"role":"operator"}`, admin, http.StatusNotFound, ""},
+		{"set role input error", "PUT", "/users/100/role", `"role"}`, admin, http.StatusBadRequest, ""},
+		{"set role", "PUT", "/users/100/role", `{"role":"operator"}`, admin, http.StatusOK, `{"id":"100","name":"demo","role":"operator"}`},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
@@ -0,0 +1,11 @@
+package auth
+
+import (
+	"github.com/nvnoskov/dynamo-backend/internal/errors"
+)
+
+// errUnauthorized is returned when the credentials or the tokens of a user aren't accepted.
+var errUnauthorized = errors.Unauthorized("")
+
+// errNotVerified is returned when a user who hasn't verified the email address logs in while the verification is required.
+var errNotVerified = errors.Forbidden("The email address has not been verified yet.")
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SigningKey represents a private key that signs JWT tokens from the time it becomes active.
+type SigningKey struct {
+	ID         string            // key ID, the "kid" header of the tokens signed with the key
+	Method     jwt.SigningMethod // RS256 for RSA keys and EdDSA for Ed25519 keys
+	PrivateKey crypto.Signer
+	ActiveFrom time.Time // time the key starts signing tokens from
+}
+
+// LoadSigningKey reads an RSA or Ed25519 private key from the PEM file.
+// RSA keys may be in PKCS #1 or PKCS #8 form, Ed25519 keys in PKCS #8 form.
+func LoadSigningKey(id, file string, activeFrom time.Time) (SigningKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	return ParseSigningKey(id, data, activeFrom)
+}
+
+// ParseSigningKey parses an RSA or Ed25519 private key in PEM encoding.
+func ParseSigningKey(id string, data []byte, activeFrom time.Time) (SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("key %v: no PEM data found", id)
+	}
+	var key interface{}
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("key %v: %v", id, err)
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return SigningKey{id, jwt.SigningMethodRS256, k, activeFrom}, nil
+	case ed25519.PrivateKey:
+		return SigningKey{id, SigningMethodEdDSA, k, activeFrom}, nil
+	}
+	return SigningKey{}, fmt.Errorf("key %v: unsupported key type %T", id, key)
+}
+
+// KeySet holds the keys that sign and verify JWT tokens.
+// The keys take turns by the time they become active: the latest active key signs the new tokens,
+// and a key that has been replaced keeps verifying until the tokens it signed have expired.
+type KeySet struct {
+	keys     []SigningKey
+	tokenTTL time.Duration
+}
+
+// NewKeySet creates a set of the given keys. The tokens signed with the keys expire after tokenTTL.
+func NewKeySet(keys []SigningKey, tokenTTL time.Duration) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys")
+	}
+	sorted := make([]SigningKey, len(keys))
+	copy(sorted, keys)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ActiveFrom.Before(sorted[j].ActiveFrom) })
+	ids := map[string]bool{}
+	for _, key := range sorted {
+		if key.ID == "" || ids[key.ID] {
+			return nil, fmt.Errorf("signing key IDs must be unique and not empty: %q", key.ID)
+		}
+		ids[key.ID] = true
+	}
+	return &KeySet{sorted, tokenTTL}, nil
+}
+
+// SigningKey returns the key that signs the tokens issued at the given time.
+// False is returned if none of the keys is active yet.
+func (ks *KeySet) SigningKey(now time.Time) (SigningKey, bool) {
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		if !ks.keys[i].ActiveFrom.After(now) {
+			return ks.keys[i], true
+		}
+	}
+	return SigningKey{}, false
+}
+
+// VerificationKey returns the key with the specified ID if it may have signed a token that is valid at the given time.
+func (ks *KeySet) VerificationKey(id string, now time.Time) (SigningKey, bool) {
+	for i, key := range ks.keys {
+		if key.ID == id {
+			return key, !key.ActiveFrom.After(now) && !ks.retired(i, now)
+		}
+	}
+	return SigningKey{}, false
+}
+
+// retired reports whether the tokens signed with the key at index i have all expired at the given time.
+func (ks *KeySet) retired(i int, now time.Time) bool {
+	if i == len(ks.keys)-1 {
+		return false
+	}
+	return !now.Before(ks.keys[i+1].ActiveFrom.Add(ks.tokenTTL))
+}
+
+// JWK represents a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"` // curve of an OKP key
+	X         string `json:"x,omitempty"`   // public key of an OKP key
+	N         string `json:"n,omitempty"`   // modulus of an RSA key
+	E         string `json:"e,omitempty"`   // exponent of an RSA key
+}
+
+// JWKS returns the public keys that verify the tokens at the given time or will do so later,
+// so that the verifiers know a key before it signs any token.
+func (ks *KeySet) JWKS(now time.Time) []JWK {
+	result := []JWK{}
+	for i, key := range ks.keys {
+		if ks.retired(i, now) {
+			continue
+		}
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+		switch k := key.PrivateKey.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(k)
+		}
+		result = append(result, jwk)
+	}
+	return result
+}
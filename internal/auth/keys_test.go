@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockKeys is the key set of the tests, with an Ed25519 key active since any time.
+var mockKeys = func() *KeySet {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	keys, _ := NewKeySet([]SigningKey{{ID: "k1", Method: SigningMethodEdDSA, PrivateKey: key}}, time.Hour)
+	return keys
+}()
+
+func TestParseSigningKey(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(edKey)
+
+	key, err := ParseSigningKey("rsa", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), time.Time{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "RS256", key.Method.Alg())
+		assert.Equal(t, "rsa", key.ID)
+	}
+	key, err = ParseSigningKey("ed", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), time.Time{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "EdDSA", key.Method.Alg())
+	}
+	_, err = ParseSigningKey("bad", []byte("not a key"), time.Time{})
+	assert.NotNil(t, err)
+	_, err = ParseSigningKey("bad", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("bad")}), time.Time{})
+	assert.NotNil(t, err)
+
+	// loading from a file
+	dir, _ := ioutil.TempDir("", "keys")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "ed.pem")
+	assert.Nil(t, ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0600))
+	key, err = LoadSigningKey("ed", file, time.Time{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, edKey, key.PrivateKey)
+	}
+	_, err = LoadSigningKey("ed", filepath.Join(dir, "none.pem"), time.Time{})
+	assert.NotNil(t, err)
+}
+
+func TestKeySet(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rotation := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := NewKeySet(nil, time.Hour)
+	assert.NotNil(t, err)
+	_, err = NewKeySet([]SigningKey{{ID: "k1"}, {ID: "k1"}}, time.Hour)
+	assert.NotNil(t, err)
+
+	keys, err := NewKeySet([]SigningKey{
+		{ID: "new", Method: SigningMethodEdDSA, PrivateKey: edKey, ActiveFrom: rotation},
+		{ID: "old", Method: jwt.SigningMethodRS256, PrivateKey: rsaKey},
+	}, time.Hour)
+	assert.Nil(t, err)
+
+	// the latest active key signs
+	key, ok := keys.SigningKey(rotation.Add(-time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, "old", key.ID)
+	key, _ = keys.SigningKey(rotation)
+	assert.Equal(t, "new", key.ID)
+
+	// a replaced key verifies until the tokens it signed have expired
+	_, ok = keys.VerificationKey("new", rotation.Add(-time.Minute))
+	assert.False(t, ok)
+	_, ok = keys.VerificationKey("old", rotation.Add(59*time.Minute))
+	assert.True(t, ok)
+	_, ok = keys.VerificationKey("old", rotation.Add(time.Hour))
+	assert.False(t, ok)
+	_, ok = keys.VerificationKey("new", rotation.Add(time.Hour))
+	assert.True(t, ok)
+	_, ok = keys.VerificationKey("none", rotation)
+	assert.False(t, ok)
+
+	// the upcoming keys are published before they sign, and the retired ones no longer
+	jwks := keys.JWKS(rotation.Add(-time.Minute))
+	if assert.Equal(t, 2, len(jwks)) {
+		assert.Equal(t, JWK{KeyType: "RSA", KeyID: "old", Use: "sig", Algorithm: "RS256", N: jwks[0].N, E: "AQAB"}, jwks[0])
+		assert.Equal(t, "OKP", jwks[1].KeyType)
+		assert.Equal(t, "Ed25519", jwks[1].Curve)
+		assert.Equal(t, "EdDSA", jwks[1].Algorithm)
+		assert.NotEmpty(t, jwks[1].X)
+	}
+	jwks = keys.JWKS(rotation.Add(time.Hour))
+	if assert.Equal(t, 1, len(jwks)) {
+		assert.Equal(t, "new", jwks[0].KeyID)
+	}
+}
+
+func TestSigningMethodEdDSA(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	token, err := jwt.NewWithClaims(SigningMethodEdDSA, jwt.MapClaims{"id": "100"}).SignedString(private)
+	assert.Nil(t, err)
+	parsed, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return public, nil })
+	if assert.Nil(t, err) {
+		assert.Equal(t, "EdDSA", parsed.Header["alg"])
+		assert.True(t, parsed.Valid)
+	}
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	_, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return other, nil })
+	assert.NotNil(t, err)
+	_, err = jwt.NewWithClaims(SigningMethodEdDSA, jwt.MapClaims{}).SignedString([]byte("secret"))
+	assert.Equal(t, jwt.ErrInvalidKeyType, err)
+}
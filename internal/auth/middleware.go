@@ -2,40 +2,106 @@ package auth
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
-	"github.com/go-ozzo/ozzo-routing/v2/auth"
 	"github.com/nvnoskov/dynamo-backend/internal/entity"
 	"github.com/nvnoskov/dynamo-backend/internal/errors"
 )
 
+// RevocationList reports whether JWT tokens have been revoked before their expiration.
+type RevocationList interface {
+	// IsRevoked reports whether the JWT token with the specified ID has been revoked.
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+}
+
 // Handler returns a JWT-based authentication middleware.
-func Handler(verificationKey string) routing.Handler {
-	return auth.JWT(verificationKey, auth.JWTOptions{TokenHandler: handleToken})
+// The tokens must be signed with a key of the key set that verifies at the time of the request, as identified by
+// the "kid" header, and the tokens without an ID ("jti") or with an ID in the revocation list are rejected.
+func Handler(keys *KeySet, revocations RevocationList) routing.Handler {
+	return func(c *routing.Context) error {
+		header := c.Request.Header.Get("Authorization")
+		if strings.HasPrefix(header, "Bearer ") {
+			token, err := jwt.Parse(header[7:], func(token *jwt.Token) (interface{}, error) {
+				kid, _ := token.Header["kid"].(string)
+				key, ok := keys.VerificationKey(kid, time.Now())
+				if !ok || key.Method.Alg() != token.Method.Alg() {
+					return nil, fmt.Errorf("unknown signing key %q", kid)
+				}
+				return key.PrivateKey.Public(), nil
+			})
+			if err == nil && token.Valid {
+				if err = handleVerifiedToken(c, token, revocations); err == nil {
+					return nil
+				}
+			}
+		}
+		c.Response.Header().Set("WWW-Authenticate", `Bearer realm="API"`)
+		return errors.Unauthorized("")
+	}
+}
+
+// handleVerifiedToken rejects the token if it has no ID or has been revoked,
+// and stores the token ID and the user identity in the request context otherwise.
+func handleVerifiedToken(c *routing.Context, token *jwt.Token, revocations RevocationList) error {
+	id, _ := token.Claims.(jwt.MapClaims)["jti"].(string)
+	if id == "" {
+		return errors.Unauthorized("")
+	}
+	revoked, err := revocations.IsRevoked(c.Request.Context(), id)
+	if err != nil || revoked {
+		return errors.Unauthorized("")
+	}
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), tokenIDKey, id))
+	return handleToken(c, token)
 }
 
 // handleToken stores the user identity in the request context so that it can be accessed elsewhere.
 func handleToken(c *routing.Context, token *jwt.Token) error {
-	ctx := WithUser(
-		c.Request.Context(),
-		token.Claims.(jwt.MapClaims)["id"].(string),
-		token.Claims.(jwt.MapClaims)["name"].(string),
-	)
+	role, _ := token.Claims.(jwt.MapClaims)["role"].(string)
+	ctx := withIdentity(c.Request.Context(), entity.User{
+		ID:   token.Claims.(jwt.MapClaims)["id"].(string),
+		Name: token.Claims.(jwt.MapClaims)["name"].(string),
+		Role: role,
+	})
 	c.Request = c.Request.WithContext(ctx)
 	return nil
 }
 
+// RequireRole returns a middleware that lets only the users with one of the given roles through.
+// It must be used after the authentication middleware, and returns a forbidden error otherwise.
+func RequireRole(roles ...string) routing.Handler {
+	return func(c *routing.Context) error {
+		if user := CurrentUser(c.Request.Context()); user != nil {
+			for _, role := range roles {
+				if user.GetRole() == role {
+					return nil
+				}
+			}
+		}
+		return errors.Forbidden("")
+	}
+}
+
 type contextKey int
 
 const (
 	userKey contextKey = iota
+	tokenIDKey
 )
 
 // WithUser returns a context that contains the user identity from the given JWT.
 func WithUser(ctx context.Context, id, name string) context.Context {
-	return context.WithValue(ctx, userKey, entity.User{ID: id, Name: name})
+	return withIdentity(ctx, entity.User{ID: id, Name: name})
+}
+
+// withIdentity returns a context that contains the given user identity.
+func withIdentity(ctx context.Context, user entity.User) context.Context {
+	return context.WithValue(ctx, userKey, user)
 }
 
 // CurrentUser returns the user identity from the given context.
@@ -47,15 +113,28 @@ func CurrentUser(ctx context.Context) Identity {
 	return nil
 }
 
+// currentTokenID returns the ID of the JWT token from the given context.
+// An empty string is returned if no token ID is found in the context.
+func currentTokenID(ctx context.Context) string {
+	id, _ := ctx.Value(tokenIDKey).(string)
+	return id
+}
+
 // MockAuthHandler creates a mock authentication middleware for testing purpose.
 // If the request contains an Authorization header whose value is "TEST", then
-// it considers the user is authenticated as "Tester" whose ID is "100".
+// it considers the user is authenticated as "Tester" whose ID is "100" and whose role is customer.
+// If the value is "TEST" followed by a space and a role, the user has that role instead.
 // It fails the authentication otherwise.
 func MockAuthHandler(c *routing.Context) error {
-	if c.Request.Header.Get("Authorization") != "TEST" {
+	header := c.Request.Header.Get("Authorization")
+	role := entity.RoleCustomer
+	if strings.HasPrefix(header, "TEST ") {
+		header, role = "TEST", strings.TrimPrefix(header, "TEST ")
+	}
+	if header != "TEST" {
 		return errors.Unauthorized("")
 	}
-	ctx := WithUser(c.Request.Context(), "100", "Tester")
+	ctx := withIdentity(c.Request.Context(), entity.User{ID: "100", Name: "Tester", Role: role})
 	c.Request = c.Request.WithContext(ctx)
 	return nil
 }
@@ -66,3 +145,11 @@ func MockAuthHeader() http.Header {
 	header.Add("Authorization", "TEST")
 	return header
 }
+
+// MockRoleAuthHeader returns an HTTP header that passes the authentication check by MockAuthHandler
+// as a user with the given role.
+func MockRoleAuthHeader(role string) http.Header {
+	header := http.Header{}
+	header.Add("Authorization", "TEST "+role)
+	return header
+}
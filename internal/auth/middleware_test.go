@@ -4,8 +4,11 @@ import (
 	"context"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/errors"
 	"github.com/nvnoskov/dynamo-backend/internal/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -22,7 +25,50 @@ func TestCurrentUser(t *testing.T) {
 }
 
 func TestHandler(t *testing.T) {
-	assert.NotNil(t, Handler("test"))
+	handler := Handler(mockKeys, mockRevocationList{"revoked": true})
+	key, _ := mockKeys.SigningKey(time.Now())
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(key.Method, claims)
+		token.Header["kid"] = key.ID
+		signed, _ := token.SignedString(key.PrivateKey)
+		return signed
+	}
+	hmac, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"id": "100", "name": "test", "jti": "t1"}).SignedString([]byte("test"))
+	unknownKey := jwt.NewWithClaims(key.Method, jwt.MapClaims{"id": "100", "name": "test", "jti": "t1"})
+	unknownKey.Header["kid"] = "k0"
+	unknown, _ := unknownKey.SignedString(key.PrivateKey)
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", sign(jwt.MapClaims{"id": "100", "name": "test", "jti": "t1"}), false},
+		{"revoked", sign(jwt.MapClaims{"id": "100", "name": "test", "jti": "revoked"}), true},
+		{"no ID", sign(jwt.MapClaims{"id": "100", "name": "test"}), true},
+		{"expired", sign(jwt.MapClaims{"id": "100", "name": "test", "jti": "t1", "exp": time.Now().Add(-time.Minute).Unix()}), true},
+		{"bad signature", sign(jwt.MapClaims{"id": "100", "name": "test", "jti": "t1"}) + "x", true},
+		{"unknown key", unknown, true},
+		{"shared secret", hmac, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "http://example.com", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			ctx, _ := test.MockRoutingContext(req)
+			err := handler(ctx)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, "100", CurrentUser(ctx.Request.Context()).GetID())
+				assert.Equal(t, "t1", currentTokenID(ctx.Request.Context()))
+			}
+		})
+	}
+}
+
+type mockRevocationList map[string]bool
+
+func (m mockRevocationList) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	return m[tokenID], nil
 }
 
 func Test_handleToken(t *testing.T) {
@@ -34,6 +80,7 @@ func Test_handleToken(t *testing.T) {
 		Claims: jwt.MapClaims{
 			"id":   "100",
 			"name": "test",
+			"role": "operator",
 		},
 	})
 	assert.Nil(t, err)
@@ -41,6 +88,19 @@ func Test_handleToken(t *testing.T) {
 	if assert.NotNil(t, identity) {
 		assert.Equal(t, "100", identity.GetID())
 		assert.Equal(t, "test", identity.GetName())
+		assert.Equal(t, "operator", identity.GetRole())
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	handler := RequireRole(entity.RoleAdmin, entity.RoleOperator)
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	ctx, _ := test.MockRoutingContext(req)
+	assert.Equal(t, errors.Forbidden(""), handler(ctx))
+
+	for role, allowed := range map[string]bool{entity.RoleAdmin: true, entity.RoleOperator: true, entity.RoleCustomer: false, "": false} {
+		ctx.Request = req.WithContext(withIdentity(req.Context(), entity.User{ID: "100", Name: "test", Role: role}))
+		assert.Equal(t, allowed, handler(ctx) == nil, role)
 	}
 }
 
@@ -52,4 +112,9 @@ func TestMocks(t *testing.T) {
 	ctx, _ = test.MockRoutingContext(req)
 	assert.Nil(t, MockAuthHandler(ctx))
 	assert.NotNil(t, CurrentUser(ctx.Request.Context()))
+	assert.Equal(t, entity.RoleCustomer, CurrentUser(ctx.Request.Context()).GetRole())
+	req.Header = MockRoleAuthHeader(entity.RoleAdmin)
+	ctx, _ = test.MockRoutingContext(req)
+	assert.Nil(t, MockAuthHandler(ctx))
+	assert.Equal(t, entity.RoleAdmin, CurrentUser(ctx.Request.Context()).GetRole())
 }
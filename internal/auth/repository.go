@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"time"
 
 	dbx "github.com/go-ozzo/ozzo-dbx"
 	"github.com/nvnoskov/dynamo-backend/internal/entity"
@@ -9,13 +10,51 @@ import (
 	"github.com/nvnoskov/dynamo-backend/pkg/log"
 )
 
-// Repository encapsulates the logic to access users from the data source.
+// Repository encapsulates the logic to access users and their refresh tokens from the data source.
 type Repository interface {
 	// Get returns the user with the specified user ID.
 	Get(ctx context.Context, id string) (entity.User, error)
 	GetByUsername(ctx context.Context, username string) (entity.User, error)
+	// GetByEmail returns the user with the given email address.
+	GetByEmail(ctx context.Context, email string) (entity.User, error)
 	// Create saves a new user in the storage.
 	Create(ctx context.Context, user entity.User) error
+	// UpdatePassword sets the password hash of the user with the specified ID.
+	UpdatePassword(ctx context.Context, id, password string) error
+	// UpdateRole sets the role of the user with the specified ID.
+	UpdateRole(ctx context.Context, id, role string) error
+	// CountByRole returns the number of users with the given role.
+	CountByRole(ctx context.Context, role string) (int, error)
+	// GetToken returns the refresh token with the specified token ID.
+	GetToken(ctx context.Context, id string) (entity.RefreshToken, error)
+	// GetTokenByHash returns the refresh token with the given hash.
+	GetTokenByHash(ctx context.Context, hash string) (entity.RefreshToken, error)
+	// CreateToken saves a new refresh token in the storage.
+	CreateToken(ctx context.Context, token entity.RefreshToken) error
+	// UseToken marks the refresh token with the specified ID as used unless it is used or revoked already.
+	// It reports whether the token was marked, so that a token can't be used twice by concurrent requests.
+	UseToken(ctx context.Context, id string, now time.Time) (bool, error)
+	// RevokeFamily revokes the refresh tokens of the family that are not revoked yet.
+	RevokeFamily(ctx context.Context, familyID string, now time.Time) error
+	// RevokeUserTokens revokes the refresh tokens of the user that are not revoked yet.
+	RevokeUserTokens(ctx context.Context, userID string, now time.Time) error
+	// GetPasswordReset returns the password reset with the given token hash.
+	GetPasswordReset(ctx context.Context, hash string) (entity.PasswordReset, error)
+	// CreatePasswordReset saves a new password reset in the storage.
+	CreatePasswordReset(ctx context.Context, reset entity.PasswordReset) error
+	// UsePasswordReset marks the password reset with the specified ID as used unless it is used already.
+	// It reports whether the password reset was marked.
+	UsePasswordReset(ctx context.Context, id string, now time.Time) (bool, error)
+	// VerifyEmail sets the time the user with the specified ID verified the email address.
+	VerifyEmail(ctx context.Context, id string, now time.Time) error
+	// LockEmailVerification returns the email verification with the given token hash
+	// and locks it until the end of the transaction.
+	LockEmailVerification(ctx context.Context, hash string) (entity.EmailVerification, error)
+	// CreateEmailVerification saves a new email verification in the storage.
+	CreateEmailVerification(ctx context.Context, verification entity.EmailVerification) error
+	// UseEmailVerification marks the email verification with the specified ID as used unless it is used already.
+	// It reports whether the email verification was marked.
+	UseEmailVerification(ctx context.Context, id string, now time.Time) (bool, error)
 }
 
 // repository persists users in database
@@ -44,8 +83,142 @@ func (r repository) GetByUsername(ctx context.Context, username string) (entity.
 	return user, err
 }
 
+// GetByEmail reads the user with the given email address from the database.
+func (r repository) GetByEmail(ctx context.Context, email string) (entity.User, error) {
+	var user entity.User
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"email": email}).One(&user)
+	return user, err
+}
+
+// UpdatePassword saves the password hash of the user in the database.
+func (r repository) UpdatePassword(ctx context.Context, id, password string) error {
+	_, err := r.db.With(ctx).Update("user", dbx.Params{"password": password}, dbx.HashExp{"id": id}).Execute()
+	return err
+}
+
+// UpdateRole saves the role of the user in the database.
+func (r repository) UpdateRole(ctx context.Context, id, role string) error {
+	_, err := r.db.With(ctx).Update("user", dbx.Params{"role": role}, dbx.HashExp{"id": id}).Execute()
+	return err
+}
+
+// CountByRole returns the number of users with the given role in the database.
+func (r repository) CountByRole(ctx context.Context, role string) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("user").Where(dbx.HashExp{"role": role}).Row(&count)
+	return count, err
+}
+
 // Create saves a new user record in the database.
 // It returns the ID of the newly inserted user record.
 func (r repository) Create(ctx context.Context, user entity.User) error {
 	return r.db.With(ctx).Model(&user).Insert()
 }
+
+// GetToken reads the refresh token with the specified ID from the database.
+func (r repository) GetToken(ctx context.Context, id string) (entity.RefreshToken, error) {
+	var token entity.RefreshToken
+	err := r.db.With(ctx).Select().Model(id, &token)
+	return token, err
+}
+
+// GetTokenByHash reads the refresh token with the given hash from the database.
+func (r repository) GetTokenByHash(ctx context.Context, hash string) (entity.RefreshToken, error) {
+	var token entity.RefreshToken
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"token_hash": hash}).One(&token)
+	return token, err
+}
+
+// CreateToken saves a new refresh token record in the database.
+func (r repository) CreateToken(ctx context.Context, token entity.RefreshToken) error {
+	return r.db.With(ctx).Model(&token).Insert()
+}
+
+// UseToken sets the time the refresh token was used in the database if it is neither used nor revoked.
+func (r repository) UseToken(ctx context.Context, id string, now time.Time) (bool, error) {
+	result, err := r.db.With(ctx).Update("refresh_token",
+		dbx.Params{"used_at": now},
+		dbx.And(dbx.HashExp{"id": id}, dbx.NewExp("used_at IS NULL AND revoked_at IS NULL")),
+	).Execute()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// RevokeFamily sets the time the refresh tokens of the family were revoked in the database.
+func (r repository) RevokeFamily(ctx context.Context, familyID string, now time.Time) error {
+	_, err := r.db.With(ctx).Update("refresh_token",
+		dbx.Params{"revoked_at": now},
+		dbx.And(dbx.HashExp{"family_id": familyID}, dbx.NewExp("revoked_at IS NULL")),
+	).Execute()
+	return err
+}
+
+// RevokeUserTokens sets the time the refresh tokens of the user were revoked in the database.
+func (r repository) RevokeUserTokens(ctx context.Context, userID string, now time.Time) error {
+	_, err := r.db.With(ctx).Update("refresh_token",
+		dbx.Params{"revoked_at": now},
+		dbx.And(dbx.HashExp{"user_id": userID}, dbx.NewExp("revoked_at IS NULL")),
+	).Execute()
+	return err
+}
+
+// GetPasswordReset reads the password reset with the given token hash from the database.
+func (r repository) GetPasswordReset(ctx context.Context, hash string) (entity.PasswordReset, error) {
+	var reset entity.PasswordReset
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"token_hash": hash}).One(&reset)
+	return reset, err
+}
+
+// CreatePasswordReset saves a new password reset record in the database.
+func (r repository) CreatePasswordReset(ctx context.Context, reset entity.PasswordReset) error {
+	return r.db.With(ctx).Model(&reset).Insert()
+}
+
+// UsePasswordReset sets the time the password reset was used in the database if it is not used yet.
+func (r repository) UsePasswordReset(ctx context.Context, id string, now time.Time) (bool, error) {
+	result, err := r.db.With(ctx).Update("password_reset",
+		dbx.Params{"used_at": now},
+		dbx.And(dbx.HashExp{"id": id}, dbx.NewExp("used_at IS NULL")),
+	).Execute()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// VerifyEmail sets the time the user verified the email address in the database.
+func (r repository) VerifyEmail(ctx context.Context, id string, now time.Time) error {
+	_, err := r.db.With(ctx).Update("user", dbx.Params{"email_verified_at": now}, dbx.HashExp{"id": id}).Execute()
+	return err
+}
+
+// LockEmailVerification reads the email verification with the given token hash from the database and locks its row,
+// so that the token can't be used by another request until the end of the transaction.
+func (r repository) LockEmailVerification(ctx context.Context, hash string) (entity.EmailVerification, error) {
+	var verification entity.EmailVerification
+	query := r.db.With(ctx).Select().From("email_verification").Where(dbx.HashExp{"token_hash": hash}).Build()
+	err := r.db.With(ctx).NewQuery(query.SQL() + " FOR UPDATE").Bind(query.Params()).One(&verification)
+	return verification, err
+}
+
+// CreateEmailVerification saves a new email verification record in the database.
+func (r repository) CreateEmailVerification(ctx context.Context, verification entity.EmailVerification) error {
+	return r.db.With(ctx).Model(&verification).Insert()
+}
+
+// UseEmailVerification sets the time the email verification was used in the database if it is not used yet.
+func (r repository) UseEmailVerification(ctx context.Context, id string, now time.Time) (bool, error) {
+	result, err := r.db.With(ctx).Update("email_verification",
+		dbx.Params{"used_at": now},
+		dbx.And(dbx.HashExp{"id": id}, dbx.NewExp("used_at IS NULL")),
+	).Execute()
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"testing"
+	"time"
 
 	"github.com/nvnoskov/dynamo-backend/internal/entity"
 	"github.com/nvnoskov/dynamo-backend/internal/test"
@@ -14,7 +15,7 @@ import (
 func TestRepository(t *testing.T) {
 	logger, _ := log.NewForTest()
 	db := test.DB(t)
-	test.ResetTables(t, db, "user")
+	test.ResetTables(t, db, "user", "refresh_token", "password_reset", "email_verification")
 	repo := NewRepository(db, logger)
 
 	ctx := context.Background()
@@ -25,6 +26,7 @@ func TestRepository(t *testing.T) {
 		Name:     "user1",
 		Password: "123",
 		Email:    "user1@mail.com",
+		Role:     entity.RoleCustomer,
 	})
 
 	// get
@@ -34,4 +36,99 @@ func TestRepository(t *testing.T) {
 	_, err = repo.Get(ctx, "test0")
 	assert.Equal(t, sql.ErrNoRows, err)
 
+	// roles
+	assert.Equal(t, entity.RoleCustomer, user.Role)
+	assert.Nil(t, repo.UpdateRole(ctx, "test1", entity.RoleOperator))
+	user, _ = repo.Get(ctx, "test1")
+	assert.Equal(t, entity.RoleOperator, user.Role)
+	count, err := repo.CountByRole(ctx, entity.RoleOperator)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	count, _ = repo.CountByRole(ctx, entity.RoleAdmin)
+	assert.Equal(t, 0, count)
+
+	// refresh tokens
+	now := time.Now()
+	assert.Nil(t, repo.CreateToken(ctx, entity.RefreshToken{ID: "t1", FamilyID: "t1", UserID: "test1",
+		TokenHash: "hash1", ExpiresAt: now.Add(time.Hour), CreatedAt: now}))
+	assert.Nil(t, repo.CreateToken(ctx, entity.RefreshToken{ID: "t2", FamilyID: "t1", UserID: "test1",
+		TokenHash: "hash2", ExpiresAt: now.Add(time.Hour), CreatedAt: now}))
+	token, err := repo.GetTokenByHash(ctx, "hash2")
+	assert.Nil(t, err)
+	assert.Equal(t, "t2", token.ID)
+	_, err = repo.GetTokenByHash(ctx, "hash0")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// a token can be used once
+	used, err := repo.UseToken(ctx, "t1", now)
+	assert.Nil(t, err)
+	assert.True(t, used)
+	used, _ = repo.UseToken(ctx, "t1", now)
+	assert.False(t, used)
+	token, _ = repo.GetToken(ctx, "t1")
+	assert.NotNil(t, token.UsedAt)
+
+	// revoking the family revokes all its tokens
+	assert.Nil(t, repo.RevokeFamily(ctx, "t1", now))
+	token, _ = repo.GetToken(ctx, "t2")
+	assert.NotNil(t, token.RevokedAt)
+	used, _ = repo.UseToken(ctx, "t2", now)
+	assert.False(t, used)
+
+	// get by email
+	user, err = repo.GetByEmail(ctx, "user1@mail.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "test1", user.ID)
+	_, err = repo.GetByEmail(ctx, "user0@mail.com")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// update password
+	assert.Nil(t, repo.UpdatePassword(ctx, "test1", "456"))
+	user, _ = repo.Get(ctx, "test1")
+	assert.Equal(t, "456", user.Password)
+
+	// revoking the tokens of the user
+	assert.Nil(t, repo.CreateToken(ctx, entity.RefreshToken{ID: "t3", FamilyID: "t3", UserID: "test1",
+		TokenHash: "hash3", ExpiresAt: now.Add(time.Hour), CreatedAt: now}))
+	assert.Nil(t, repo.RevokeUserTokens(ctx, "test1", now))
+	token, _ = repo.GetToken(ctx, "t3")
+	assert.NotNil(t, token.RevokedAt)
+
+	// password resets can be used once
+	assert.Nil(t, repo.CreatePasswordReset(ctx, entity.PasswordReset{ID: "r1", UserID: "test1",
+		TokenHash: "reset1", ExpiresAt: now.Add(time.Hour), CreatedAt: now}))
+	reset, err := repo.GetPasswordReset(ctx, "reset1")
+	assert.Nil(t, err)
+	assert.Equal(t, "r1", reset.ID)
+	_, err = repo.GetPasswordReset(ctx, "reset0")
+	assert.Equal(t, sql.ErrNoRows, err)
+	used, err = repo.UsePasswordReset(ctx, "r1", now)
+	assert.Nil(t, err)
+	assert.True(t, used)
+	used, _ = repo.UsePasswordReset(ctx, "r1", now)
+	assert.False(t, used)
+
+	// email verifications can be used once
+	assert.Nil(t, repo.CreateEmailVerification(ctx, entity.EmailVerification{ID: "v1", UserID: "test1",
+		Email: "user1@mail.com", TokenHash: "verify1", ExpiresAt: now.Add(time.Hour), CreatedAt: now}))
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		verification, err := repo.LockEmailVerification(ctx, "verify1")
+		assert.Equal(t, "user1@mail.com", verification.Email)
+		return err
+	})
+	assert.Nil(t, err)
+	_, err = repo.LockEmailVerification(ctx, "verify0")
+	assert.Equal(t, sql.ErrNoRows, err)
+	used, err = repo.UseEmailVerification(ctx, "v1", now)
+	assert.Nil(t, err)
+	assert.True(t, used)
+	used, _ = repo.UseEmailVerification(ctx, "v1", now)
+	assert.False(t, used)
+
+	// verify email
+	user, _ = repo.Get(ctx, "test1")
+	assert.False(t, user.EmailVerified())
+	assert.Nil(t, repo.VerifyEmail(ctx, "test1", now))
+	user, _ = repo.Get(ctx, "test1")
+	assert.True(t, user.EmailVerified())
 }
@@ -2,23 +2,57 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/nvnoskov/dynamo-backend/internal/entity"
-	"github.com/nvnoskov/dynamo-backend/internal/errors"
+	"github.com/nvnoskov/dynamo-backend/pkg/dbcontext"
 	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/nvnoskov/dynamo-backend/pkg/mail"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // Service encapsulates the authentication logic.
 type Service interface {
-	// authenticate authenticates a user using username and password.
-	// It returns a JWT token if authentication succeeds. Otherwise, an error is returned.
-	Login(ctx context.Context, username, password string) (string, error)
+	// Login authenticates a user using username and password.
+	// It returns a JWT token and a refresh token if authentication succeeds. Otherwise, an error is returned.
+	Login(ctx context.Context, username, password string) (Tokens, error)
+	// Refresh exchanges a refresh token for a new JWT token and a new refresh token.
+	Refresh(ctx context.Context, refreshToken string) (Tokens, error)
+	// Logout revokes the tokens of the login session of the current JWT token.
+	Logout(ctx context.Context) error
+	// IsRevoked reports whether the JWT token with the specified ID has been revoked.
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+	// ForgotPassword mails a password reset token to the user with the given email address, if there is one.
+	ForgotPassword(ctx context.Context, email string) error
+	// ResetPassword sets a new password of the user with a password reset token and logs the user out everywhere.
+	ResetPassword(ctx context.Context, req ResetPasswordRequest) error
+	// VerifyEmail verifies the email address of a user with the token mailed to the address on registration.
+	VerifyEmail(ctx context.Context, token string) error
+	// ResendVerification mails a new email verification token to the unverified user with the given email address.
+	ResendVerification(ctx context.Context, email string) error
+	// Register creates a customer account and mails an email verification token to its email address.
 	Register(ctx context.Context, req RegisterRequest) (User, error)
+	// Get returns the user with the specified user ID.
 	Get(ctx context.Context, id string) (User, error)
+	// SetRole changes the role of the user with the specified user ID and logs the user out everywhere.
+	SetRole(ctx context.Context, id string, req SetRoleRequest) (User, error)
+}
+
+// Tokens represents the tokens issued on login or refresh.
+type Tokens struct {
+	Token        string `json:"token"`         // JWT access token
+	RefreshToken string `json:"refresh_token"` // token to get the next tokens with, usable once
+	ExpiresIn    int    `json:"expires_in"`    // lifetime of the JWT token in seconds
 }
 
 // User represents the data about an user.
@@ -32,46 +66,266 @@ type Identity interface {
 	GetID() string
 	// GetName returns the user name.
 	GetName() string
+	// GetRole returns the user role.
+	GetRole() string
 }
 
 type service struct {
-	repo            Repository
-	signingKey      string
-	tokenExpiration int
-	logger          log.Logger
+	repo          Repository
+	transactional dbcontext.TransactionFunc
+	keys          *KeySet
+	mailer        mail.Mailer
+	tokenTTL      time.Duration
+	refreshTTL    time.Duration
+	resetTTL      time.Duration
+	verifyTTL     time.Duration
+	// whether the users must verify their email addresses before they can log in
+	requireVerified bool
+	// email address of the user who becomes the first admin
+	adminEmail string
+	logger     log.Logger
 }
 
 // NewService creates a new authentication service.
-func NewService(repo Repository, signingKey string, tokenExpiration int, logger log.Logger) Service {
-	return service{repo, signingKey, tokenExpiration, logger}
+// The JWT tokens it issues are signed with the current key of the key set and expire after tokenTTL,
+// the refresh tokens expire after refreshTTL, and the password reset and email verification tokens
+// sent by the mailer after resetTTL and verifyTTL. If requireVerified is set, the users can't log in
+// before they have verified their email addresses. The user with the verified adminEmail address, if given,
+// is granted the admin role on login as long as there is no admin.
+func NewService(repo Repository, transactional dbcontext.TransactionFunc, keys *KeySet, mailer mail.Mailer,
+	tokenTTL, refreshTTL, resetTTL, verifyTTL time.Duration, requireVerified bool, adminEmail string, logger log.Logger) Service {
+	return service{repo, transactional, keys, mailer, tokenTTL, refreshTTL, resetTTL, verifyTTL, requireVerified, adminEmail, logger}
+}
+
+// Login authenticates a user and generates a JWT token and a refresh token if authentication succeeds.
+// The refresh token starts a new token family. Otherwise, an error is returned.
+// The users who haven't verified their email addresses are refused if the verification is required.
+// The user with the admin email address may become the first admin, see bootstrapAdmin.
+func (s service) Login(ctx context.Context, username, password string) (Tokens, error) {
+	user, ok := s.authenticate(ctx, username, password)
+	if !ok {
+		return Tokens{}, errUnauthorized
+	}
+	if s.requireVerified && !user.EmailVerified() {
+		s.logger.With(ctx, "user", username).Infof("email address not verified")
+		return Tokens{}, errNotVerified
+	}
+	user, err := s.bootstrapAdmin(ctx, user)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return s.issueTokens(ctx, user, "")
 }
 
-// Login authenticates a user and generates a JWT token if authentication succeeds.
-// Otherwise, an error is returned.
-func (s service) Login(ctx context.Context, username, password string) (string, error) {
-	if identity := s.authenticate(ctx, username, password); identity != nil {
-		return s.generateJWT(identity)
+// bootstrapAdmin grants the admin role to the user with the admin email address as long as there is no admin,
+// so that a new deployment gets the first admin, who assigns the roles of the other users.
+// The email address must be verified, so that the role can't be taken by registering with the address.
+func (s service) bootstrapAdmin(ctx context.Context, user User) (User, error) {
+	if s.adminEmail == "" || user.Email != s.adminEmail || !user.EmailVerified() || user.Role == entity.RoleAdmin {
+		return user, nil
 	}
-	return "", errors.Unauthorized("")
+	granted := false
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		count, err := s.repo.CountByRole(ctx, entity.RoleAdmin)
+		if err != nil || count > 0 {
+			return err
+		}
+		granted = true
+		return s.repo.UpdateRole(ctx, user.ID, entity.RoleAdmin)
+	})
+	if err != nil {
+		return User{}, err
+	}
+	if granted {
+		user.Role = entity.RoleAdmin
+		s.logger.With(ctx, "user", user.Name).Infof("granted the admin role to the first admin")
+	}
+	return user, nil
 }
 
-// RegisterRequest .
+// Refresh exchanges a refresh token for new tokens of the same family.
+// A refresh token can be used once: using it again revokes its whole family,
+// as either the legitimate user or an attacker holds a stolen token.
+func (s service) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	now := time.Now()
+	token, err := s.repo.GetTokenByHash(ctx, hashToken(refreshToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tokens{}, errUnauthorized
+	} else if err != nil {
+		return Tokens{}, err
+	}
+	logger := s.logger.With(ctx, "user", token.UserID)
+
+	reused := token.UsedAt != nil && token.RevokedAt == nil
+	if token.Usable(now) {
+		ok, err := s.repo.UseToken(ctx, token.ID, now)
+		if err != nil {
+			return Tokens{}, err
+		}
+		reused = !ok
+	} else if !reused {
+		return Tokens{}, errUnauthorized
+	}
+	if reused {
+		if err := s.repo.RevokeFamily(ctx, token.FamilyID, now); err != nil {
+			return Tokens{}, err
+		}
+		logger.Infof("refresh token reused, revoked token family %v", token.FamilyID)
+		return Tokens{}, errUnauthorized
+	}
+
+	user, err := s.repo.Get(ctx, token.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tokens{}, errUnauthorized
+	} else if err != nil {
+		return Tokens{}, err
+	}
+	return s.issueTokens(ctx, User{user}, token.FamilyID)
+}
+
+// Logout revokes the token family of the JWT token in the context, so that neither the JWT tokens
+// nor the refresh tokens of the login session can be used anymore.
+func (s service) Logout(ctx context.Context) error {
+	token, err := s.repo.GetToken(ctx, currentTokenID(ctx))
+	if errors.Is(err, sql.ErrNoRows) {
+		return errUnauthorized
+	} else if err != nil {
+		return err
+	}
+	if err := s.repo.RevokeFamily(ctx, token.FamilyID, time.Now()); err != nil {
+		return err
+	}
+	s.logger.With(ctx, "user", token.UserID).Infof("logged out, revoked token family %v", token.FamilyID)
+	return nil
+}
+
+// IsRevoked reports whether the JWT token with the specified ID has been revoked.
+// The ID of a JWT token is the ID of the refresh token issued along with it,
+// so a JWT token is revoked with its token family, and unknown IDs are considered revoked.
+func (s service) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	token, err := s.repo.GetToken(ctx, tokenID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return token.RevokedAt != nil, nil
+}
+
+// ResetPasswordRequest represents a request to reset the password of a user.
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`    // password reset token mailed to the user
+	Password string `json:"password"` // new password
+}
+
+// Validate validates the ResetPasswordRequest fields.
+func (m ResetPasswordRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Token, validation.Required),
+		validation.Field(&m.Password, validation.Required, validation.Length(0, 50)),
+	)
+}
+
+// ForgotPassword creates a password reset of the user with the given email address and mails its token to the user.
+// Nothing happens for an unknown email address, and no error is returned either,
+// so that the email addresses of the users can't be found out this way.
+func (s service) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.logger.With(ctx).Infof("password reset of an unknown email address")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := s.repo.CreatePasswordReset(ctx, entity.PasswordReset{
+		ID:        entity.GenerateID(),
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(s.resetTTL),
+		CreatedAt: now,
+	}); err != nil {
+		return err
+	}
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %v,\n\nUse the following token to reset your password within %v:\n\n%v\n\n"+
+			"If you didn't ask to reset your password, you can ignore this message.\n", user.Name, s.resetTTL, token),
+	}); err != nil {
+		return err
+	}
+	s.logger.With(ctx, "user", user.Name).Infof("password reset requested")
+	return nil
+}
+
+// ResetPassword sets the new password of the user the password reset token was mailed to.
+// The token can be used once, and all the tokens of the user are revoked, so that the user has to log in again.
+func (s service) ResetPassword(ctx context.Context, req ResetPasswordRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	invalid := validation.Errors{"token": validation.NewError("validation_token", "is invalid or has expired")}
+
+	now := time.Now()
+	reset, err := s.repo.GetPasswordReset(ctx, hashToken(req.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return invalid
+	} else if err != nil {
+		return err
+	}
+	if !reset.Usable(now) {
+		return invalid
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		if ok, err := s.repo.UsePasswordReset(ctx, reset.ID, now); err != nil {
+			return err
+		} else if !ok {
+			return invalid
+		}
+		if err := s.repo.UpdatePassword(ctx, reset.UserID, string(hash)); err != nil {
+			return err
+		}
+		return s.repo.RevokeUserTokens(ctx, reset.UserID, now)
+	})
+	if err != nil {
+		return err
+	}
+	s.logger.With(ctx, "user", reset.UserID).Infof("password reset, revoked all tokens")
+	return nil
+}
+
+// emailRegex matches email addresses with a local part, a domain and a top-level domain, e.g. me@example.com.
+var emailRegex = regexp.MustCompile(`^[^\s@]+@[^\s@.]+(\.[^\s@.]+)+$`)
+
+// RegisterRequest represents a request to register a user.
 type RegisterRequest struct {
-	Name     string `json:"username"`
-	Password string `json:"password"`
-	Email    string `json:"email"`
+	Name     string `json:"username"` // user name to log in with
+	Password string `json:"password"` // password to log in with
+	Email    string `json:"email"`    // email address the verification token is mailed to
 }
 
-// Validate validates the UpdateFlightRequest fields.
+// Validate validates the RegisterRequest fields.
 func (m RegisterRequest) Validate() error {
 	return validation.ValidateStruct(&m,
 		validation.Field(&m.Name, validation.Required, validation.Length(0, 20)),
-		validation.Field(&m.Email, validation.Required, validation.Length(0, 50)),
+		validation.Field(&m.Email, validation.Required, validation.Length(0, 50),
+			validation.Match(emailRegex).Error("must be a valid email address")),
 		validation.Field(&m.Password, validation.Required, validation.Length(0, 50)),
 	)
 }
 
-// Get returns the flight with the specified the flight ID.
+// Get returns the user with the specified user ID.
 func (s service) Get(ctx context.Context, id string) (User, error) {
 	user, err := s.repo.Get(ctx, id)
 	if err != nil {
@@ -80,8 +334,46 @@ func (s service) Get(ctx context.Context, id string) (User, error) {
 	return User{user}, nil
 }
 
-// Register create a user
-// Otherwise, an error is returned.
+// SetRoleRequest represents a request to change the role of a user.
+type SetRoleRequest struct {
+	Role string `json:"role"` // new role, e.g. "operator"
+}
+
+// Validate validates the SetRoleRequest fields.
+func (m SetRoleRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Role, validation.Required, validation.In(entity.RoleAdmin, entity.RoleOperator, entity.RoleCustomer)),
+	)
+}
+
+// SetRole changes the role of the user with the specified ID.
+// All the tokens of the user are revoked, so that the user has to log in again and gets a JWT with the new role.
+func (s service) SetRole(ctx context.Context, id string, req SetRoleRequest) (User, error) {
+	if err := req.Validate(); err != nil {
+		return User{}, err
+	}
+	var user entity.User
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		var err error
+		if user, err = s.repo.Get(ctx, id); err != nil {
+			return err
+		}
+		if err := s.repo.UpdateRole(ctx, id, req.Role); err != nil {
+			return err
+		}
+		user.Role = req.Role
+		return s.repo.RevokeUserTokens(ctx, id, time.Now())
+	})
+	if err != nil {
+		return User{}, err
+	}
+	s.logger.With(ctx, "user", user.Name).Infof("role changed to %v, revoked all tokens", req.Role)
+	return User{user}, nil
+}
+
+// Register creates a user with the customer role and mails an email verification token to the user.
+// The user and the email verification are created within one transaction, and the token is mailed once it commits.
+// A failed mail is logged only, as the user exists by then and can ask for another token with ResendVerification.
 func (s service) Register(ctx context.Context, req RegisterRequest) (User, error) {
 
 	if err := req.Validate(); err != nil {
@@ -93,44 +385,219 @@ func (s service) Register(ctx context.Context, req RegisterRequest) (User, error
 	if err != nil {
 		return User{}, err
 	}
-	err = s.repo.Create(ctx, entity.User{
-		ID:       id,
-		Name:     req.Name,
-		Email:    req.Email,
-		Password: string(hash),
+	var user User
+	var token string
+	err = s.transactional(ctx, func(ctx context.Context) error {
+		err := s.repo.Create(ctx, entity.User{
+			ID:       id,
+			Name:     req.Name,
+			Email:    req.Email,
+			Password: string(hash),
+			Role:     entity.RoleCustomer,
+		})
+		if err != nil {
+			return err
+		}
+		if user, err = s.Get(ctx, id); err != nil {
+			return err
+		}
+		token, err = s.createVerification(ctx, user.User)
+		return err
 	})
 	if err != nil {
 		return User{}, err
 	}
-	return s.Get(ctx, id)
+	if err := s.mailVerification(ctx, user.User, token); err != nil {
+		s.logger.With(ctx, "user", user.Name).Errorf("failed to mail the email verification: %v", err)
+	}
+	return user, nil
+}
+
+// ResendVerification creates a new email verification of the user with the given email address and mails its token
+// to the user. Nothing happens for an unknown or already verified email address, and no error is returned either,
+// so that the email addresses of the users can't be found out this way.
+func (s service) ResendVerification(ctx context.Context, email string) error {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.logger.With(ctx).Infof("email verification of an unknown email address")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if user.EmailVerified() {
+		s.logger.With(ctx, "user", user.Name).Infof("email address already verified")
+		return nil
+	}
+
+	if err := s.sendVerification(ctx, user); err != nil {
+		return err
+	}
+	s.logger.With(ctx, "user", user.Name).Infof("email verification resent")
+	return nil
+}
+
+// sendVerification creates an email verification of the user and mails its token to the email address.
+func (s service) sendVerification(ctx context.Context, user entity.User) error {
+	token, err := s.createVerification(ctx, user)
+	if err != nil {
+		return err
+	}
+	return s.mailVerification(ctx, user, token)
+}
+
+// createVerification creates an email verification of the user and returns its token.
+func (s service) createVerification(ctx context.Context, user entity.User) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = s.repo.CreateEmailVerification(ctx, entity.EmailVerification{
+		ID:        entity.GenerateID(),
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(s.verifyTTL),
+		CreatedAt: now,
+	})
+	return token, err
+}
+
+// mailVerification mails the email verification token to the email address of the user.
+func (s service) mailVerification(ctx context.Context, user entity.User, token string) error {
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Hello %v,\n\nUse the following token to verify your email address within %v:\n\n%v\n", user.Name, s.verifyTTL, token),
+	})
+}
+
+// VerifyEmail marks the email address the token was mailed to as verified.
+// The token can be used once, and only while the user still has the same email address.
+// The email verification is locked while it is used, and the user is verified within the same transaction.
+func (s service) VerifyEmail(ctx context.Context, token string) error {
+	invalid := validation.Errors{"token": validation.NewError("validation_token", "is invalid or has expired")}
+	if token == "" {
+		return validation.Errors{"token": validation.ErrRequired}
+	}
+
+	now := time.Now()
+	var user entity.User
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		verification, err := s.repo.LockEmailVerification(ctx, hashToken(token))
+		if errors.Is(err, sql.ErrNoRows) {
+			return invalid
+		} else if err != nil {
+			return err
+		}
+		if !verification.Usable(now) {
+			return invalid
+		}
+		user, err = s.repo.Get(ctx, verification.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return invalid
+		} else if err != nil {
+			return err
+		}
+		if user.Email != verification.Email {
+			return invalid
+		}
+		if ok, err := s.repo.UseEmailVerification(ctx, verification.ID, now); err != nil {
+			return err
+		} else if !ok {
+			return invalid
+		}
+		return s.repo.VerifyEmail(ctx, user.ID, now)
+	})
+	if err != nil {
+		return err
+	}
+	s.logger.With(ctx, "user", user.Name).Infof("email address verified")
+	return nil
 }
 
 // authenticate authenticates a user using username and password.
 // If username and password are correct, an identity is returned. Otherwise, nil is returned.
-func (s service) authenticate(ctx context.Context, username, password string) Identity {
+func (s service) authenticate(ctx context.Context, username, password string) (User, bool) {
 	logger := s.logger.With(ctx, "user", username)
 
 	user, err := s.repo.GetByUsername(ctx, username)
 	if err != nil {
 		logger.Infof("User not found")
-		return nil
+		return User{}, false
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
 		logger.Infof("authentication failed")
-		return nil
+		return User{}, false
 	}
 
 	logger.Infof("authentication successful")
-	return User{user}
+	return User{user}, true
+
+}
 
+// issueTokens saves a new refresh token of the identity in the given token family and generates a JWT token
+// with the same ID. An empty family ID starts a new family.
+func (s service) issueTokens(ctx context.Context, identity Identity, familyID string) (Tokens, error) {
+	refreshToken, err := generateToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+	now := time.Now()
+	id := entity.GenerateID()
+	if familyID == "" {
+		familyID = id
+	}
+	if err := s.repo.CreateToken(ctx, entity.RefreshToken{
+		ID:        id,
+		FamilyID:  familyID,
+		UserID:    identity.GetID(),
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: now.Add(s.refreshTTL),
+		CreatedAt: now,
+	}); err != nil {
+		return Tokens{}, err
+	}
+	token, err := s.generateJWT(identity, id)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{token, refreshToken, int(s.tokenTTL.Seconds())}, nil
 }
 
-// generateJWT generates a JWT that encodes an identity.
-func (s service) generateJWT(identity Identity) (string, error) {
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+// generateJWT generates a JWT with the given ID that encodes an identity.
+// The token is signed with the current key of the key set, whose ID is the "kid" header of the token.
+func (s service) generateJWT(identity Identity, id string) (string, error) {
+	now := time.Now()
+	key, ok := s.keys.SigningKey(now)
+	if !ok {
+		return "", fmt.Errorf("no signing key is active at %v", now)
+	}
+	token := jwt.NewWithClaims(key.Method, jwt.MapClaims{
 		"id":   identity.GetID(),
 		"name": identity.GetName(),
-		"exp":  time.Now().Add(time.Duration(s.tokenExpiration) * time.Hour).Unix(),
-	}).SignedString([]byte(s.signingKey))
+		"role": identity.GetRole(),
+		"jti":  id,
+		"iat":  now.Unix(),
+		"exp":  now.Add(s.tokenTTL).Unix(),
+	})
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// generateToken generates a random opaque token.
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the SHA-256 hash of the token. Unlike passwords, the tokens are random enough
+// not to need a slow hash, and the hash can be looked up.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -3,12 +3,18 @@ package auth
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dgrijalva/jwt-go"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/nvnoskov/dynamo-backend/internal/entity"
 	"github.com/nvnoskov/dynamo-backend/internal/errors"
 	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/nvnoskov/dynamo-backend/pkg/mail"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func Test_service_Authenticate(t *testing.T) {
@@ -23,28 +29,322 @@ func Test_service_Authenticate(t *testing.T) {
 			},
 		}},
 		// &mockRepository{}
-		"test", 100, logger)
+		mockTransactional, mockKeys, &mockMailer{}, time.Hour, 100*time.Hour, time.Hour, time.Hour, false, "", logger)
 	_, err := s.Login(context.Background(), "unknown", "bad")
 	assert.Equal(t, errors.Unauthorized(""), err)
-	token, err := s.Login(context.Background(), "demo", "pass")
+	tokens, err := s.Login(context.Background(), "demo", "pass")
 	assert.Nil(t, err)
-	assert.NotEmpty(t, token)
+	assert.NotEmpty(t, tokens.Token)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, 3600, tokens.ExpiresIn)
 }
 
 func Test_service_GenerateJWT(t *testing.T) {
 	logger, _ := log.NewForTest()
-	s := service{&mockRepository{}, "test", 100, logger}
+	s := service{&mockRepository{}, mockTransactional, mockKeys, &mockMailer{}, time.Hour, 100 * time.Hour, time.Hour, time.Hour, false, "", logger}
 	token, err := s.generateJWT(entity.User{
 		ID:   "100",
 		Name: "demo",
-	})
+		Role: entity.RoleOperator,
+	}, "jti")
 	if assert.Nil(t, err) {
 		assert.NotEmpty(t, token)
+		claims := jwt.MapClaims{}
+		key, _ := mockKeys.SigningKey(time.Now())
+		parsed, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) { return key.PrivateKey.Public(), nil })
+		assert.Nil(t, err)
+		assert.Equal(t, "k1", parsed.Header["kid"])
+		assert.Equal(t, entity.RoleOperator, claims["role"])
+		assert.Equal(t, "jti", claims["jti"])
 	}
 }
 
+func Test_service_Register(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	mailer := &mockMailer{}
+	s := service{repo, mockTransactional, mockKeys, mailer, time.Hour, 100 * time.Hour, time.Hour, time.Hour, true, "", logger}
+	ctx := context.Background()
+
+	_, err := s.Register(ctx, RegisterRequest{Name: "demo", Password: "pass", Email: "demo.com"})
+	assert.NotNil(t, err)
+	_, err = s.Register(ctx, RegisterRequest{Name: "demo", Password: "pass", Email: "demo@demo"})
+	assert.NotNil(t, err)
+
+	// the user and the email verification are created within one transaction, and the token is mailed after it
+	transactions, mailed := 0, 0
+	s.transactional = func(ctx context.Context, f func(ctx context.Context) error) error {
+		transactions++
+		err := f(ctx)
+		mailed += len(mailer.messages)
+		return err
+	}
+	user, err := s.Register(ctx, RegisterRequest{Name: "demo", Password: "pass", Email: "demo@demo.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, transactions)
+	assert.Equal(t, 0, mailed)
+	assert.Equal(t, entity.RoleCustomer, user.Role)
+	assert.False(t, user.EmailVerified())
+	if !assert.Equal(t, 1, len(mailer.messages)) || !assert.Equal(t, 1, len(repo.verifications)) {
+		return
+	}
+	assert.Equal(t, "demo@demo.com", mailer.messages[0].To)
+	token := mailToken(mailer.messages[0])
+	assert.Equal(t, hashToken(token), repo.verifications[0].TokenHash)
+
+	// unverified users can't log in while the verification is required
+	_, err = s.Login(ctx, "demo", "pass")
+	assert.Equal(t, errors.Forbidden("The email address has not been verified yet."), err)
+	s.requireVerified = false
+	_, err = s.Login(ctx, "demo", "pass")
+	assert.Nil(t, err)
+	s.requireVerified = true
+
+	_, ok := s.VerifyEmail(ctx, "").(validation.Errors)
+	assert.True(t, ok)
+	_, ok = s.VerifyEmail(ctx, "unknown").(validation.Errors)
+	assert.True(t, ok)
+	assert.Nil(t, s.VerifyEmail(ctx, token))
+	assert.True(t, repo.items[0].EmailVerified())
+	// the email verification is used and the user verified within one transaction
+	assert.Equal(t, 3, transactions)
+	_, err = s.Login(ctx, "demo", "pass")
+	assert.Nil(t, err)
+
+	// a token can be used once
+	_, ok = s.VerifyEmail(ctx, token).(validation.Errors)
+	assert.True(t, ok)
+
+	// expired tokens are rejected
+	s.verifyTTL = -time.Minute
+	assert.Nil(t, s.sendVerification(ctx, repo.items[0]))
+	_, ok = s.VerifyEmail(ctx, mailToken(mailer.messages[1])).(validation.Errors)
+	assert.True(t, ok)
+
+	// tokens mailed to a previous email address are rejected
+	s.verifyTTL = time.Hour
+	assert.Nil(t, s.sendVerification(ctx, repo.items[0]))
+	repo.items[0].Email = "other@demo.com"
+	_, ok = s.VerifyEmail(ctx, mailToken(mailer.messages[2])).(validation.Errors)
+	assert.True(t, ok)
+
+	// new tokens are mailed to unverified email addresses only, without revealing the unknown ones
+	assert.Nil(t, s.ResendVerification(ctx, "unknown@demo.com"))
+	assert.Nil(t, s.ResendVerification(ctx, "demo@demo.com"))
+	assert.Equal(t, 3, len(mailer.messages))
+	repo.items[0].EmailVerifiedAt = nil
+	assert.Nil(t, s.ResendVerification(ctx, "other@demo.com"))
+	if assert.Equal(t, 4, len(mailer.messages)) {
+		assert.Equal(t, "other@demo.com", mailer.messages[3].To)
+		assert.Nil(t, s.VerifyEmail(ctx, mailToken(mailer.messages[3])))
+	}
+
+	// the user is registered even if the token can't be mailed, and can ask for another one
+	mailer.err = errors.InternalServerError("")
+	_, err = s.Register(ctx, RegisterRequest{Name: "demo2", Password: "pass", Email: "demo2@demo.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(repo.items))
+	assert.Equal(t, 5, len(repo.verifications))
+}
+
+func Test_service_Refresh(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: []entity.User{{ID: "100", Name: "demo"}}}
+	s := service{repo, mockTransactional, mockKeys, &mockMailer{}, time.Hour, 100 * time.Hour, time.Hour, time.Hour, false, "", logger}
+	ctx := context.Background()
+
+	first, err := s.issueTokens(ctx, entity.User{ID: "100", Name: "demo"}, "")
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(repo.tokens)) {
+		assert.Equal(t, repo.tokens[0].ID, repo.tokens[0].FamilyID)
+		assert.NotEqual(t, first.RefreshToken, repo.tokens[0].TokenHash)
+	}
+
+	// a refresh token is exchanged for new tokens of the same family
+	second, err := s.Refresh(ctx, first.RefreshToken)
+	assert.Nil(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	if assert.Equal(t, 2, len(repo.tokens)) {
+		assert.NotNil(t, repo.tokens[0].UsedAt)
+		assert.Equal(t, repo.tokens[0].FamilyID, repo.tokens[1].FamilyID)
+	}
+	revoked, _ := s.IsRevoked(ctx, repo.tokens[0].ID)
+	assert.False(t, revoked)
+
+	// unknown refresh tokens are rejected
+	_, err = s.Refresh(ctx, "unknown")
+	assert.Equal(t, errors.Unauthorized(""), err)
+
+	// reusing a refresh token revokes the family
+	_, err = s.Refresh(ctx, first.RefreshToken)
+	assert.Equal(t, errors.Unauthorized(""), err)
+	for _, token := range repo.tokens {
+		assert.NotNil(t, token.RevokedAt)
+	}
+	_, err = s.Refresh(ctx, second.RefreshToken)
+	assert.Equal(t, errors.Unauthorized(""), err)
+	revoked, _ = s.IsRevoked(ctx, repo.tokens[1].ID)
+	assert.True(t, revoked)
+	revoked, _ = s.IsRevoked(ctx, "unknown")
+	assert.True(t, revoked)
+
+	// expired refresh tokens are rejected
+	s.refreshTTL = -time.Minute
+	expired, _ := s.issueTokens(ctx, entity.User{ID: "100", Name: "demo"}, "")
+	_, err = s.Refresh(ctx, expired.RefreshToken)
+	assert.Equal(t, errors.Unauthorized(""), err)
+}
+
+func Test_service_SetRole(t *testing.T) {
+	logger, _ := log.NewForTest()
+	verified := time.Now()
+	repo := &mockRepository{items: []entity.User{
+		{ID: "100", Name: "demo", Email: "demo@demo.com", Role: entity.RoleCustomer,
+			Password: "$2a$10$6gKu8va5UqM48gd/iJdrJOyNMx1GgX6OFymxKuccbbC6nS/LKlu5m"},
+		{ID: "101", Name: "other", Email: "other@demo.com", Role: entity.RoleCustomer},
+	}}
+	s := service{repo, mockTransactional, mockKeys, &mockMailer{}, time.Hour, 100 * time.Hour, time.Hour, time.Hour, false,
+		"demo@demo.com", logger}
+	ctx := context.Background()
+
+	// the user with the admin email address becomes the first admin once the address is verified
+	_, err := s.Login(ctx, "demo", "pass")
+	assert.Nil(t, err)
+	assert.Equal(t, entity.RoleCustomer, repo.items[0].Role)
+	repo.items[0].EmailVerifiedAt = &verified
+	_, err = s.Login(ctx, "demo", "pass")
+	assert.Nil(t, err)
+	assert.Equal(t, entity.RoleAdmin, repo.items[0].Role)
+
+	// the admin assigns the roles, which logs the user out
+	_, err = s.issueTokens(ctx, repo.items[1], "")
+	assert.Nil(t, err)
+	_, err = s.SetRole(ctx, "101", SetRoleRequest{Role: "pilot"})
+	_, ok := err.(validation.Errors)
+	assert.True(t, ok)
+	_, err = s.SetRole(ctx, "none", SetRoleRequest{Role: entity.RoleOperator})
+	assert.Equal(t, sql.ErrNoRows, err)
+	user, err := s.SetRole(ctx, "101", SetRoleRequest{Role: entity.RoleOperator})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.RoleOperator, user.Role)
+	assert.Equal(t, entity.RoleOperator, repo.items[1].Role)
+	assert.NotNil(t, repo.tokens[len(repo.tokens)-1].RevokedAt)
+
+	// the admin email address doesn't grant the role again while there is an admin
+	_, err = s.SetRole(ctx, "100", SetRoleRequest{Role: entity.RoleCustomer})
+	assert.Nil(t, err)
+	_, err = s.SetRole(ctx, "101", SetRoleRequest{Role: entity.RoleAdmin})
+	assert.Nil(t, err)
+	_, err = s.Login(ctx, "demo", "pass")
+	assert.Nil(t, err)
+	assert.Equal(t, entity.RoleCustomer, repo.items[0].Role)
+}
+
+func Test_service_Logout(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: []entity.User{{ID: "100", Name: "demo"}}}
+	s := service{repo, mockTransactional, mockKeys, &mockMailer{}, time.Hour, 100 * time.Hour, time.Hour, time.Hour, false, "", logger}
+	ctx := context.Background()
+
+	tokens, _ := s.issueTokens(ctx, entity.User{ID: "100", Name: "demo"}, "")
+	tokens, _ = s.Refresh(ctx, tokens.RefreshToken)
+	other, _ := s.issueTokens(ctx, entity.User{ID: "100", Name: "demo"}, "")
+
+	assert.Equal(t, errors.Unauthorized(""), s.Logout(ctx))
+	assert.Nil(t, s.Logout(context.WithValue(ctx, tokenIDKey, repo.tokens[1].ID)))
+	for _, token := range repo.tokens[:2] {
+		revoked, _ := s.IsRevoked(ctx, token.ID)
+		assert.True(t, revoked)
+	}
+	_, err := s.Refresh(ctx, tokens.RefreshToken)
+	assert.Equal(t, errors.Unauthorized(""), err)
+
+	// the other login sessions are not affected
+	_, err = s.Refresh(ctx, other.RefreshToken)
+	assert.Nil(t, err)
+}
+
+func Test_service_ResetPassword(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: []entity.User{{ID: "100", Name: "demo", Email: "demo@demo.com"}}}
+	mailer := &mockMailer{}
+	s := service{repo, mockTransactional, mockKeys, mailer, time.Hour, 100 * time.Hour, time.Hour, time.Hour, false, "", logger}
+	ctx := context.Background()
+	session, _ := s.issueTokens(ctx, entity.User{ID: "100", Name: "demo"}, "")
+
+	// unknown email addresses are not revealed
+	assert.Nil(t, s.ForgotPassword(ctx, "unknown@demo.com"))
+	assert.Empty(t, mailer.messages)
+
+	assert.Nil(t, s.ForgotPassword(ctx, "demo@demo.com"))
+	if !assert.Equal(t, 1, len(mailer.messages)) || !assert.Equal(t, 1, len(repo.resets)) {
+		return
+	}
+	assert.Equal(t, "demo@demo.com", mailer.messages[0].To)
+	token := mailToken(mailer.messages[0])
+	assert.Equal(t, hashToken(token), repo.resets[0].TokenHash)
+
+	_, ok := s.ResetPassword(ctx, ResetPasswordRequest{Token: token}).(validation.Errors)
+	assert.True(t, ok)
+	_, ok = s.ResetPassword(ctx, ResetPasswordRequest{Token: "unknown", Password: "new"}).(validation.Errors)
+	assert.True(t, ok)
+
+	// the password is changed and the user is logged out everywhere within one transaction
+	transactions := 0
+	s.transactional = func(ctx context.Context, f func(ctx context.Context) error) error {
+		transactions++
+		return f(ctx)
+	}
+	assert.Nil(t, s.ResetPassword(ctx, ResetPasswordRequest{Token: token, Password: "new"}))
+	assert.Equal(t, 1, transactions)
+	assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(repo.items[0].Password), []byte("new")))
+	_, err := s.Refresh(ctx, session.RefreshToken)
+	assert.Equal(t, errors.Unauthorized(""), err)
+	_, err = s.Login(ctx, "demo", "new")
+	assert.Nil(t, err)
+
+	// a token can be used once
+	_, ok = s.ResetPassword(ctx, ResetPasswordRequest{Token: token, Password: "other"}).(validation.Errors)
+	assert.True(t, ok)
+
+	// expired tokens are rejected
+	s.resetTTL = -time.Minute
+	assert.Nil(t, s.ForgotPassword(ctx, "demo@demo.com"))
+	token = mailToken(mailer.messages[1])
+	_, ok = s.ResetPassword(ctx, ResetPasswordRequest{Token: token, Password: "other"}).(validation.Errors)
+	assert.True(t, ok)
+}
+
+// mailToken returns the token in the body of a message sent by the service, which follows the first colon.
+func mailToken(msg mail.Message) string {
+	return strings.Fields(strings.SplitN(msg.Body, ":", 2)[1])[0]
+}
+
+// mockTransactional runs the function without a transaction.
+func mockTransactional(ctx context.Context, f func(ctx context.Context) error) error {
+	return f(ctx)
+}
+
+type mockMailer struct {
+	messages []mail.Message
+	// error returned instead of sending the messages
+	err error
+}
+
+func (m *mockMailer) Send(ctx context.Context, msg mail.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
 type mockRepository struct {
-	items []entity.User
+	items  []entity.User
+	tokens []entity.RefreshToken
+	resets []entity.PasswordReset
+	// email verifications
+	verifications []entity.EmailVerification
 }
 
 func (m mockRepository) Get(ctx context.Context, id string) (entity.User, error) {
@@ -64,7 +364,155 @@ func (m mockRepository) GetByUsername(ctx context.Context, username string) (ent
 	return entity.User{}, sql.ErrNoRows
 }
 
+func (m mockRepository) GetByEmail(ctx context.Context, email string) (entity.User, error) {
+	for _, item := range m.items {
+		if item.Email == email {
+			return item, nil
+		}
+	}
+	return entity.User{}, sql.ErrNoRows
+}
+
 func (m *mockRepository) Create(ctx context.Context, flight entity.User) error {
 	m.items = append(m.items, flight)
 	return nil
 }
+
+func (m *mockRepository) UpdatePassword(ctx context.Context, id, password string) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items[i].Password = password
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockRepository) UpdateRole(ctx context.Context, id, role string) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items[i].Role = role
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m mockRepository) CountByRole(ctx context.Context, role string) (int, error) {
+	count := 0
+	for _, item := range m.items {
+		if item.Role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m mockRepository) GetToken(ctx context.Context, id string) (entity.RefreshToken, error) {
+	for _, token := range m.tokens {
+		if token.ID == id {
+			return token, nil
+		}
+	}
+	return entity.RefreshToken{}, sql.ErrNoRows
+}
+
+func (m mockRepository) GetTokenByHash(ctx context.Context, hash string) (entity.RefreshToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == hash {
+			return token, nil
+		}
+	}
+	return entity.RefreshToken{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) CreateToken(ctx context.Context, token entity.RefreshToken) error {
+	m.tokens = append(m.tokens, token)
+	return nil
+}
+
+func (m *mockRepository) UseToken(ctx context.Context, id string, now time.Time) (bool, error) {
+	for i, token := range m.tokens {
+		if token.ID == id && token.UsedAt == nil && token.RevokedAt == nil {
+			m.tokens[i].UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRepository) RevokeFamily(ctx context.Context, familyID string, now time.Time) error {
+	for i, token := range m.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			m.tokens[i].RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) RevokeUserTokens(ctx context.Context, userID string, now time.Time) error {
+	for i, token := range m.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			m.tokens[i].RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m mockRepository) GetPasswordReset(ctx context.Context, hash string) (entity.PasswordReset, error) {
+	for _, reset := range m.resets {
+		if reset.TokenHash == hash {
+			return reset, nil
+		}
+	}
+	return entity.PasswordReset{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) CreatePasswordReset(ctx context.Context, reset entity.PasswordReset) error {
+	m.resets = append(m.resets, reset)
+	return nil
+}
+
+func (m *mockRepository) UsePasswordReset(ctx context.Context, id string, now time.Time) (bool, error) {
+	for i, reset := range m.resets {
+		if reset.ID == id && reset.UsedAt == nil {
+			m.resets[i].UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRepository) VerifyEmail(ctx context.Context, id string, now time.Time) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items[i].EmailVerifiedAt = &now
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m mockRepository) LockEmailVerification(ctx context.Context, hash string) (entity.EmailVerification, error) {
+	for _, verification := range m.verifications {
+		if verification.TokenHash == hash {
+			return verification, nil
+		}
+	}
+	return entity.EmailVerification{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) CreateEmailVerification(ctx context.Context, verification entity.EmailVerification) error {
+	m.verifications = append(m.verifications, verification)
+	return nil
+}
+
+func (m *mockRepository) UseEmailVerification(ctx context.Context, id string, now time.Time) (bool, error) {
+	for i, verification := range m.verifications {
+		if verification.ID == id && verification.UsedAt == nil {
+			m.verifications[i].UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,84 @@
+package booking
+
+import (
+	"net/http"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/nvnoskov/dynamo-backend/internal/errors"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/nvnoskov/dynamo-backend/pkg/pagination"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	// the following endpoints require a valid JWT
+	r.Use(authHandler)
+	r.Get("/bookings/<id>", res.get)
+	r.Get("/bookings", res.query)
+	r.Post("/bookings", res.hold)
+	r.Post("/bookings/<id>/confirm", res.confirm)
+	r.Post("/bookings/<id>/cancel", res.cancel)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	booking, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(booking)
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	bookings, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = bookings
+	return c.Write(pages)
+}
+
+func (r resource) hold(c *routing.Context) error {
+	var input HoldRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	booking, err := r.service.Hold(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(booking, http.StatusCreated)
+}
+
+func (r resource) confirm(c *routing.Context) error {
+	booking, err := r.service.Confirm(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(booking)
+}
+
+func (r resource) cancel(c *routing.Context) error {
+	booking, err := r.service.Cancel(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(booking)
+}
@@ -0,0 +1,49 @@
+package booking
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/claim"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := newMockRepository()
+	expiresAt := time.Now().Add(10 * time.Minute)
+	repo.bookings["123"] = entity.Booking{ID: "123", UserID: "100", FlightID: "f1", Seats: entity.SeatNumbers{"1F"},
+		Status: entity.BookingHeld, ExpiresAt: &expiresAt, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	repo.bookings["456"] = entity.Booking{ID: "456", UserID: "200", FlightID: "f1", Seats: entity.SeatNumbers{"1D"},
+		Status: entity.BookingConfirmed, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	RegisterHandlers(router.Group(""), NewService(repo, mockTransactional, &claim.MockService{}, 15*time.Minute, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/bookings", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get 123", "GET", "/bookings/123", "", header, http.StatusOK, `*"seats":["1F"]*`},
+		{"get other user", "GET", "/bookings/456", "", header, http.StatusNotFound, ""},
+		{"get unknown", "GET", "/bookings/1234", "", header, http.StatusNotFound, ""},
+		{"hold ok", "POST", "/bookings", `{"flight_id":"f1","seats":["1A","1C"]}`, header, http.StatusCreated, `*"status":"held"*`},
+		{"hold ok count", "GET", "/bookings", "", header, http.StatusOK, `*"total_count":2*`},
+		{"hold taken", "POST", "/bookings", `{"flight_id":"f1","seats":["1A"]}`, header, http.StatusConflict, ""},
+		{"hold closed", "POST", "/bookings", `{"flight_id":"cancelled","seats":["1A"]}`, header, http.StatusConflict, ""},
+		{"hold auth error", "POST", "/bookings", `{"flight_id":"f1","seats":["1D"]}`, nil, http.StatusUnauthorized, ""},
+		{"hold input error", "POST", "/bookings", `"flight_id":"f1"}`, header, http.StatusBadRequest, ""},
+		{"hold validation error", "POST", "/bookings", `{"flight_id":"f1","seats":["1Z"]}`, header, http.StatusBadRequest, `*"field":"seats"*`},
+		{"confirm ok", "POST", "/bookings/123/confirm", "", header, http.StatusOK, `*"status":"confirmed"*`},
+		{"confirm again", "POST", "/bookings/123/confirm", "", header, http.StatusConflict, ""},
+		{"confirm other user", "POST", "/bookings/456/confirm", "", header, http.StatusNotFound, ""},
+		{"cancel ok", "POST", "/bookings/123/cancel", "", header, http.StatusOK, `*"status":"cancelled"*`},
+		{"cancel again", "POST", "/bookings/123/cancel", "", header, http.StatusConflict, ""},
+		{"cancel auth error", "POST", "/bookings/123/cancel", "", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
@@ -0,0 +1,24 @@
+package booking
+
+import (
+	"fmt"
+
+	"github.com/nvnoskov/dynamo-backend/internal/errors"
+)
+
+var (
+	// ErrSeatTaken is returned when some of the seats to hold are held or booked already.
+	ErrSeatTaken = errors.Conflict("some of the seats are not available")
+	// ErrFlightClosed is returned when the flight to hold the seats of has departed or is cancelled.
+	ErrFlightClosed = errors.Conflict("the flight is not open for booking")
+	// ErrSoldOut is returned when the seats to hold would exceed the capacity of the flight left by the other
+	// bookings and the seat claims.
+	ErrSoldOut = errors.Conflict("the flight has no capacity left for the seats")
+	// ErrHoldExpired is returned when a booking is confirmed after the end of its hold.
+	ErrHoldExpired = errors.Conflict("the hold of the seats has expired")
+)
+
+// errStatus returns the error of an action the status of a booking doesn't allow, e.g. confirming a cancelled booking.
+func errStatus(action, status string) error {
+	return errors.Conflict(fmt.Sprintf("cannot %v a booking that is %v", action, status))
+}
@@ -0,0 +1,174 @@
+package booking
+
+import (
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/dbcontext"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+// Repository encapsulates the logic to access bookings and the seats they hold from the data source.
+// The Lock methods lock the rows they return until the end of the transaction they are called in.
+type Repository interface {
+	// Get returns the booking with the specified booking ID.
+	Get(ctx context.Context, id string) (entity.Booking, error)
+	// Count returns the number of bookings of the user.
+	Count(ctx context.Context, userID string) (int, error)
+	// Query returns the bookings of the user with the given offset and limit, the latest first.
+	Query(ctx context.Context, userID string, offset, limit int) ([]entity.Booking, error)
+	// Create saves a new booking in the storage.
+	Create(ctx context.Context, booking entity.Booking) error
+	// Update updates the booking with given ID in the storage.
+	Update(ctx context.Context, booking entity.Booking) error
+	// Lock returns the booking with the specified ID and locks it.
+	Lock(ctx context.Context, id string) (entity.Booking, error)
+	// LockExpired returns the held bookings whose hold has ended by the given time and locks them.
+	// If IDs are given, only the bookings with them are returned. The bookings locked by other transactions are skipped.
+	LockExpired(ctx context.Context, now time.Time, ids ...string) ([]entity.Booking, error)
+	// LockFlight returns the flight with the specified ID and locks it until the end of the transaction,
+	// so that the seats of the flight are held one transaction at a time.
+	LockFlight(ctx context.Context, id string) (entity.Flight, error)
+	// LockSeats returns the seats of the flight with the given numbers and locks them.
+	LockSeats(ctx context.Context, flightID string, numbers []string) ([]entity.Seat, error)
+	// UpdateSeats sets the status and the booking of the seats of the flight with the given numbers.
+	// The number of the taken seats of the flight is updated accordingly and its version incremented.
+	UpdateSeats(ctx context.Context, flightID string, numbers []string, status string, bookingID *string) error
+}
+
+// repository persists bookings in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new booking repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the booking with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Booking, error) {
+	var booking entity.Booking
+	err := r.db.With(ctx).Select().Model(id, &booking)
+	return booking, err
+}
+
+// Count returns the number of the booking records of the user in the database.
+func (r repository) Count(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("booking").Where(dbx.HashExp{"user_id": userID}).Row(&count)
+	return count, err
+}
+
+// Query retrieves the booking records of the user with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, userID string, offset, limit int) ([]entity.Booking, error) {
+	var bookings []entity.Booking
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"user_id": userID}).
+		OrderBy("created_at DESC", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&bookings)
+	return bookings, err
+}
+
+// Create saves a new booking record in the database.
+func (r repository) Create(ctx context.Context, booking entity.Booking) error {
+	return r.db.With(ctx).Model(&booking).Insert()
+}
+
+// Update saves the changes to a booking in the database.
+func (r repository) Update(ctx context.Context, booking entity.Booking) error {
+	return r.db.With(ctx).Model(&booking).Update()
+}
+
+// Lock reads the booking with the specified ID from the database with SELECT ... FOR UPDATE.
+func (r repository) Lock(ctx context.Context, id string) (entity.Booking, error) {
+	var booking entity.Booking
+	err := r.lock(ctx, r.db.With(ctx).
+		Select().
+		From("booking").
+		Where(dbx.HashExp{"id": id}), "FOR UPDATE").
+		One(&booking)
+	return booking, err
+}
+
+// LockExpired reads the expired holds from the database with SELECT ... FOR UPDATE SKIP LOCKED,
+// so that a booking being confirmed or cancelled is left to that transaction.
+func (r repository) LockExpired(ctx context.Context, now time.Time, ids ...string) ([]entity.Booking, error) {
+	where := dbx.And(
+		dbx.HashExp{"status": entity.BookingHeld},
+		dbx.NewExp("expires_at<={:now}", dbx.Params{"now": now}),
+	)
+	if len(ids) > 0 {
+		where = dbx.And(where, dbx.In("id", values(ids)...))
+	}
+	var bookings []entity.Booking
+	err := r.lock(ctx, r.db.With(ctx).
+		Select().
+		From("booking").
+		Where(where).
+		OrderBy("expires_at", "id"), "FOR UPDATE SKIP LOCKED").
+		All(&bookings)
+	return bookings, err
+}
+
+// LockFlight reads the flight with the specified ID from the database with SELECT ... FOR UPDATE,
+// so that neither its status nor its taken and claimed seats can change while its seats are being held.
+func (r repository) LockFlight(ctx context.Context, id string) (entity.Flight, error) {
+	var flight entity.Flight
+	err := r.lock(ctx, r.db.With(ctx).
+		Select().
+		From("flight").
+		Where(dbx.HashExp{"id": id}), "FOR UPDATE").
+		One(&flight)
+	return flight, err
+}
+
+// LockSeats reads the seats of the flight with the given numbers from the database with SELECT ... FOR UPDATE.
+// The seats are locked in the order of their numbers, so that concurrent holds can't deadlock.
+func (r repository) LockSeats(ctx context.Context, flightID string, numbers []string) ([]entity.Seat, error) {
+	var seats []entity.Seat
+	err := r.lock(ctx, r.db.With(ctx).
+		Select().
+		From("seat").
+		Where(dbx.And(dbx.HashExp{"flight_id": flightID}, dbx.In("number", values(numbers)...))).
+		OrderBy("number"), "FOR UPDATE").
+		All(&seats)
+	return seats, err
+}
+
+// UpdateSeats saves the status and the booking of the seats in the database
+// and counts the held or booked seats of the flight again.
+func (r repository) UpdateSeats(ctx context.Context, flightID string, numbers []string, status string, bookingID *string) error {
+	if _, err := r.db.With(ctx).Update("seat",
+		dbx.Params{"status": status, "booking_id": bookingID},
+		dbx.And(dbx.HashExp{"flight_id": flightID}, dbx.In("number", values(numbers)...)),
+	).Execute(); err != nil {
+		return err
+	}
+	_, err := r.db.With(ctx).Update("flight", dbx.Params{
+		"taken_seats": dbx.NewExp("(SELECT COUNT(*) FROM seat WHERE seat.flight_id=flight.id AND seat.status<>'available')"),
+		"version":     dbx.NewExp("version+1"),
+	}, dbx.HashExp{"id": flightID}).Execute()
+	return err
+}
+
+// lock builds the SELECT query with the given locking clause.
+func (r repository) lock(ctx context.Context, q *dbx.SelectQuery, clause string) *dbx.Query {
+	query := q.Build()
+	return r.db.With(ctx).NewQuery(query.SQL() + " " + clause).Bind(query.Params())
+}
+
+// values converts the strings into the values of an IN expression.
+func values(s []string) []interface{} {
+	result := make([]interface{}, len(s))
+	for i, v := range s {
+		result[i] = v
+	}
+	return result
+}
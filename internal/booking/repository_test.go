@@ -0,0 +1,123 @@
+package booking
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/nvnoskov/dynamo-backend/internal/aircraft"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "booking", "seat", "flight", "aircraft")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+
+	// a flight with the seats 1A to 2C
+	assert.Nil(t, db.DB().Model(&entity.Aircraft{
+		ID:        "a320",
+		Name:      "A320",
+		Cabins:    entity.Cabins{{Class: entity.CabinEconomy, FirstRow: 1, LastRow: 2, Letters: "ABC"}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}).Insert())
+	aircraftID := "a320"
+	flight := entity.Flight{ID: "f1", Name: "flight1", Number: "F1", Departure: "MSQ", Destination: "ARN",
+		AircraftID: &aircraftID, Version: 1, Status: entity.FlightScheduled, CreatedAt: now, UpdatedAt: now}
+	flight.SetTimes(now.Add(48*time.Hour), now.Add(50*time.Hour))
+	flight.SetFare(entity.Money{Amount: 10000, Currency: "EUR"})
+	assert.Nil(t, db.DB().Model(&flight).Insert())
+	assert.Nil(t, aircraft.NewRepository(db, logger).GenerateSeats(ctx, "f1"))
+
+	// create
+	expiresAt := now.Add(-time.Minute)
+	booking := entity.Booking{ID: "b1", UserID: "100", FlightID: "f1", Seats: entity.SeatNumbers{"1A", "2C"},
+		Status: entity.BookingHeld, ExpiresAt: &expiresAt, CreatedAt: now, UpdatedAt: now}
+	assert.Nil(t, repo.Create(ctx, booking))
+	count, err := repo.Count(ctx, "100")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	count, _ = repo.Count(ctx, "200")
+	assert.Equal(t, 0, count)
+
+	// get
+	booking, err = repo.Get(ctx, "b1")
+	assert.Nil(t, err)
+	assert.Equal(t, entity.SeatNumbers{"1A", "2C"}, booking.Seats)
+	_, err = repo.Get(ctx, "b0")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// query
+	bookings, err := repo.Query(ctx, "100", 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(bookings))
+
+	// locks within a transaction
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		flight, err := repo.LockFlight(ctx, "f1")
+		assert.Nil(t, err)
+		assert.Equal(t, "F1", flight.Number)
+		_, err = repo.LockFlight(ctx, "f0")
+		assert.Equal(t, sql.ErrNoRows, err)
+
+		seats, err := repo.LockSeats(ctx, "f1", []string{"2C", "1A", "9A"})
+		assert.Nil(t, err)
+		if assert.Equal(t, 2, len(seats)) {
+			assert.Equal(t, "1A", seats[0].Number)
+			assert.Equal(t, entity.SeatAvailable, seats[0].Status)
+		}
+		assert.Nil(t, repo.UpdateSeats(ctx, "f1", []string{"1A", "2C"}, entity.SeatHeld, &booking.ID))
+
+		booking, err := repo.Lock(ctx, "b1")
+		assert.Nil(t, err)
+		assert.Equal(t, "100", booking.UserID)
+
+		expired, err := repo.LockExpired(ctx, now)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(expired))
+		expired, _ = repo.LockExpired(ctx, now.Add(-time.Hour))
+		assert.Equal(t, 0, len(expired))
+		expired, _ = repo.LockExpired(ctx, now, "b1")
+		assert.Equal(t, 1, len(expired))
+		expired, _ = repo.LockExpired(ctx, now, "b2")
+		assert.Equal(t, 0, len(expired))
+		return nil
+	})
+	assert.Nil(t, err)
+	seats, _ := repo.LockSeats(ctx, "f1", []string{"1A"})
+	if assert.Equal(t, 1, len(seats)) {
+		assert.Equal(t, entity.SeatHeld, seats[0].Status)
+		assert.Equal(t, "b1", *seats[0].BookingID)
+	}
+	assert.Nil(t, db.DB().Select().Model("f1", &flight))
+	assert.Equal(t, 2, flight.TakenSeats)
+	assert.Equal(t, 2, flight.Version)
+
+	// held seats can't be generated again
+	assert.Equal(t, aircraft.ErrSeatsTaken, aircraft.NewRepository(db, logger).GenerateSeats(ctx, "f1"))
+
+	// update
+	booking.Status = entity.BookingCancelled
+	booking.ExpiresAt = nil
+	assert.Nil(t, repo.Update(ctx, booking))
+	assert.Nil(t, repo.UpdateSeats(ctx, "f1", []string{"1A", "2C"}, entity.SeatAvailable, nil))
+	booking, _ = repo.Get(ctx, "b1")
+	assert.Equal(t, entity.BookingCancelled, booking.Status)
+	assert.Nil(t, booking.ExpiresAt)
+	seats, _ = repo.LockSeats(ctx, "f1", []string{"1A"})
+	if assert.Equal(t, 1, len(seats)) {
+		assert.Equal(t, entity.SeatAvailable, seats[0].Status)
+		assert.Nil(t, seats[0].BookingID)
+	}
+	assert.Nil(t, db.DB().Select().Model("f1", &flight))
+	assert.Equal(t, 0, flight.TakenSeats)
+}
@@ -0,0 +1,348 @@
+package booking
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/claim"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/dbcontext"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+// maxSeats is the largest number of seats of a booking.
+const maxSeats = 9
+
+// Service encapsulates usecase logic for bookings.
+// The bookings are those of the current user.
+type Service interface {
+	Get(ctx context.Context, id string) (Booking, error)
+	Query(ctx context.Context, offset, limit int) ([]Booking, error)
+	Count(ctx context.Context) (int, error)
+	Hold(ctx context.Context, input HoldRequest) (Booking, error)
+	Confirm(ctx context.Context, id string) (Booking, error)
+	Cancel(ctx context.Context, id string) (Booking, error)
+	Expire(ctx context.Context) (int, error)
+}
+
+// Booking represents the data about a booking.
+type Booking struct {
+	entity.Booking
+}
+
+// HoldRequest represents a request to hold seats of a flight.
+type HoldRequest struct {
+	FlightID string   `json:"flight_id"` // ID of the flight
+	Seats    []string `json:"seats"`     // numbers of the seats, e.g. ["12A", "12B"]
+}
+
+var seatRegex = regexp.MustCompile(`^[1-9]\d?[A-K]$`)
+
+// Validate validates the HoldRequest fields.
+func (m HoldRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.FlightID, validation.Required),
+		validation.Field(&m.Seats, validation.Required, validation.Length(0, maxSeats),
+			validation.Each(validation.Match(seatRegex).Error("must be a seat number, e.g. 12A")),
+			validation.By(validateDistinct)),
+	)
+}
+
+// validateDistinct checks that no seat number is repeated.
+func validateDistinct(value interface{}) error {
+	seats, _ := value.([]string)
+	seen := map[string]bool{}
+	for _, seat := range seats {
+		if seen[seat] {
+			return validation.NewError("validation_seats_distinct", "must not repeat a seat")
+		}
+		seen[seat] = true
+	}
+	return nil
+}
+
+type service struct {
+	repo          Repository
+	transactional dbcontext.TransactionFunc
+	claims        claim.Service
+	holdTTL       time.Duration
+	logger        log.Logger
+}
+
+// NewService creates a new booking service.
+// The seats are allocated in the transactions started by transactional, e.g. dbcontext.DB.Transactional.
+// The seats released by the bookings go to the seat claims waiting for the capacity of the flight.
+// A hold of seats ends after holdTTL unless the booking is confirmed.
+func NewService(repo Repository, transactional dbcontext.TransactionFunc, claims claim.Service, holdTTL time.Duration,
+	logger log.Logger) Service {
+	return service{repo, transactional, claims, holdTTL, logger}
+}
+
+// Get returns the booking of the current user with the specified booking ID.
+func (s service) Get(ctx context.Context, id string) (Booking, error) {
+	booking, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Booking{}, err
+	}
+	if booking.UserID != currentUserID(ctx) {
+		return Booking{}, sql.ErrNoRows
+	}
+	return Booking{booking}, nil
+}
+
+// Count returns the number of bookings of the current user.
+func (s service) Count(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx, currentUserID(ctx))
+}
+
+// Query returns the bookings of the current user with the specified offset and limit.
+func (s service) Query(ctx context.Context, offset, limit int) ([]Booking, error) {
+	items, err := s.repo.Query(ctx, currentUserID(ctx), offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Booking{}
+	for _, item := range items {
+		result = append(result, Booking{item})
+	}
+	return result, nil
+}
+
+// Hold holds the seats of a flight for the current user until the end of the hold.
+// The seats are locked while they are checked, so that two users can't hold the same seat,
+// and the flight is locked, so that the held and claimed seats can't exceed its capacity together.
+func (s service) Hold(ctx context.Context, req HoldRequest) (Booking, error) {
+	if err := req.Validate(); err != nil {
+		return Booking{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(s.holdTTL)
+	booking := entity.Booking{
+		ID:        entity.GenerateID(),
+		UserID:    currentUserID(ctx),
+		FlightID:  req.FlightID,
+		Seats:     req.Seats,
+		Status:    entity.BookingHeld,
+		ExpiresAt: &expiresAt,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		flight, err := s.repo.LockFlight(ctx, req.FlightID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return validation.Errors{"flight_id": validation.NewError("validation_flight", "must be a known flight")}
+		} else if err != nil {
+			return err
+		}
+		if !bookable(flight, now) {
+			return ErrFlightClosed
+		}
+		seats, err := s.repo.LockSeats(ctx, flight.ID, req.Seats)
+		if err != nil {
+			return err
+		}
+		if len(seats) < len(req.Seats) {
+			return validation.Errors{"seats": validation.NewError("validation_seats", "must be seats of the flight")}
+		}
+		// the seats of the holds that have ended can be held again
+		released, err := s.expireSeats(ctx, seats, now)
+		if err != nil {
+			return err
+		}
+		for _, seat := range seats {
+			if seat.Status != entity.SeatAvailable && (seat.BookingID == nil || !released[*seat.BookingID]) {
+				return ErrSeatTaken
+			}
+		}
+		// the seats held or booked and the seats claimed share the capacity of the flight
+		if len(released) > 0 {
+			if flight, err = s.repo.LockFlight(ctx, flight.ID); err != nil {
+				return err
+			}
+		}
+		if len(req.Seats) > flight.BookableSeats() {
+			return ErrSoldOut
+		}
+		if err := s.repo.Create(ctx, booking); err != nil {
+			return err
+		}
+		if err := s.repo.UpdateSeats(ctx, flight.ID, req.Seats, entity.SeatHeld, &booking.ID); err != nil {
+			return err
+		}
+		// the ended holds may have freed more seats than the booking holds
+		if len(released) > 0 {
+			return s.claims.Promote(ctx, flight.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return Booking{}, err
+	}
+	return Booking{booking}, nil
+}
+
+// bookable reports whether the seats of the flight can be held at the given time.
+func bookable(flight entity.Flight, now time.Time) bool {
+	return (flight.Status == entity.FlightScheduled || flight.Status == entity.FlightDelayed) &&
+		flight.DepartureTime.After(now)
+}
+
+// Confirm books the held seats of the booking of the current user with the specified ID.
+// A conflict error is returned if the booking is not held or its hold has ended.
+func (s service) Confirm(ctx context.Context, id string) (Booking, error) {
+	now := time.Now()
+	var booking entity.Booking
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		var err error
+		if booking, err = s.lock(ctx, id); err != nil {
+			return err
+		}
+		if booking.Status != entity.BookingHeld {
+			return errStatus("confirm", booking.Status)
+		}
+		if booking.Expired(now) {
+			return ErrHoldExpired
+		}
+		if err := s.repo.UpdateSeats(ctx, booking.FlightID, booking.Seats, entity.SeatBooked, &booking.ID); err != nil {
+			return err
+		}
+		booking.Status = entity.BookingConfirmed
+		booking.ExpiresAt = nil
+		booking.UpdatedAt = now
+		return s.repo.Update(ctx, booking)
+	})
+	if err != nil {
+		return Booking{}, err
+	}
+	return Booking{booking}, nil
+}
+
+// Cancel cancels the held or confirmed booking of the current user with the specified ID and releases its seats.
+// The released seats go to the seat claims waiting for the flight.
+func (s service) Cancel(ctx context.Context, id string) (Booking, error) {
+	now := time.Now()
+	var booking entity.Booking
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		var err error
+		if booking, err = s.lock(ctx, id); err != nil {
+			return err
+		}
+		if booking.Status != entity.BookingHeld && booking.Status != entity.BookingConfirmed {
+			return errStatus("cancel", booking.Status)
+		}
+		if err := s.repo.UpdateSeats(ctx, booking.FlightID, booking.Seats, entity.SeatAvailable, nil); err != nil {
+			return err
+		}
+		booking.Status = entity.BookingCancelled
+		booking.ExpiresAt = nil
+		booking.UpdatedAt = now
+		if err := s.repo.Update(ctx, booking); err != nil {
+			return err
+		}
+		return s.claims.Promote(ctx, booking.FlightID)
+	})
+	if err != nil {
+		return Booking{}, err
+	}
+	return Booking{booking}, nil
+}
+
+// lock locks the booking of the current user with the specified ID within the transaction.
+func (s service) lock(ctx context.Context, id string) (entity.Booking, error) {
+	booking, err := s.repo.Lock(ctx, id)
+	if err != nil {
+		return booking, err
+	}
+	if booking.UserID != currentUserID(ctx) {
+		return booking, sql.ErrNoRows
+	}
+	return booking, nil
+}
+
+// Expire releases the seats of the bookings of all users whose hold has ended.
+// The released seats go to the seat claims waiting for the flights.
+// It returns the number of the bookings expired.
+func (s service) Expire(ctx context.Context) (int, error) {
+	now := time.Now()
+	count := 0
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		bookings, err := s.repo.LockExpired(ctx, now)
+		if err != nil {
+			return err
+		}
+		var flightIDs []string
+		promoted := map[string]bool{}
+		for _, booking := range bookings {
+			if err := s.expire(ctx, booking, now); err != nil {
+				return err
+			}
+			if !promoted[booking.FlightID] {
+				promoted[booking.FlightID] = true
+				flightIDs = append(flightIDs, booking.FlightID)
+			}
+		}
+		for _, flightID := range flightIDs {
+			if err := s.claims.Promote(ctx, flightID); err != nil {
+				return err
+			}
+		}
+		count = len(bookings)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		s.logger.With(ctx).Infof("expired %v seat holds", count)
+	}
+	return count, nil
+}
+
+// expireSeats expires the holds of the locked seats that have ended within the transaction.
+// The holds being expired by another transaction are skipped. It returns the IDs of the bookings expired.
+func (s service) expireSeats(ctx context.Context, seats []entity.Seat, now time.Time) (map[string]bool, error) {
+	var ids []string
+	for _, seat := range seats {
+		if seat.Status == entity.SeatHeld && seat.BookingID != nil {
+			ids = append(ids, *seat.BookingID)
+		}
+	}
+	released := map[string]bool{}
+	if len(ids) == 0 {
+		return released, nil
+	}
+	bookings, err := s.repo.LockExpired(ctx, now, ids...)
+	if err != nil {
+		return nil, err
+	}
+	for _, booking := range bookings {
+		if err := s.expire(ctx, booking, now); err != nil {
+			return nil, err
+		}
+		released[booking.ID] = true
+	}
+	return released, nil
+}
+
+// expire releases the seats of the locked booking whose hold has ended and marks it as expired.
+func (s service) expire(ctx context.Context, booking entity.Booking, now time.Time) error {
+	if err := s.repo.UpdateSeats(ctx, booking.FlightID, booking.Seats, entity.SeatAvailable, nil); err != nil {
+		return err
+	}
+	booking.Status = entity.BookingExpired
+	booking.UpdatedAt = now
+	return s.repo.Update(ctx, booking)
+}
+
+// currentUserID returns the ID of the user in the context, or an empty string if there is none.
+func currentUserID(ctx context.Context) string {
+	if user := auth.CurrentUser(ctx); user != nil {
+		return user.GetID()
+	}
+	return ""
+}
@@ -0,0 +1,317 @@
+package booking
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/claim"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHoldRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     HoldRequest
+		wantError bool
+	}{
+		{"success", HoldRequest{FlightID: "f1", Seats: []string{"1A", "12C"}}, false},
+		{"required", HoldRequest{}, true},
+		{"no seats", HoldRequest{FlightID: "f1", Seats: []string{}}, true},
+		{"invalid seat", HoldRequest{FlightID: "f1", Seats: []string{"1Z"}}, true},
+		{"repeated seat", HoldRequest{FlightID: "f1", Seats: []string{"1A", "1A"}}, true},
+		{"too many seats", HoldRequest{FlightID: "f1", Seats: []string{"1A", "1B", "1C", "1D", "1E", "1F", "2A", "2B", "2C", "2D"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_Hold(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := newMockRepository()
+	s := NewService(repo, mockTransactional, &claim.MockService{}, 15*time.Minute, logger)
+
+	tester := auth.WithUser(context.Background(), "100", "Tester")
+	other := auth.WithUser(context.Background(), "200", "Other")
+
+	// initial count
+	count, _ := s.Count(tester)
+	assert.Equal(t, 0, count)
+
+	// successful hold
+	booking, err := s.Hold(tester, HoldRequest{FlightID: "f1", Seats: []string{"1A", "1C"}})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, booking.ID)
+	id := booking.ID
+	assert.Equal(t, "100", booking.UserID)
+	assert.Equal(t, entity.BookingHeld, booking.Status)
+	if assert.NotNil(t, booking.ExpiresAt) {
+		assert.WithinDuration(t, time.Now().Add(15*time.Minute), *booking.ExpiresAt, time.Minute)
+	}
+	assert.Equal(t, entity.SeatHeld, repo.seats["f1/1A"].Status)
+	assert.Equal(t, id, *repo.seats["f1/1A"].BookingID)
+	count, _ = s.Count(tester)
+	assert.Equal(t, 1, count)
+
+	// the held seats can't be held again
+	_, err = s.Hold(other, HoldRequest{FlightID: "f1", Seats: []string{"1C", "1D"}})
+	assert.Equal(t, ErrSeatTaken, err)
+	assert.Equal(t, entity.SeatAvailable, repo.seats["f1/1D"].Status)
+
+	// validation errors
+	_, err = s.Hold(tester, HoldRequest{FlightID: "f1"})
+	assert.NotNil(t, err)
+	_, err = s.Hold(tester, HoldRequest{FlightID: "none", Seats: []string{"1A"}})
+	assert.NotNil(t, err)
+	_, err = s.Hold(tester, HoldRequest{FlightID: "f1", Seats: []string{"9A"}})
+	assert.NotNil(t, err)
+
+	// the flight must be open for booking
+	_, err = s.Hold(tester, HoldRequest{FlightID: "cancelled", Seats: []string{"1A"}})
+	assert.Equal(t, ErrFlightClosed, err)
+
+	// get
+	_, err = s.Get(tester, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Get(other, id)
+	assert.Equal(t, sql.ErrNoRows, err)
+	booking, err = s.Get(tester, id)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.SeatNumbers{"1A", "1C"}, booking.Seats)
+
+	// query
+	bookings, _ := s.Query(tester, 0, 10)
+	assert.Equal(t, 1, len(bookings))
+	bookings, _ = s.Query(other, 0, 10)
+	assert.Equal(t, 0, len(bookings))
+}
+
+func Test_service_Confirm(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := newMockRepository()
+	claims := &claim.MockService{}
+	s := NewService(repo, mockTransactional, claims, 15*time.Minute, logger)
+	tester := auth.WithUser(context.Background(), "100", "Tester")
+	other := auth.WithUser(context.Background(), "200", "Other")
+
+	booking, err := s.Hold(tester, HoldRequest{FlightID: "f1", Seats: []string{"1A"}})
+	assert.Nil(t, err)
+	id := booking.ID
+	assert.Empty(t, claims.Promoted)
+
+	_, err = s.Confirm(other, id)
+	assert.Equal(t, sql.ErrNoRows, err)
+	booking, err = s.Confirm(tester, id)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.BookingConfirmed, booking.Status)
+	assert.Nil(t, booking.ExpiresAt)
+	assert.Equal(t, entity.SeatBooked, repo.seats["f1/1A"].Status)
+	_, err = s.Confirm(tester, id)
+	assert.NotNil(t, err)
+
+	// cancelling releases the seats
+	_, err = s.Cancel(other, id)
+	assert.Equal(t, sql.ErrNoRows, err)
+	booking, err = s.Cancel(tester, id)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.BookingCancelled, booking.Status)
+	assert.Equal(t, entity.SeatAvailable, repo.seats["f1/1A"].Status)
+	assert.Nil(t, repo.seats["f1/1A"].BookingID)
+	// and promotes the seat claims waiting for the flight
+	assert.Equal(t, []string{"f1"}, claims.Promoted)
+	_, err = s.Cancel(tester, id)
+	assert.NotNil(t, err)
+	_, err = s.Confirm(tester, id)
+	assert.NotNil(t, err)
+}
+
+func Test_service_Hold_capacity(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := newMockRepository()
+	s := NewService(repo, mockTransactional, &claim.MockService{}, 15*time.Minute, logger)
+	tester := auth.WithUser(context.Background(), "100", "Tester")
+
+	// the seats claimed count against the capacity
+	flight := repo.flights["f1"]
+	flight.ClaimedSeats = 2
+	repo.flights["f1"] = flight
+	_, err := s.Hold(tester, HoldRequest{FlightID: "f1", Seats: []string{"1A", "1C", "1D"}})
+	assert.Equal(t, ErrSoldOut, err)
+	assert.Equal(t, entity.SeatAvailable, repo.seats["f1/1A"].Status)
+	_, err = s.Hold(tester, HoldRequest{FlightID: "f1", Seats: []string{"1A"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, repo.flights["f1"].TakenSeats)
+
+	// and so do the seats held
+	_, err = s.Hold(tester, HoldRequest{FlightID: "f1", Seats: []string{"1C", "1D"}})
+	assert.Equal(t, ErrSoldOut, err)
+	_, err = s.Hold(tester, HoldRequest{FlightID: "f1", Seats: []string{"1C"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, repo.flights["f1"].BookableSeats())
+}
+
+func Test_service_Expire(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := newMockRepository()
+	claims := &claim.MockService{}
+	s := NewService(repo, mockTransactional, claims, -time.Minute, logger)
+	tester := auth.WithUser(context.Background(), "100", "Tester")
+
+	// a hold that has ended can't be confirmed
+	booking, err := s.Hold(tester, HoldRequest{FlightID: "f1", Seats: []string{"1A"}})
+	assert.Nil(t, err)
+	_, err = s.Confirm(tester, booking.ID)
+	assert.Equal(t, ErrHoldExpired, err)
+
+	// expiring releases the seats
+	count, err := s.Expire(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, entity.BookingExpired, repo.bookings[booking.ID].Status)
+	assert.Equal(t, entity.SeatAvailable, repo.seats["f1/1A"].Status)
+	assert.Equal(t, []string{"f1"}, claims.Promoted)
+
+	// the seats of an ended hold can be held again
+	_, err = s.Hold(tester, HoldRequest{FlightID: "f1", Seats: []string{"1C"}})
+	assert.Nil(t, err)
+	_, err = s.Hold(tester, HoldRequest{FlightID: "f1", Seats: []string{"1C"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"f1", "f1"}, claims.Promoted)
+
+	// holding seats leaves the ended holds of the other seats to Expire
+	other, _ := s.Hold(tester, HoldRequest{FlightID: "f1", Seats: []string{"1D"}})
+	_, err = s.Hold(tester, HoldRequest{FlightID: "f1", Seats: []string{"1A"}})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.BookingHeld, repo.bookings[other.ID].Status)
+	count, _ = s.Expire(context.Background())
+	assert.Equal(t, 3, count)
+}
+
+// mockTransactional runs the function without a transaction.
+func mockTransactional(ctx context.Context, f func(ctx context.Context) error) error {
+	return f(ctx)
+}
+
+type mockRepository struct {
+	flights  map[string]entity.Flight
+	seats    map[string]entity.Seat
+	bookings map[string]entity.Booking
+}
+
+// newMockRepository creates a mock repository with the seats 1A, 1C, 1D and 1F of an open and a cancelled flight.
+func newMockRepository() *mockRepository {
+	m := &mockRepository{
+		flights: map[string]entity.Flight{
+			"f1":        {ID: "f1", Status: entity.FlightScheduled, DepartureTime: time.Now().Add(48 * time.Hour), Capacity: 4},
+			"cancelled": {ID: "cancelled", Status: entity.FlightCancelled, DepartureTime: time.Now().Add(48 * time.Hour), Capacity: 4},
+		},
+		seats:    map[string]entity.Seat{},
+		bookings: map[string]entity.Booking{},
+	}
+	for id := range m.flights {
+		for _, letter := range []string{"A", "C", "D", "F"} {
+			m.seats[id+"/1"+letter] = entity.Seat{FlightID: id, Number: "1" + letter, Cabin: entity.CabinEconomy,
+				Row: 1, Letter: letter, Status: entity.SeatAvailable}
+		}
+	}
+	return m
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.Booking, error) {
+	if booking, ok := m.bookings[id]; ok {
+		return booking, nil
+	}
+	return entity.Booking{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context, userID string) (int, error) {
+	items, _ := m.Query(ctx, userID, 0, 0)
+	return len(items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, userID string, offset, limit int) ([]entity.Booking, error) {
+	var items []entity.Booking
+	for _, booking := range m.bookings {
+		if booking.UserID == userID {
+			items = append(items, booking)
+		}
+	}
+	return items, nil
+}
+
+func (m mockRepository) Create(ctx context.Context, booking entity.Booking) error {
+	m.bookings[booking.ID] = booking
+	return nil
+}
+
+func (m mockRepository) Update(ctx context.Context, booking entity.Booking) error {
+	m.bookings[booking.ID] = booking
+	return nil
+}
+
+func (m mockRepository) Lock(ctx context.Context, id string) (entity.Booking, error) {
+	return m.Get(ctx, id)
+}
+
+func (m mockRepository) LockExpired(ctx context.Context, now time.Time, ids ...string) ([]entity.Booking, error) {
+	var items []entity.Booking
+	for _, booking := range m.bookings {
+		if booking.Expired(now) && (len(ids) == 0 || contains(ids, booking.ID)) {
+			items = append(items, booking)
+		}
+	}
+	return items, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (m mockRepository) LockFlight(ctx context.Context, id string) (entity.Flight, error) {
+	if flight, ok := m.flights[id]; ok {
+		return flight, nil
+	}
+	return entity.Flight{}, sql.ErrNoRows
+}
+
+func (m mockRepository) LockSeats(ctx context.Context, flightID string, numbers []string) ([]entity.Seat, error) {
+	var seats []entity.Seat
+	for _, number := range numbers {
+		if seat, ok := m.seats[flightID+"/"+number]; ok {
+			seats = append(seats, seat)
+		}
+	}
+	return seats, nil
+}
+
+func (m mockRepository) UpdateSeats(ctx context.Context, flightID string, numbers []string, status string, bookingID *string) error {
+	for _, number := range numbers {
+		if seat, ok := m.seats[flightID+"/"+number]; ok {
+			seat.Status, seat.BookingID = status, bookingID
+			m.seats[flightID+"/"+number] = seat
+		}
+	}
+	flight := m.flights[flightID]
+	flight.TakenSeats = 0
+	for _, seat := range m.seats {
+		if seat.FlightID == flightID && seat.Status != entity.SeatAvailable {
+			flight.TakenSeats++
+		}
+	}
+	flight.Version++
+	m.flights[flightID] = flight
+	return nil
+}
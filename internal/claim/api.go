@@ -0,0 +1,74 @@
+package claim
+
+import (
+	"net/http"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/nvnoskov/dynamo-backend/internal/errors"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/nvnoskov/dynamo-backend/pkg/pagination"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	// the following endpoints require a valid JWT
+	r.Use(authHandler)
+	r.Get("/flights/<id>/claims/<claim>", res.get)
+	r.Get("/flights/<id>/claims", res.query)
+	r.Post("/flights/<id>/claims", res.create)
+	r.Delete("/flights/<id>/claims/<claim>", res.release)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) get(c *routing.Context) error {
+	claim, err := r.service.Get(c.Request.Context(), c.Param("id"), c.Param("claim"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(claim)
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	claims, err := r.service.Query(ctx, c.Param("id"), pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = claims
+	return c.Write(pages)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input CreateClaimRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	claim, err := r.service.Create(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(claim, http.StatusCreated)
+}
+
+func (r resource) release(c *routing.Context) error {
+	claim, err := r.service.Release(c.Request.Context(), c.Param("id"), c.Param("claim"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(claim)
+}
@@ -0,0 +1,48 @@
+package claim
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := newMockRepository()
+	ctx := context.Background()
+	repo.Create(ctx, entity.SeatClaim{ID: "123", FlightID: "f1", UserID: "100", Seats: 5,
+		Status: entity.ClaimClaimed, CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	repo.Create(ctx, entity.SeatClaim{ID: "456", FlightID: "f1", UserID: "200", Seats: 1,
+		Status: entity.ClaimClaimed, CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	repo.UpdateClaimedSeats(ctx, "f1", 6)
+	RegisterHandlers(router.Group(""), NewService(repo, mockTransactional, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"get all", "GET", "/flights/f1/claims", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get 123", "GET", "/flights/f1/claims/123", "", header, http.StatusOK, `*"seats":5*`},
+		{"get other user", "GET", "/flights/f1/claims/456", "", header, http.StatusNotFound, ""},
+		{"get unknown", "GET", "/flights/f1/claims/1234", "", header, http.StatusNotFound, ""},
+		{"create waitlisted", "POST", "/flights/f1/claims", `{"seats":2}`, header, http.StatusCreated, `*"position":1*`},
+		{"create count", "GET", "/flights/f1/claims", "", header, http.StatusOK, `*"total_count":2*`},
+		{"create unknown flight", "POST", "/flights/none/claims", `{"seats":2}`, header, http.StatusNotFound, ""},
+		{"create closed", "POST", "/flights/cancelled/claims", `{"seats":2}`, header, http.StatusConflict, ""},
+		{"create auth error", "POST", "/flights/f1/claims", `{"seats":2}`, nil, http.StatusUnauthorized, ""},
+		{"create input error", "POST", "/flights/f1/claims", `"seats":2}`, header, http.StatusBadRequest, ""},
+		{"create validation error", "POST", "/flights/f1/claims", `{"seats":10}`, header, http.StatusBadRequest, `*"field":"seats"*`},
+		{"release ok", "DELETE", "/flights/f1/claims/123", "", header, http.StatusOK, `*"status":"released"*`},
+		{"release again", "DELETE", "/flights/f1/claims/123", "", header, http.StatusConflict, ""},
+		{"release other user", "DELETE", "/flights/f1/claims/456", "", header, http.StatusNotFound, ""},
+		{"release auth error", "DELETE", "/flights/f1/claims/456", "", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
@@ -0,0 +1,41 @@
+package claim
+
+import (
+	"context"
+)
+
+// MockService is a seat claim service for testing purpose, which records the flights whose waitlists are promoted.
+type MockService struct {
+	Promoted []string // IDs of the flights passed to Promote
+}
+
+// Get returns no claim.
+func (m *MockService) Get(ctx context.Context, flightID, id string) (Claim, error) {
+	return Claim{}, nil
+}
+
+// Query returns no claims.
+func (m *MockService) Query(ctx context.Context, flightID string, offset, limit int) ([]Claim, error) {
+	return nil, nil
+}
+
+// Count returns zero.
+func (m *MockService) Count(ctx context.Context, flightID string) (int, error) {
+	return 0, nil
+}
+
+// Create claims nothing.
+func (m *MockService) Create(ctx context.Context, flightID string, input CreateClaimRequest) (Claim, error) {
+	return Claim{}, nil
+}
+
+// Release releases nothing.
+func (m *MockService) Release(ctx context.Context, flightID, id string) (Claim, error) {
+	return Claim{}, nil
+}
+
+// Promote records the flight ID.
+func (m *MockService) Promote(ctx context.Context, flightID string) error {
+	m.Promoted = append(m.Promoted, flightID)
+	return nil
+}
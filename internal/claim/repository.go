@@ -0,0 +1,112 @@
+package claim
+
+import (
+	"context"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/dbcontext"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+// Repository encapsulates the logic to access seat claims and the capacity of flights from the data source.
+type Repository interface {
+	// Get returns the seat claim with the specified claim ID.
+	Get(ctx context.Context, id string) (entity.SeatClaim, error)
+	// Count returns the number of seat claims of the user on the flight.
+	Count(ctx context.Context, flightID, userID string) (int, error)
+	// Query returns the seat claims of the user on the flight with the given offset and limit, the earliest first.
+	Query(ctx context.Context, flightID, userID string, offset, limit int) ([]entity.SeatClaim, error)
+	// Waitlist returns the waitlisted seat claims of the flight, the earliest first.
+	Waitlist(ctx context.Context, flightID string) ([]entity.SeatClaim, error)
+	// Create saves a new seat claim in the storage.
+	Create(ctx context.Context, claim entity.SeatClaim) error
+	// Update updates the seat claim with given ID in the storage.
+	Update(ctx context.Context, claim entity.SeatClaim) error
+	// LockFlight returns the flight with the specified ID and locks it until the end of the transaction,
+	// so that the seat claims of the flight are changed one transaction at a time.
+	LockFlight(ctx context.Context, id string) (entity.Flight, error)
+	// UpdateClaimedSeats sets the number of the claimed seats of the flight and increments its version.
+	UpdateClaimedSeats(ctx context.Context, flightID string, seats int) error
+}
+
+// repository persists seat claims in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new seat claim repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the seat claim with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.SeatClaim, error) {
+	var claim entity.SeatClaim
+	err := r.db.With(ctx).Select().Model(id, &claim)
+	return claim, err
+}
+
+// Count returns the number of the seat claim records of the user on the flight in the database.
+func (r repository) Count(ctx context.Context, flightID, userID string) (int, error) {
+	var count int
+	err := r.db.With(ctx).
+		Select("COUNT(*)").
+		From("seat_claim").
+		Where(dbx.HashExp{"flight_id": flightID, "user_id": userID}).
+		Row(&count)
+	return count, err
+}
+
+// Query retrieves the seat claim records of the user on the flight with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, flightID, userID string, offset, limit int) ([]entity.SeatClaim, error) {
+	var claims []entity.SeatClaim
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"flight_id": flightID, "user_id": userID}).
+		OrderBy("created_at", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&claims)
+	return claims, err
+}
+
+// Waitlist retrieves the waitlisted seat claim records of the flight from the database in the order they were made.
+func (r repository) Waitlist(ctx context.Context, flightID string) ([]entity.SeatClaim, error) {
+	var claims []entity.SeatClaim
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"flight_id": flightID, "status": entity.ClaimWaitlisted}).
+		OrderBy("created_at", "id").
+		All(&claims)
+	return claims, err
+}
+
+// Create saves a new seat claim record in the database.
+func (r repository) Create(ctx context.Context, claim entity.SeatClaim) error {
+	return r.db.With(ctx).Model(&claim).Insert()
+}
+
+// Update saves the changes to a seat claim in the database.
+func (r repository) Update(ctx context.Context, claim entity.SeatClaim) error {
+	return r.db.With(ctx).Model(&claim).Update()
+}
+
+// LockFlight reads the flight with the specified ID from the database with SELECT ... FOR UPDATE.
+func (r repository) LockFlight(ctx context.Context, id string) (entity.Flight, error) {
+	var flight entity.Flight
+	query := r.db.With(ctx).Select().From("flight").Where(dbx.HashExp{"id": id}).Build()
+	err := r.db.With(ctx).NewQuery(query.SQL() + " FOR UPDATE").Bind(query.Params()).One(&flight)
+	return flight, err
+}
+
+// UpdateClaimedSeats saves the number of the claimed seats of the flight in the database.
+// The flight version is incremented so that the cached representations of the flight become stale.
+func (r repository) UpdateClaimedSeats(ctx context.Context, flightID string, seats int) error {
+	_, err := r.db.With(ctx).Update("flight", dbx.Params{
+		"claimed_seats": seats,
+		"version":       dbx.NewExp("version+1"),
+	}, dbx.HashExp{"id": flightID}).Execute()
+	return err
+}
@@ -0,0 +1,78 @@
+package claim
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "seat_claim", "flight")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+
+	flight := entity.Flight{ID: "f1", Name: "flight1", Number: "F1", Departure: "MSQ", Destination: "ARN",
+		Version: 1, Status: entity.FlightScheduled, Capacity: 4, CreatedAt: now, UpdatedAt: now}
+	flight.SetTimes(now.Add(48*time.Hour), now.Add(50*time.Hour))
+	flight.SetFare(entity.Money{Amount: 10000, Currency: "EUR"})
+	assert.Nil(t, db.DB().Model(&flight).Insert())
+
+	// create
+	assert.Nil(t, repo.Create(ctx, entity.SeatClaim{ID: "c1", FlightID: "f1", UserID: "100", Seats: 4,
+		Status: entity.ClaimClaimed, CreatedAt: now, UpdatedAt: now}))
+	assert.Nil(t, repo.Create(ctx, entity.SeatClaim{ID: "c2", FlightID: "f1", UserID: "100", Seats: 2,
+		Status: entity.ClaimWaitlisted, CreatedAt: now.Add(time.Second), UpdatedAt: now}))
+	count, err := repo.Count(ctx, "f1", "100")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	count, _ = repo.Count(ctx, "f1", "200")
+	assert.Equal(t, 0, count)
+
+	// get
+	claim, err := repo.Get(ctx, "c1")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, claim.Seats)
+	_, err = repo.Get(ctx, "c0")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// query
+	claims, err := repo.Query(ctx, "f1", "100", 0, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(claims)) {
+		assert.Equal(t, "c1", claims[0].ID)
+	}
+	claims, err = repo.Waitlist(ctx, "f1")
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(claims)) {
+		assert.Equal(t, "c2", claims[0].ID)
+	}
+
+	// lock and update within a transaction
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		flight, err := repo.LockFlight(ctx, "f1")
+		assert.Nil(t, err)
+		assert.Equal(t, 4, flight.Capacity)
+		_, err = repo.LockFlight(ctx, "f0")
+		assert.Equal(t, sql.ErrNoRows, err)
+
+		claim.Status = entity.ClaimReleased
+		assert.Nil(t, repo.Update(ctx, claim))
+		return repo.UpdateClaimedSeats(ctx, "f1", 2)
+	})
+	assert.Nil(t, err)
+	claim, _ = repo.Get(ctx, "c1")
+	assert.Equal(t, entity.ClaimReleased, claim.Status)
+	assert.Nil(t, db.DB().Select().Model("f1", &flight))
+	assert.Equal(t, 2, flight.ClaimedSeats)
+	assert.Equal(t, 2, flight.Version)
+}
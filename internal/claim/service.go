@@ -0,0 +1,263 @@
+package claim
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/errors"
+	"github.com/nvnoskov/dynamo-backend/pkg/dbcontext"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+// maxSeats is the largest number of seats of a claim.
+const maxSeats = 9
+
+// ErrFlightClosed is returned when the flight to claim seats on has departed, is cancelled or has no capacity.
+var ErrFlightClosed = errors.Conflict("the flight is not open for seat claims")
+
+// Service encapsulates usecase logic for seat claims.
+// The claims are those of the current user.
+type Service interface {
+	Get(ctx context.Context, flightID, id string) (Claim, error)
+	Query(ctx context.Context, flightID string, offset, limit int) ([]Claim, error)
+	Count(ctx context.Context, flightID string) (int, error)
+	Create(ctx context.Context, flightID string, input CreateClaimRequest) (Claim, error)
+	Release(ctx context.Context, flightID, id string) (Claim, error)
+	// Promote grants the waitlisted claims of the flight its remaining capacity allows, e.g. after seats were freed.
+	Promote(ctx context.Context, flightID string) error
+}
+
+// Claim represents the data about a seat claim.
+type Claim struct {
+	entity.SeatClaim
+	Position int `json:"position,omitempty"` // position on the waitlist of the flight, starting with 1
+}
+
+// CreateClaimRequest represents a request to claim seats of a flight.
+type CreateClaimRequest struct {
+	Seats int `json:"seats"` // number of seats to claim
+}
+
+// Validate validates the CreateClaimRequest fields.
+func (m CreateClaimRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Seats, validation.Required, validation.Min(1), validation.Max(maxSeats)),
+	)
+}
+
+type service struct {
+	repo          Repository
+	transactional dbcontext.TransactionFunc
+	logger        log.Logger
+}
+
+// NewService creates a new seat claim service.
+// The capacity of the flights is claimed in the transactions started by transactional, e.g. dbcontext.DB.Transactional.
+func NewService(repo Repository, transactional dbcontext.TransactionFunc, logger log.Logger) Service {
+	return service{repo, transactional, logger}
+}
+
+// Get returns the seat claim of the current user on the flight with the specified claim ID.
+func (s service) Get(ctx context.Context, flightID, id string) (Claim, error) {
+	claim, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Claim{}, err
+	}
+	if claim.FlightID != flightID || claim.UserID != currentUserID(ctx) {
+		return Claim{}, sql.ErrNoRows
+	}
+	positions, err := s.positions(ctx, flightID)
+	if err != nil {
+		return Claim{}, err
+	}
+	return Claim{claim, positions[claim.ID]}, nil
+}
+
+// Count returns the number of seat claims of the current user on the flight.
+func (s service) Count(ctx context.Context, flightID string) (int, error) {
+	return s.repo.Count(ctx, flightID, currentUserID(ctx))
+}
+
+// Query returns the seat claims of the current user on the flight with the specified offset and limit.
+func (s service) Query(ctx context.Context, flightID string, offset, limit int) ([]Claim, error) {
+	items, err := s.repo.Query(ctx, flightID, currentUserID(ctx), offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := s.positions(ctx, flightID)
+	if err != nil {
+		return nil, err
+	}
+	result := []Claim{}
+	for _, item := range items {
+		result = append(result, Claim{item, positions[item.ID]})
+	}
+	return result, nil
+}
+
+// positions returns the positions of the waitlisted claims of the flight by claim ID.
+func (s service) positions(ctx context.Context, flightID string) (map[string]int, error) {
+	waitlist, err := s.repo.Waitlist(ctx, flightID)
+	if err != nil {
+		return nil, err
+	}
+	positions := map[string]int{}
+	for i, claim := range waitlist {
+		positions[claim.ID] = i + 1
+	}
+	return positions, nil
+}
+
+// Create claims seats of the flight for the current user.
+// The claim is granted if the remaining capacity of the flight allows it and nobody is waiting before it,
+// otherwise it is added to the end of the waitlist of the flight.
+// The flight is locked while its capacity is claimed, so that concurrent claims can't exceed it.
+func (s service) Create(ctx context.Context, flightID string, req CreateClaimRequest) (Claim, error) {
+	if err := req.Validate(); err != nil {
+		return Claim{}, err
+	}
+
+	now := time.Now()
+	claim := entity.SeatClaim{
+		ID:        entity.GenerateID(),
+		FlightID:  flightID,
+		UserID:    currentUserID(ctx),
+		Seats:     req.Seats,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	position := 0
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		flight, err := s.repo.LockFlight(ctx, flightID)
+		if err != nil {
+			return err
+		}
+		if !claimable(flight, now) {
+			return ErrFlightClosed
+		}
+		// the capacity of the flight may have grown since the waitlist was promoted last
+		waitlist, err := s.promote(ctx, &flight, now)
+		if err != nil {
+			return err
+		}
+		if len(waitlist) == 0 && claim.Seats <= flight.RemainingCapacity() {
+			claim.Status = entity.ClaimClaimed
+			flight.ClaimedSeats += claim.Seats
+		} else {
+			claim.Status = entity.ClaimWaitlisted
+			position = len(waitlist) + 1
+		}
+		if err := s.repo.Create(ctx, claim); err != nil {
+			return err
+		}
+		return s.repo.UpdateClaimedSeats(ctx, flight.ID, flight.ClaimedSeats)
+	})
+	if err != nil {
+		return Claim{}, err
+	}
+	s.logger.With(ctx).Infof("%v claimed %v seats of flight %v", claim.Status, claim.Seats, flightID)
+	return Claim{claim, position}, nil
+}
+
+// claimable reports whether the seats of the flight can be claimed at the given time.
+func claimable(flight entity.Flight, now time.Time) bool {
+	return (flight.Status == entity.FlightScheduled || flight.Status == entity.FlightDelayed) &&
+		flight.DepartureTime.After(now) && flight.Capacity > 0
+}
+
+// Release releases the claimed or waitlisted seat claim of the current user with the specified ID.
+// The seats of a granted claim are returned to the flight and go to the claims waiting for them, in order.
+func (s service) Release(ctx context.Context, flightID, id string) (Claim, error) {
+	now := time.Now()
+	var claim entity.SeatClaim
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		flight, err := s.repo.LockFlight(ctx, flightID)
+		if err != nil {
+			return err
+		}
+		if claim, err = s.repo.Get(ctx, id); err != nil {
+			return err
+		}
+		if claim.FlightID != flightID || claim.UserID != currentUserID(ctx) {
+			return sql.ErrNoRows
+		}
+		if claim.Status == entity.ClaimReleased {
+			return errors.Conflict(fmt.Sprintf("cannot release a claim that is %v", claim.Status))
+		}
+		if claim.Status == entity.ClaimClaimed {
+			flight.ClaimedSeats -= claim.Seats
+			if flight.ClaimedSeats < 0 {
+				flight.ClaimedSeats = 0
+			}
+		}
+		claim.Status = entity.ClaimReleased
+		claim.UpdatedAt = now
+		if err := s.repo.Update(ctx, claim); err != nil {
+			return err
+		}
+		if _, err := s.promote(ctx, &flight, now); err != nil {
+			return err
+		}
+		return s.repo.UpdateClaimedSeats(ctx, flight.ID, flight.ClaimedSeats)
+	})
+	if err != nil {
+		return Claim{}, err
+	}
+	s.logger.With(ctx).Infof("released the claim of %v seats of flight %v", claim.Seats, flightID)
+	return Claim{claim, 0}, nil
+}
+
+// Promote grants the waitlisted claims of the flight in order, as long as its remaining capacity allows.
+// It joins the transaction of the context, if any, so that the capacity freed by a transaction of another service,
+// such as cancelling a booking or growing the flight capacity, goes to the waitlist before it ends.
+func (s service) Promote(ctx context.Context, flightID string) error {
+	return s.transactional(ctx, func(ctx context.Context) error {
+		flight, err := s.repo.LockFlight(ctx, flightID)
+		if err != nil {
+			return err
+		}
+		claimed := flight.ClaimedSeats
+		if _, err := s.promote(ctx, &flight, time.Now()); err != nil {
+			return err
+		}
+		if flight.ClaimedSeats == claimed {
+			return nil
+		}
+		return s.repo.UpdateClaimedSeats(ctx, flight.ID, flight.ClaimedSeats)
+	})
+}
+
+// promote grants the waitlisted claims of the locked flight in order, as long as the remaining capacity allows.
+// A claim that doesn't fit stops the promotion, so that a smaller claim can't overtake it.
+// It adds the seats of the granted claims to the flight and returns the claims still waiting.
+func (s service) promote(ctx context.Context, flight *entity.Flight, now time.Time) ([]entity.SeatClaim, error) {
+	waitlist, err := s.repo.Waitlist(ctx, flight.ID)
+	if err != nil {
+		return nil, err
+	}
+	for len(waitlist) > 0 && waitlist[0].Seats <= flight.RemainingCapacity() {
+		claim := waitlist[0]
+		claim.Status = entity.ClaimClaimed
+		claim.UpdatedAt = now
+		if err := s.repo.Update(ctx, claim); err != nil {
+			return nil, err
+		}
+		flight.ClaimedSeats += claim.Seats
+		waitlist = waitlist[1:]
+		s.logger.With(ctx).Infof("promoted the claim %v of %v seats of flight %v from the waitlist", claim.ID, claim.Seats, flight.ID)
+	}
+	return waitlist, nil
+}
+
+// currentUserID returns the ID of the user in the context, or an empty string if there is none.
+func currentUserID(ctx context.Context) string {
+	if user := auth.CurrentUser(ctx); user != nil {
+		return user.GetID()
+	}
+	return ""
+}
@@ -0,0 +1,289 @@
+package claim
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateClaimRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     CreateClaimRequest
+		wantError bool
+	}{
+		{"success", CreateClaimRequest{Seats: 2}, false},
+		{"required", CreateClaimRequest{}, true},
+		{"negative", CreateClaimRequest{Seats: -1}, true},
+		{"too many seats", CreateClaimRequest{Seats: 10}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_Create(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := newMockRepository()
+	s := NewService(repo, mockTransactional, logger)
+
+	tester := auth.WithUser(context.Background(), "100", "Tester")
+	other := auth.WithUser(context.Background(), "200", "Other")
+
+	// the flight has 4 seats and 50% overbooking
+	claim, err := s.Create(tester, "f1", CreateClaimRequest{Seats: 4})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, claim.ID)
+	assert.Equal(t, "100", claim.UserID)
+	assert.Equal(t, entity.ClaimClaimed, claim.Status)
+	assert.Equal(t, 0, claim.Position)
+	assert.Equal(t, 4, repo.flights["f1"].ClaimedSeats)
+	claim, err = s.Create(other, "f1", CreateClaimRequest{Seats: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ClaimClaimed, claim.Status)
+	assert.Equal(t, 6, repo.flights["f1"].ClaimedSeats)
+
+	// beyond the overbooking allowance the claims are waitlisted
+	claim, err = s.Create(other, "f1", CreateClaimRequest{Seats: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ClaimWaitlisted, claim.Status)
+	assert.Equal(t, 1, claim.Position)
+	claim, err = s.Create(tester, "f1", CreateClaimRequest{Seats: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ClaimWaitlisted, claim.Status)
+	assert.Equal(t, 2, claim.Position)
+	assert.Equal(t, 6, repo.flights["f1"].ClaimedSeats)
+
+	// validation errors
+	_, err = s.Create(tester, "f1", CreateClaimRequest{})
+	assert.NotNil(t, err)
+	_, err = s.Create(tester, "none", CreateClaimRequest{Seats: 1})
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// the flight must be open for claims
+	_, err = s.Create(tester, "cancelled", CreateClaimRequest{Seats: 1})
+	assert.Equal(t, ErrFlightClosed, err)
+	_, err = s.Create(tester, "empty", CreateClaimRequest{Seats: 1})
+	assert.Equal(t, ErrFlightClosed, err)
+
+	// get
+	claim, err = s.Get(tester, "f1", claim.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, claim.Position)
+	_, err = s.Get(other, "f1", claim.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Get(tester, "cancelled", claim.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Get(tester, "f1", "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// query
+	count, _ := s.Count(tester, "f1")
+	assert.Equal(t, 2, count)
+	claims, err := s.Query(tester, "f1", 0, 10)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(claims)) {
+		assert.Equal(t, 0, claims[0].Position)
+		assert.Equal(t, 2, claims[1].Position)
+	}
+}
+
+func Test_service_Release(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := newMockRepository()
+	s := NewService(repo, mockTransactional, logger)
+	tester := auth.WithUser(context.Background(), "100", "Tester")
+	other := auth.WithUser(context.Background(), "200", "Other")
+
+	granted, _ := s.Create(tester, "f1", CreateClaimRequest{Seats: 5})
+	first, _ := s.Create(other, "f1", CreateClaimRequest{Seats: 3})
+	second, _ := s.Create(other, "f1", CreateClaimRequest{Seats: 1})
+	assert.Equal(t, entity.ClaimWaitlisted, first.Status)
+	assert.Equal(t, entity.ClaimWaitlisted, second.Status)
+
+	// only the owner can release a claim
+	_, err := s.Release(other, "f1", granted.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// releasing a waitlisted claim doesn't change the claimed seats
+	claim, err := s.Release(other, "f1", second.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ClaimReleased, claim.Status)
+	assert.Equal(t, 5, repo.flights["f1"].ClaimedSeats)
+	_, err = s.Release(other, "f1", second.ID)
+	assert.NotNil(t, err)
+
+	// releasing a granted claim promotes the waitlist
+	_, err = s.Release(tester, "f1", granted.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ClaimClaimed, repo.claims[first.ID].Status)
+	assert.Equal(t, 3, repo.flights["f1"].ClaimedSeats)
+
+	// a claim that doesn't fit keeps the smaller claims behind it waiting
+	big, _ := s.Create(tester, "f1", CreateClaimRequest{Seats: 4})
+	small, _ := s.Create(other, "f1", CreateClaimRequest{Seats: 1})
+	assert.Equal(t, entity.ClaimWaitlisted, big.Status)
+	assert.Equal(t, entity.ClaimWaitlisted, small.Status)
+
+	// a grown capacity is claimed by the waitlist first
+	flight := repo.flights["f1"]
+	flight.Capacity = 8
+	repo.flights["f1"] = flight
+	claim, err = s.Create(other, "f1", CreateClaimRequest{Seats: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ClaimClaimed, repo.claims[big.ID].Status)
+	assert.Equal(t, entity.ClaimClaimed, repo.claims[small.ID].Status)
+	assert.Equal(t, entity.ClaimClaimed, claim.Status)
+	assert.Equal(t, 9, repo.flights["f1"].ClaimedSeats)
+}
+
+func Test_service_Create_takenSeats(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := newMockRepository()
+	s := NewService(repo, mockTransactional, logger)
+	tester := auth.WithUser(context.Background(), "100", "Tester")
+
+	// the seats held or booked count against the claim limit of 6 seats
+	flight := repo.flights["f1"]
+	flight.TakenSeats = 3
+	repo.flights["f1"] = flight
+	claim, err := s.Create(tester, "f1", CreateClaimRequest{Seats: 4})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ClaimWaitlisted, claim.Status)
+	claim, err = s.Create(tester, "f1", CreateClaimRequest{Seats: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ClaimWaitlisted, claim.Status)
+	assert.Equal(t, 0, repo.flights["f1"].ClaimedSeats)
+
+	// the waitlist is promoted as the seats are released
+	flight = repo.flights["f1"]
+	flight.TakenSeats = 0
+	repo.flights["f1"] = flight
+	claim, err = s.Create(tester, "f1", CreateClaimRequest{Seats: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ClaimClaimed, claim.Status)
+	assert.Equal(t, 6, repo.flights["f1"].ClaimedSeats)
+	// every claim changes the version of the flight, so that its ETag changes
+	assert.Equal(t, 3, repo.flights["f1"].Version)
+}
+
+func Test_service_Promote(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := newMockRepository()
+	s := NewService(repo, mockTransactional, logger)
+	tester := auth.WithUser(context.Background(), "100", "Tester")
+
+	flight := repo.flights["f1"]
+	flight.TakenSeats = 4
+	repo.flights["f1"] = flight
+	claim, _ := s.Create(tester, "f1", CreateClaimRequest{Seats: 3})
+	assert.Equal(t, entity.ClaimWaitlisted, claim.Status)
+
+	// nothing changes while the waitlist doesn't fit
+	assert.Nil(t, s.Promote(context.Background(), "f1"))
+	assert.Equal(t, entity.ClaimWaitlisted, repo.claims[claim.ID].Status)
+	assert.Equal(t, 1, repo.flights["f1"].Version)
+
+	// the seats freed by the bookings go to the waitlist
+	flight = repo.flights["f1"]
+	flight.TakenSeats = 1
+	repo.flights["f1"] = flight
+	assert.Nil(t, s.Promote(context.Background(), "f1"))
+	assert.Equal(t, entity.ClaimClaimed, repo.claims[claim.ID].Status)
+	assert.Equal(t, 3, repo.flights["f1"].ClaimedSeats)
+	assert.Equal(t, sql.ErrNoRows, s.Promote(context.Background(), "f0"))
+}
+
+// mockTransactional runs the function without a transaction.
+func mockTransactional(ctx context.Context, f func(ctx context.Context) error) error {
+	return f(ctx)
+}
+
+type mockRepository struct {
+	flights map[string]entity.Flight
+	claims  map[string]entity.SeatClaim
+	order   *[]string
+}
+
+// newMockRepository creates a mock repository with an open flight of 4 seats with 50% overbooking,
+// a cancelled flight and a flight without capacity.
+func newMockRepository() *mockRepository {
+	departure := time.Now().Add(48 * time.Hour)
+	return &mockRepository{
+		flights: map[string]entity.Flight{
+			"f1": {ID: "f1", Status: entity.FlightScheduled, DepartureTime: departure,
+				Capacity: 4, OverbookingPercent: 50},
+			"cancelled": {ID: "cancelled", Status: entity.FlightCancelled, DepartureTime: departure, Capacity: 4},
+			"empty":     {ID: "empty", Status: entity.FlightScheduled, DepartureTime: departure},
+		},
+		claims: map[string]entity.SeatClaim{},
+		order:  &[]string{},
+	}
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.SeatClaim, error) {
+	if claim, ok := m.claims[id]; ok {
+		return claim, nil
+	}
+	return entity.SeatClaim{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context, flightID, userID string) (int, error) {
+	items, _ := m.Query(ctx, flightID, userID, 0, 0)
+	return len(items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, flightID, userID string, offset, limit int) ([]entity.SeatClaim, error) {
+	var items []entity.SeatClaim
+	for _, id := range *m.order {
+		if claim := m.claims[id]; claim.FlightID == flightID && claim.UserID == userID {
+			items = append(items, claim)
+		}
+	}
+	return items, nil
+}
+
+func (m mockRepository) Waitlist(ctx context.Context, flightID string) ([]entity.SeatClaim, error) {
+	var items []entity.SeatClaim
+	for _, id := range *m.order {
+		if claim := m.claims[id]; claim.FlightID == flightID && claim.Status == entity.ClaimWaitlisted {
+			items = append(items, claim)
+		}
+	}
+	return items, nil
+}
+
+func (m mockRepository) Create(ctx context.Context, claim entity.SeatClaim) error {
+	m.claims[claim.ID] = claim
+	*m.order = append(*m.order, claim.ID)
+	return nil
+}
+
+func (m mockRepository) Update(ctx context.Context, claim entity.SeatClaim) error {
+	m.claims[claim.ID] = claim
+	return nil
+}
+
+func (m mockRepository) LockFlight(ctx context.Context, id string) (entity.Flight, error) {
+	if flight, ok := m.flights[id]; ok {
+		return flight, nil
+	}
+	return entity.Flight{}, sql.ErrNoRows
+}
+
+func (m mockRepository) UpdateClaimedSeats(ctx context.Context, flightID string, seats int) error {
+	flight := m.flights[flightID]
+	flight.ClaimedSeats = seats
+	flight.Version++
+	m.flights[flightID] = flight
+	return nil
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"io/ioutil"
+	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/nvnoskov/dynamo-backend/pkg/log"
@@ -10,8 +11,14 @@ import (
 )
 
 const (
-	defaultServerPort         = 8080
-	defaultJWTExpirationHours = 72
+	defaultServerPort             = 8080
+	defaultJWTExpirationMinutes   = 15
+	defaultRefreshExpirationHours = 72
+	defaultPasswordResetMinutes   = 60
+	defaultEmailVerificationHours = 48
+	defaultAirportsFile           = "./data/airports.csv"
+	defaultScheduleHorizon        = 60
+	defaultHoldTTLMinutes         = 15
 )
 
 // Config represents an application configuration.
@@ -20,17 +27,73 @@ type Config struct {
 	ServerPort int `yaml:"server_port" env:"SERVER_PORT"`
 	// the data source name (DSN) for connecting to the database. required.
 	DSN string `yaml:"dsn" env:"DSN,secret"`
-	// JWT signing key. required.
-	JWTSigningKey string `yaml:"jwt_signing_key" env:"JWT_SIGNING_KEY,secret"`
-	// JWT expiration in hours. Defaults to 72 hours (3 days)
+	// keys signing the JWT tokens, which take turns by the time they become active. required.
+	// The JWT_KEYS environment variable sets them as a JSON array, e.g. [{"id":"prod-1","file":"/run/secrets/jwt.pem"}]
+	JWTKeys []JWTKey `yaml:"jwt_keys" env:"JWT_KEYS,secret"`
+	// signing key of the pagination cursors. required.
+	CursorSigningKey string `yaml:"cursor_signing_key" env:"CURSOR_SIGNING_KEY,secret"`
+	// JWT expiration in minutes. Defaults to 15 minutes
+	JWTExpirationMinutes int `yaml:"jwt_expiration_minutes" env:"JWT_EXPIRATION_MINUTES"`
+	// JWT expiration in hours, replaced by JWTExpirationMinutes. Setting it fails the validation,
+	// so that a configuration still using it doesn't silently get the default expiration.
 	JWTExpiration int `yaml:"jwt_expiration" env:"JWT_EXPIRATION"`
+	// refresh token expiration in hours. Defaults to 72 hours (3 days)
+	RefreshExpiration int `yaml:"refresh_expiration" env:"REFRESH_EXPIRATION"`
+	// password reset token expiration in minutes. Defaults to 60 minutes
+	PasswordResetExpiration int `yaml:"password_reset_expiration" env:"PASSWORD_RESET_EXPIRATION"`
+	// email verification token expiration in hours. Defaults to 48 hours
+	EmailVerificationExpiration int `yaml:"email_verification_expiration" env:"EMAIL_VERIFICATION_EXPIRATION"`
+	// whether the users must verify their email addresses before they can log in. Defaults to false
+	RequireEmailVerification bool `yaml:"require_email_verification" env:"REQUIRE_EMAIL_VERIFICATION"`
+	// email address of the user granted the admin role on login while there is no admin, once it is verified.
+	AdminEmail string `yaml:"admin_email" env:"ADMIN_EMAIL"`
+	// directory the local mailer writes the messages to as .eml files. Defaults to logging the messages
+	MailDir string `yaml:"mail_dir" env:"MAIL_DIR"`
+	// whether the local mailer logs the message bodies with their tokens, for development only. Defaults to false
+	MailLogBodies bool `yaml:"mail_log_bodies" env:"MAIL_LOG_BODIES"`
+	// exchange rates of ISO 4217 currencies against a common base currency, used to display fares in another currency.
+	ExchangeRates map[string]float64 `yaml:"exchange_rates" env:"-"`
+	// path to the CSV file with the airport reference data loaded on startup. Defaults to "./data/airports.csv"
+	AirportsFile string `yaml:"airports_file" env:"AIRPORTS_FILE"`
+	// number of days ahead the flights of the recurring schedules are generated for. Defaults to 60
+	ScheduleHorizon int `yaml:"schedule_horizon" env:"SCHEDULE_HORIZON"`
+	// seat hold TTL in minutes, after which unconfirmed bookings expire. Defaults to 15
+	HoldTTL int `yaml:"hold_ttl" env:"HOLD_TTL"`
+}
+
+// JWTKey represents a JWT signing key.
+type JWTKey struct {
+	// key ID, published as the "kid" of the key. required.
+	ID string `yaml:"id" json:"id"`
+	// path to the PEM file of the RSA or Ed25519 private key. required unless PEM is set.
+	File string `yaml:"file" json:"file"`
+	// the RSA or Ed25519 private key in PEM encoding, used instead of File.
+	PEM string `yaml:"pem" json:"pem"`
+	// time the key starts signing tokens from, e.g. 2021-01-01T00:00:00Z. Defaults to any time
+	ActiveFrom time.Time `yaml:"active_from" json:"active_from"`
+}
+
+// Validate validates the JWT signing key configuration.
+func (k JWTKey) Validate() error {
+	return validation.ValidateStruct(&k,
+		validation.Field(&k.ID, validation.Required),
+		validation.Field(&k.File, validation.Required.When(k.PEM == "")),
+	)
 }
 
 // Validate validates the application configuration.
 func (c Config) Validate() error {
 	return validation.ValidateStruct(&c,
 		validation.Field(&c.DSN, validation.Required),
-		validation.Field(&c.JWTSigningKey, validation.Required),
+		validation.Field(&c.JWTKeys, validation.Required),
+		validation.Field(&c.CursorSigningKey, validation.Required),
+		validation.Field(&c.ScheduleHorizon, validation.Min(1)),
+		validation.Field(&c.HoldTTL, validation.Min(1)),
+		validation.Field(&c.JWTExpirationMinutes, validation.Min(1)),
+		validation.Field(&c.JWTExpiration, validation.In(0).Error("is replaced by jwt_expiration_minutes")),
+		validation.Field(&c.RefreshExpiration, validation.Min(1)),
+		validation.Field(&c.PasswordResetExpiration, validation.Min(1)),
+		validation.Field(&c.EmailVerificationExpiration, validation.Min(1)),
 	)
 }
 
@@ -38,8 +101,14 @@ func (c Config) Validate() error {
 func Load(file string, logger log.Logger) (*Config, error) {
 	// default config
 	c := Config{
-		ServerPort:    defaultServerPort,
-		JWTExpiration: defaultJWTExpirationHours,
+		ServerPort:                  defaultServerPort,
+		JWTExpirationMinutes:        defaultJWTExpirationMinutes,
+		RefreshExpiration:           defaultRefreshExpirationHours,
+		PasswordResetExpiration:     defaultPasswordResetMinutes,
+		EmailVerificationExpiration: defaultEmailVerificationHours,
+		AirportsFile:                defaultAirportsFile,
+		ScheduleHorizon:             defaultScheduleHorizon,
+		HoldTTL:                     defaultHoldTTLMinutes,
 	}
 
 	// load from YAML config file
@@ -0,0 +1,66 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// The cabin classes of an aircraft configuration.
+const (
+	CabinFirst          = "first"
+	CabinBusiness       = "business"
+	CabinPremiumEconomy = "premium_economy"
+	CabinEconomy        = "economy"
+)
+
+// Aircraft represents an aircraft configuration, i.e. the layout of the seats of an aircraft type.
+type Aircraft struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`   // configuration name, e.g. "A320 2-class"
+	Cabins    Cabins    `json:"cabins"` // cabins from the front to the back of the aircraft
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Cabin represents the seats of a cabin class occupying consecutive rows of an aircraft.
+type Cabin struct {
+	Class    string `json:"class"`     // cabin class, e.g. "economy"
+	FirstRow int    `json:"first_row"` // number of the first row of the cabin
+	LastRow  int    `json:"last_row"`  // number of the last row of the cabin
+	Letters  string `json:"letters"`   // seat letters of every row from left to right, e.g. "ABCDEF"
+}
+
+// Cabins is the list of the cabins of an aircraft configuration, stored as JSON.
+type Cabins []Cabin
+
+// Value implements the driver.Valuer interface.
+// The JSON is returned as a string, as the binary parameters are not accepted by jsonb columns.
+func (c Cabins) Value() (driver.Value, error) {
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+// Scan implements the sql.Scanner interface.
+func (c *Cabins) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case nil:
+		*c = nil
+		return nil
+	}
+	return errors.New("unsupported cabins value")
+}
+
+// Capacity returns the number of seats of the aircraft configuration.
+func (a Aircraft) Capacity() int {
+	capacity := 0
+	for _, cabin := range a.Cabins {
+		capacity += (cabin.LastRow - cabin.FirstRow + 1) * len(cabin.Letters)
+	}
+	return capacity
+}
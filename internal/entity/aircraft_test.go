@@ -0,0 +1,30 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAircraft_Capacity(t *testing.T) {
+	aircraft := Aircraft{Cabins: Cabins{
+		{Class: CabinBusiness, FirstRow: 1, LastRow: 3, Letters: "ACDF"},
+		{Class: CabinEconomy, FirstRow: 10, LastRow: 29, Letters: "ABCDEF"},
+	}}
+	assert.Equal(t, 132, aircraft.Capacity())
+	assert.Equal(t, 0, Aircraft{}.Capacity())
+}
+
+func TestCabins_Scan(t *testing.T) {
+	cabins := Cabins{{Class: CabinEconomy, FirstRow: 1, LastRow: 30, Letters: "ABCDEF"}}
+	value, err := cabins.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, `[{"class":"economy","first_row":1,"last_row":30,"letters":"ABCDEF"}]`, value)
+
+	var scanned Cabins
+	assert.Nil(t, scanned.Scan([]byte(value.(string))))
+	assert.Equal(t, cabins, scanned)
+	assert.Nil(t, scanned.Scan(nil))
+	assert.Nil(t, scanned)
+	assert.NotNil(t, scanned.Scan(1))
+}
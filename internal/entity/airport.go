@@ -0,0 +1,13 @@
+package entity
+
+// Airport represents an airport reference record.
+type Airport struct {
+	Code      string  `json:"code" db:"pk,code"` // IATA airport code
+	ICAO      string  `json:"icao"`              // ICAO airport code
+	Name      string  `json:"name"`              // airport name
+	City      string  `json:"city"`              // city served by the airport
+	Country   string  `json:"country"`           // country name
+	Latitude  float64 `json:"latitude"`          // latitude in decimal degrees
+	Longitude float64 `json:"longitude"`         // longitude in decimal degrees
+	Timezone  string  `json:"timezone"`          // IANA time zone name, e.g. "Europe/Stockholm"
+}
@@ -0,0 +1,57 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// The statuses of a booking.
+const (
+	BookingHeld      = "held"
+	BookingConfirmed = "confirmed"
+	BookingCancelled = "cancelled"
+	BookingExpired   = "expired"
+)
+
+// Booking represents the seats of a flight held or booked by a user.
+type Booking struct {
+	ID        string      `json:"id"`
+	UserID    string      `json:"user_id"`
+	FlightID  string      `json:"flight_id"`
+	Seats     SeatNumbers `json:"seats"`                // numbers of the seats, e.g. ["12A", "12B"]
+	Status    string      `json:"status"`               // booking status, e.g. "held"
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"` // end of the hold, set while the booking is held
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// SeatNumbers is the list of the seat numbers of a booking, stored as JSON.
+type SeatNumbers []string
+
+// Value implements the driver.Valuer interface.
+// The JSON is returned as a string, as the binary parameters are not accepted by jsonb columns.
+func (s SeatNumbers) Value() (driver.Value, error) {
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+// Scan implements the sql.Scanner interface.
+func (s *SeatNumbers) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	case nil:
+		*s = nil
+		return nil
+	}
+	return errors.New("unsupported seat numbers value")
+}
+
+// Expired reports whether the booking is held past the end of its hold.
+func (b Booking) Expired(now time.Time) bool {
+	return b.Status == BookingHeld && b.ExpiresAt != nil && !b.ExpiresAt.After(now)
+}
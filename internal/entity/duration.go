@@ -0,0 +1,71 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var isoDurationRegex = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?)?$`)
+
+// ParseISODuration parses an ISO 8601 duration with day, hour and minute components, such as "PT3H20M" or "P1DT2H".
+func ParseISODuration(s string) (time.Duration, error) {
+	m := isoDurationRegex.FindStringSubmatch(s)
+	if m == nil || s == "P" || s[len(s)-1] == 'T' {
+		return 0, fmt.Errorf("invalid ISO 8601 duration %q", s)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(m[i+1], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO 8601 duration %q", s)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+// ParseDuration parses a duration given either in minutes or in the ISO 8601 format, e.g. "90" or "PT1H30M".
+func ParseDuration(s string) (time.Duration, error) {
+	if minutes, err := strconv.Atoi(s); err == nil && minutes >= 0 {
+		return time.Duration(minutes) * time.Minute, nil
+	}
+	return ParseISODuration(s)
+}
+
+// ValidateDuration checks that the value is a duration in minutes or in the ISO 8601 format.
+// It can be used as a validation rule with validation.By.
+func ValidateDuration(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	if _, err := ParseDuration(s); err != nil {
+		return errors.New("must be a number of minutes or an ISO 8601 duration")
+	}
+	return nil
+}
+
+// FormatISODuration formats the duration as an ISO 8601 duration with hour and minute components, e.g. "PT3H20M".
+// Seconds are truncated.
+func FormatISODuration(d time.Duration) string {
+	minutes := int64(d / time.Minute)
+	sign := ""
+	if minutes < 0 {
+		sign, minutes = "-", -minutes
+	}
+	switch {
+	case minutes == 0:
+		return "PT0M"
+	case minutes%60 == 0:
+		return fmt.Sprintf("%vPT%dH", sign, minutes/60)
+	case minutes < 60:
+		return fmt.Sprintf("%vPT%dM", sign, minutes)
+	}
+	return fmt.Sprintf("%vPT%dH%dM", sign, minutes/60, minutes%60)
+}
@@ -0,0 +1,59 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		input     string
+		want      time.Duration
+		wantError bool
+	}{
+		{"PT3H20M", 3*time.Hour + 20*time.Minute, false},
+		{"PT45M", 45 * time.Minute, false},
+		{"PT2H", 2 * time.Hour, false},
+		{"P1DT2H", 26 * time.Hour, false},
+		{"P1D", 24 * time.Hour, false},
+		{"P", 0, true},
+		{"PT", 0, true},
+		{"P1DT", 0, true},
+		{"3H", 0, true},
+		{"PT1.5H", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			d, err := ParseISODuration(tt.input)
+			assert.Equal(t, tt.wantError, err != nil)
+			assert.Equal(t, tt.want, d)
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	d, err := ParseDuration("90")
+	assert.Nil(t, err)
+	assert.Equal(t, 90*time.Minute, d)
+	d, err = ParseDuration("PT1H30M")
+	assert.Nil(t, err)
+	assert.Equal(t, 90*time.Minute, d)
+	_, err = ParseDuration("-5")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, ValidateDuration(""))
+	assert.Nil(t, ValidateDuration("45"))
+	assert.NotNil(t, ValidateDuration("3h"))
+}
+
+func TestFormatISODuration(t *testing.T) {
+	assert.Equal(t, "PT3H20M", FormatISODuration(3*time.Hour+20*time.Minute))
+	assert.Equal(t, "PT3H", FormatISODuration(3*time.Hour+30*time.Second))
+	assert.Equal(t, "PT45M", FormatISODuration(45*time.Minute))
+	assert.Equal(t, "PT26H", FormatISODuration(26*time.Hour))
+	assert.Equal(t, "PT0M", FormatISODuration(0))
+	assert.Equal(t, "-PT1H5M", FormatISODuration(-65*time.Minute))
+}
@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// EmailVerification represents the verification of the email address of a user.
+// Only the hash of the token mailed to the address is stored, and the token can be used once.
+type EmailVerification struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Email     string     `json:"email"`      // email address the token was mailed to
+	TokenHash string     `json:"-"`          // SHA-256 hash of the token
+	ExpiresAt time.Time  `json:"expires_at"` // time the token can no longer be used after
+	UsedAt    *time.Time `json:"used_at"`    // time the email address was verified with the token
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Usable reports whether the email address can be verified with the token at the given time.
+func (v EmailVerification) Usable(now time.Time) bool {
+	return v.UsedAt == nil && now.Before(v.ExpiresAt)
+}
@@ -6,15 +6,71 @@ import (
 
 // Flight represents an flight record.
 type Flight struct {
-	ID            string    `json:"id"`
-	Name          string    `json:"name"`           // flight name
-	Number        string    `json:"number"`         // flight number
-	Departure     string    `json:"departure"`      // departure
-	DepartureTime time.Time `json:"departure_time"` // scheduled date & time
-	Destination   string    `json:"destination"`    // destination
-	ArrivalTime   time.Time `json:"arrival_time"`   // expected arrival date & time
-	Fare          string    `json:"fare"`           // fare
-	Duration      string    `json:"duration"`       // flight duration
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`                  // flight name
+	Number          string     `json:"number"`                // flight number
+	Departure       string     `json:"departure"`             // departure airport IATA code
+	DepartureTime   time.Time  `json:"departure_time"`        // scheduled date & time
+	Destination     string     `json:"destination"`           // destination airport IATA code
+	ArrivalTime     time.Time  `json:"arrival_time"`          // expected arrival date & time
+	Fare            string     `json:"fare"`                  // fare in the compact form, e.g. "100EUR"
+	FareAmount      int64      `json:"fare_amount"`           // fare in minor currency units
+	FareCurrency    string     `json:"fare_currency"`         // ISO 4217 fare currency code
+	DurationMinutes int        `json:"duration_minutes"`      // flight duration in minutes
+	Version         int        `json:"version"`               // incremented on every update, used for optimistic locking
+	ScheduleID      *string    `json:"schedule_id,omitempty"` // ID of the schedule that generated the flight, if any
+	AircraftID      *string    `json:"aircraft_id,omitempty"` // ID of the aircraft configuration the seats are derived from, if any
+	EditedAt        *time.Time `json:"edited_at,omitempty"`   // last update by PUT or PATCH, the schedule no longer changes the flight
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	Capacity           int `json:"capacity"`            // number of seats on sale, no seats can be claimed if 0
+	OverbookingPercent int `json:"overbooking_percent"` // percentage of the capacity that can be claimed on top of it
+	ClaimedSeats       int `json:"claimed_seats"`       // number of seats claimed
+	TakenSeats         int `json:"taken_seats"`         // number of seats held or booked
+
+	Status                 string     `json:"status"`                             // operational status, e.g. "delayed"
+	StatusReason           string     `json:"status_reason,omitempty"`            // reason of the last status change
+	EstimatedDepartureTime *time.Time `json:"estimated_departure_time,omitempty"` // estimated departure of a delayed flight
+	EstimatedArrivalTime   *time.Time `json:"estimated_arrival_time,omitempty"`   // estimated arrival of a delayed flight
+	ActualDepartureTime    *time.Time `json:"actual_departure_time,omitempty"`    // actual departure date & time
+	ActualArrivalTime      *time.Time `json:"actual_arrival_time,omitempty"`      // actual arrival date & time
+}
+
+// SetFare sets the fare fields of the flight from the given money.
+func (f *Flight) SetFare(fare Money) {
+	f.Fare = fare.String()
+	f.FareAmount = fare.Amount
+	f.FareCurrency = fare.Currency
+}
+
+// SetTimes sets the departure and arrival times of the flight in UTC and computes the flight duration.
+func (f *Flight) SetTimes(departure, arrival time.Time) {
+	f.DepartureTime = departure.UTC()
+	f.ArrivalTime = arrival.UTC()
+	f.DurationMinutes = int(arrival.Sub(departure).Round(time.Minute) / time.Minute)
+}
+
+// ClaimLimit returns the number of seats that can be claimed, i.e. the capacity plus the overbooking allowance.
+// The flight_claim_limit_check constraint of the flight table computes it the same way.
+func (f Flight) ClaimLimit() int {
+	return f.Capacity + f.Capacity*f.OverbookingPercent/100
+}
+
+// RemainingCapacity returns the number of seats that can still be claimed.
+// The held or booked seats count against the claim limit like the claimed ones.
+func (f Flight) RemainingCapacity() int {
+	if remaining := f.ClaimLimit() - f.ClaimedSeats - f.TakenSeats; remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// BookableSeats returns the number of seats that can still be held.
+// The claimed seats count against the capacity, but the overbooking allowance doesn't apply to the seats.
+func (f Flight) BookableSeats() int {
+	if remaining := f.Capacity - f.ClaimedSeats - f.TakenSeats; remaining > 0 {
+		return remaining
+	}
+	return 0
 }
@@ -0,0 +1,76 @@
+package entity
+
+import (
+	"time"
+)
+
+// The operational statuses of a flight.
+const (
+	FlightScheduled = "scheduled"
+	FlightDelayed   = "delayed"
+	FlightBoarding  = "boarding"
+	FlightDeparted  = "departed"
+	FlightArrived   = "arrived"
+	FlightCancelled = "cancelled"
+)
+
+// flightTransitions maps a flight status to the statuses the flight may change to from it.
+// A delayed flight may be delayed again with a new estimate. Arrived and cancelled flights are final.
+var flightTransitions = map[string][]string{
+	FlightScheduled: {FlightDelayed, FlightBoarding, FlightCancelled},
+	FlightDelayed:   {FlightDelayed, FlightBoarding, FlightCancelled},
+	FlightBoarding:  {FlightDelayed, FlightDeparted, FlightCancelled},
+	FlightDeparted:  {FlightArrived},
+	FlightArrived:   {},
+	FlightCancelled: {},
+}
+
+// IsFlightStatus reports whether the given value is a known flight status.
+func IsFlightStatus(status string) bool {
+	_, ok := flightTransitions[status]
+	return ok
+}
+
+// CanTransition reports whether a flight may change from one status to another.
+func CanTransition(from, to string) bool {
+	for _, status := range flightTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// FlightStatusChange represents a transition of a flight from one status to another.
+type FlightStatusChange struct {
+	ID                     string     `json:"id"`
+	FlightID               string     `json:"flight_id"`
+	PreviousStatus         string     `json:"previous_status"`
+	Status                 string     `json:"status"`
+	Reason                 string     `json:"reason,omitempty"`                   // why the status changed, e.g. "late inbound aircraft"
+	EstimatedDepartureTime *time.Time `json:"estimated_departure_time,omitempty"` // estimated departure of a delayed flight
+	EstimatedArrivalTime   *time.Time `json:"estimated_arrival_time,omitempty"`   // estimated arrival of a delayed flight
+	ActualDepartureTime    *time.Time `json:"actual_departure_time,omitempty"`    // actual departure of a departed flight
+	ActualArrivalTime      *time.Time `json:"actual_arrival_time,omitempty"`      // actual arrival of an arrived flight
+	CreatedAt              time.Time  `json:"created_at"`
+}
+
+// ApplyStatus changes the status of the flight as described by the status change.
+// The estimated and actual times of the change replace those of the flight when they are given.
+// It does not check whether the transition is allowed.
+func (f *Flight) ApplyStatus(change FlightStatusChange) {
+	f.Status = change.Status
+	f.StatusReason = change.Reason
+	if change.EstimatedDepartureTime != nil {
+		f.EstimatedDepartureTime = change.EstimatedDepartureTime
+	}
+	if change.EstimatedArrivalTime != nil {
+		f.EstimatedArrivalTime = change.EstimatedArrivalTime
+	}
+	if change.ActualDepartureTime != nil {
+		f.ActualDepartureTime = change.ActualDepartureTime
+	}
+	if change.ActualArrivalTime != nil {
+		f.ActualArrivalTime = change.ActualArrivalTime
+	}
+}
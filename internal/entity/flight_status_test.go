@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{FlightScheduled, FlightDelayed, true},
+		{FlightScheduled, FlightBoarding, true},
+		{FlightScheduled, FlightCancelled, true},
+		{FlightScheduled, FlightDeparted, false},
+		{FlightScheduled, FlightScheduled, false},
+		{FlightDelayed, FlightDelayed, true},
+		{FlightBoarding, FlightDeparted, true},
+		{FlightDeparted, FlightArrived, true},
+		{FlightDeparted, FlightCancelled, false},
+		{FlightArrived, FlightDelayed, false},
+		{FlightCancelled, FlightScheduled, false},
+		{"unknown", FlightDelayed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"-"+tt.to, func(t *testing.T) {
+			assert.Equal(t, tt.want, CanTransition(tt.from, tt.to))
+		})
+	}
+	assert.True(t, IsFlightStatus(FlightArrived))
+	assert.False(t, IsFlightStatus("landed"))
+}
+
+func TestFlight_ApplyStatus(t *testing.T) {
+	estimated := time.Date(2020, 10, 1, 10, 0, 0, 0, time.UTC)
+	flight := Flight{Status: FlightScheduled}
+	flight.ApplyStatus(FlightStatusChange{Status: FlightDelayed, Reason: "weather", EstimatedDepartureTime: &estimated})
+	assert.Equal(t, FlightDelayed, flight.Status)
+	assert.Equal(t, "weather", flight.StatusReason)
+	assert.Equal(t, estimated, *flight.EstimatedDepartureTime)
+
+	// the estimate is kept when the next change has none
+	flight.ApplyStatus(FlightStatusChange{Status: FlightBoarding})
+	assert.Equal(t, FlightBoarding, flight.Status)
+	assert.Empty(t, flight.StatusReason)
+	assert.Equal(t, estimated, *flight.EstimatedDepartureTime)
+}
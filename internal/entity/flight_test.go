@@ -0,0 +1,30 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlight_RemainingCapacity(t *testing.T) {
+	tests := []struct {
+		name                                   string
+		capacity, overbooking, claimed, taken  int
+		wantLimit, wantRemaining, wantBookable int
+	}{
+		{"no capacity", 0, 10, 0, 0, 0, 0, 0},
+		{"no overbooking", 100, 0, 40, 0, 100, 60, 60},
+		{"overbooking", 100, 10, 100, 0, 110, 10, 0},
+		{"rounded down", 15, 10, 0, 0, 16, 16, 15},
+		{"claimed over the limit", 100, 5, 120, 0, 105, 0, 0},
+		{"taken seats", 100, 10, 40, 30, 110, 40, 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flight := Flight{Capacity: tt.capacity, OverbookingPercent: tt.overbooking, ClaimedSeats: tt.claimed, TakenSeats: tt.taken}
+			assert.Equal(t, tt.wantLimit, flight.ClaimLimit())
+			assert.Equal(t, tt.wantRemaining, flight.RemainingCapacity())
+			assert.Equal(t, tt.wantBookable, flight.BookableSeats())
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Money represents a monetary amount in the minor units of an ISO 4217 currency.
+type Money struct {
+	Amount   int64  `json:"amount"`   // amount in minor units, e.g. cents
+	Currency string `json:"currency"` // ISO 4217 currency code
+}
+
+// currencies maps the supported ISO 4217 currency codes to the number of their minor unit digits.
+// The currency_digits() function of the database must return the same, which TestCurrencyDigits checks.
+var currencies = map[string]int{
+	"AED": 2, "AUD": 2, "BGN": 2, "BHD": 3, "BRL": 2, "BYN": 2, "CAD": 2, "CHF": 2,
+	"CLP": 0, "CNY": 2, "CZK": 2, "DKK": 2, "EGP": 2, "EUR": 2, "GBP": 2, "GEL": 2,
+	"HKD": 2, "HUF": 2, "IDR": 2, "ILS": 2, "INR": 2, "ISK": 0, "JOD": 3, "JPY": 0,
+	"KRW": 0, "KWD": 3, "KZT": 2, "MXN": 2, "MYR": 2, "NOK": 2, "NZD": 2, "OMR": 3,
+	"PHP": 2, "PLN": 2, "QAR": 2, "RON": 2, "RSD": 2, "RUB": 2, "SAR": 2, "SEK": 2,
+	"SGD": 2, "THB": 2, "TND": 3, "TRY": 2, "TWD": 2, "UAH": 2, "USD": 2, "ZAR": 2,
+}
+
+var moneyRegex = regexp.MustCompile(`^([A-Za-z]{3})?\s*(\d+)(?:[.,](\d+))?\s*([A-Za-z]{3})?$`)
+
+// IsCurrency reports whether the given code is a supported ISO 4217 currency code.
+func IsCurrency(code string) bool {
+	_, ok := currencies[code]
+	return ok
+}
+
+// ParseMoney parses a string such as "100EUR", "100.50 EUR" or "EUR 100" into Money.
+func ParseMoney(s string) (Money, error) {
+	m := moneyRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || (m[1] == "") == (m[4] == "") {
+		return Money{}, fmt.Errorf("invalid money format %q", s)
+	}
+	currency := strings.ToUpper(m[1] + m[4])
+	digits, ok := currencies[currency]
+	if !ok {
+		return Money{}, fmt.Errorf("unsupported currency %q", currency)
+	}
+	if len(m[3]) > digits {
+		return Money{}, fmt.Errorf("%v allows at most %v decimal digits", currency, digits)
+	}
+	amount, err := strconv.ParseInt(m[2]+m[3]+strings.Repeat("0", digits-len(m[3])), 10, 64)
+	if err != nil {
+		return Money{}, errors.New("amount is out of range")
+	}
+	return Money{amount, currency}, nil
+}
+
+// String returns the money in the compact form such as "100EUR" or "100.50EUR".
+// The fractional part is omitted when it is zero.
+func (m Money) String() string {
+	digits := currencies[m.Currency]
+	if digits == 0 {
+		return fmt.Sprintf("%d%v", m.Amount, m.Currency)
+	}
+	sign, amount := "", m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	unit := int64(1)
+	for i := 0; i < digits; i++ {
+		unit *= 10
+	}
+	if amount%unit == 0 {
+		return fmt.Sprintf("%v%d%v", sign, amount/unit, m.Currency)
+	}
+	return fmt.Sprintf("%v%d.%0*d%v", sign, amount/unit, digits, amount%unit, m.Currency)
+}
+
+// ExchangeRates maps ISO 4217 currency codes to their rates against a common base currency.
+type ExchangeRates map[string]float64
+
+// Convert converts the money into the given currency.
+// False is returned if the rate of either currency is unknown.
+func (r ExchangeRates) Convert(m Money, currency string) (Money, bool) {
+	if m.Currency == currency {
+		return m, true
+	}
+	from, to := r[m.Currency], r[currency]
+	if from <= 0 || to <= 0 || !IsCurrency(currency) {
+		return Money{}, false
+	}
+	amount := float64(m.Amount) / from * to * math.Pow10(currencies[currency]-currencies[m.Currency])
+	return Money{int64(math.Round(amount)), currency}, true
+}
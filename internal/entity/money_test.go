@@ -0,0 +1,95 @@
+package entity
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input     string
+		want      Money
+		wantError bool
+	}{
+		{"100EUR", Money{10000, "EUR"}, false},
+		{"200 eur", Money{20000, "EUR"}, false},
+		{"99.90 USD", Money{9990, "USD"}, false},
+		{"EUR 12,5", Money{1250, "EUR"}, false},
+		{"1500JPY", Money{1500, "JPY"}, false},
+		{"1.250KWD", Money{1250, "KWD"}, false},
+		{"1.5JPY", Money{}, true},
+		{"100XYZ", Money{}, true},
+		{"EUR 100 EUR", Money{}, true},
+		{"100", Money{}, true},
+		{"", Money{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			m, err := ParseMoney(tt.input)
+			assert.Equal(t, tt.wantError, err != nil)
+			assert.Equal(t, tt.want, m)
+		})
+	}
+}
+
+func TestMoney_String(t *testing.T) {
+	assert.Equal(t, "100EUR", Money{10000, "EUR"}.String())
+	assert.Equal(t, "99.90USD", Money{9990, "USD"}.String())
+	assert.Equal(t, "-0.05USD", Money{-5, "USD"}.String())
+	assert.Equal(t, "1500JPY", Money{1500, "JPY"}.String())
+	assert.Equal(t, "1.250KWD", Money{1250, "KWD"}.String())
+}
+
+func TestIsCurrency(t *testing.T) {
+	assert.True(t, IsCurrency("EUR"))
+	assert.False(t, IsCurrency("eur"))
+	assert.False(t, IsCurrency("XYZ"))
+}
+
+// TestCurrencyDigits checks that the currencies the fare constraints of the database accept are the supported ones,
+// as defined by the latest migration creating or replacing the currency_digits() function.
+func TestCurrencyDigits(t *testing.T) {
+	files, _ := filepath.Glob("../../migrations/*.up.sql")
+	var data []byte
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if !assert.Nil(t, err) {
+			return
+		}
+		if strings.Contains(string(content), "FUNCTION currency_digits(") {
+			data = content
+		}
+	}
+	if !assert.NotNil(t, data) {
+		return
+	}
+	digits := map[string]int{}
+	for _, m := range regexp.MustCompile(`WHEN code IN \(([^)]*)\) THEN (\d)`).FindAllStringSubmatch(string(data), -1) {
+		n, _ := strconv.Atoi(m[2])
+		for _, code := range regexp.MustCompile(`'([A-Z]{3})'`).FindAllStringSubmatch(m[1], -1) {
+			digits[code[1]] = n
+		}
+	}
+	assert.Equal(t, currencies, digits)
+}
+
+func TestExchangeRates_Convert(t *testing.T) {
+	rates := ExchangeRates{"EUR": 1, "USD": 1.2, "JPY": 125}
+	m, ok := rates.Convert(Money{10000, "EUR"}, "USD")
+	assert.True(t, ok)
+	assert.Equal(t, Money{12000, "USD"}, m)
+	m, ok = rates.Convert(Money{10000, "EUR"}, "JPY")
+	assert.True(t, ok)
+	assert.Equal(t, Money{12500, "JPY"}, m)
+	m, ok = rates.Convert(Money{10000, "EUR"}, "EUR")
+	assert.True(t, ok)
+	assert.Equal(t, Money{10000, "EUR"}, m)
+	_, ok = rates.Convert(Money{10000, "EUR"}, "GBP")
+	assert.False(t, ok)
+}
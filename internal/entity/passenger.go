@@ -0,0 +1,44 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The types of the travel document of a passenger.
+const (
+	DocumentPassport = "passport"
+	DocumentIDCard   = "id_card"
+)
+
+// Passenger represents a person flying on a flight.
+// The document number is left out of JSON and, masked, of the string form used in logs.
+type Passenger struct {
+	ID             string    `json:"id"`
+	FlightID       string    `json:"flight_id"`
+	FirstName      string    `json:"first_name"`
+	LastName       string    `json:"last_name"`
+	DateOfBirth    time.Time `json:"date_of_birth"`
+	DocumentType   string    `json:"document_type"` // travel document type, e.g. "passport"
+	DocumentNumber string    `json:"-"`             // travel document number
+	Nationality    string    `json:"nationality"`   // ISO 3166-1 alpha-2 country code
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// String returns the name of the passenger and the masked document number.
+func (p Passenger) String() string {
+	return fmt.Sprintf("%v %v (%v %v)", p.FirstName, p.LastName, p.DocumentType, MaskDocumentNumber(p.DocumentNumber))
+}
+
+// MaskDocumentNumber replaces all characters of a document number but the last four with asterisks.
+// Numbers of up to four characters are masked entirely.
+func MaskDocumentNumber(number string) string {
+	runes := []rune(number)
+	visible := 4
+	if len(runes) <= visible {
+		visible = 0
+	}
+	return strings.Repeat("*", len(runes)-visible) + string(runes[len(runes)-visible:])
+}
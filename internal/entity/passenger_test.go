@@ -0,0 +1,25 @@
+package entity
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskDocumentNumber(t *testing.T) {
+	assert.Equal(t, "*****4567", MaskDocumentNumber("AB1234567"))
+	assert.Equal(t, "****", MaskDocumentNumber("1234"))
+	assert.Equal(t, "", MaskDocumentNumber(""))
+}
+
+func TestPassenger_String(t *testing.T) {
+	passenger := Passenger{FirstName: "Anna", LastName: "Berg", DocumentType: DocumentPassport, DocumentNumber: "AB1234567"}
+	assert.Equal(t, "Anna Berg (passport *****4567)", passenger.String())
+	assert.Equal(t, "Anna Berg (passport *****4567)", fmt.Sprintf("%v", passenger))
+
+	b, err := json.Marshal(passenger)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(b), "1234567")
+}
@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// PasswordReset represents a request of a user to reset the password.
+// Only the hash of the token sent to the user is stored, and the token can be used once.
+type PasswordReset struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	TokenHash string     `json:"-"`          // SHA-256 hash of the token
+	ExpiresAt time.Time  `json:"expires_at"` // time the token can no longer be used after
+	UsedAt    *time.Time `json:"used_at"`    // time the password was reset with the token
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Usable reports whether the password can be reset with the token at the given time.
+func (r PasswordReset) Usable(now time.Time) bool {
+	return r.UsedAt == nil && now.Before(r.ExpiresAt)
+}
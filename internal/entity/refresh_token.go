@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+// RefreshToken represents a refresh token issued to a user.
+// Only the hash of the token is stored. Each refresh replaces the token with a new one of the same family,
+// and the access token issued along with it has the token ID as its "jti" claim.
+type RefreshToken struct {
+	ID        string     `json:"id"`
+	FamilyID  string     `json:"family_id"` // ID of the first token of the login session
+	UserID    string     `json:"user_id"`
+	TokenHash string     `json:"-"`          // SHA-256 hash of the token
+	ExpiresAt time.Time  `json:"expires_at"` // time the token can no longer be used after
+	UsedAt    *time.Time `json:"used_at"`    // time the token was exchanged for a new one
+	RevokedAt *time.Time `json:"revoked_at"` // time the token was revoked on logout or reuse
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Usable reports whether the token can be exchanged for a new one at the given time.
+func (t RefreshToken) Usable(now time.Time) bool {
+	return t.UsedAt == nil && t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,46 @@
+package entity
+
+import (
+	"time"
+)
+
+// Schedule represents a recurring flight operated on the same days of the week over a validity period.
+type Schedule struct {
+	ID                 string    `json:"id"`
+	Name               string    `json:"name"`                  // name of the scheduled flights
+	Number             string    `json:"number"`                // flight number
+	Departure          string    `json:"departure"`             // departure airport IATA code
+	Destination        string    `json:"destination"`           // destination airport IATA code
+	DaysOfWeek         string    `json:"days_of_week"`          // ISO weekdays of operation, e.g. "135" for Monday, Wednesday and Friday
+	LocalDepartureTime string    `json:"local_departure_time"`  // departure time in the departure airport time zone, e.g. "14:35"
+	DurationMinutes    int       `json:"duration_minutes"`      // flight duration in minutes
+	ValidFrom          time.Time `json:"valid_from"`            // first day of operation
+	ValidTo            time.Time `json:"valid_to"`              // last day of operation
+	Fare               string    `json:"fare"`                  // fare in the compact form, e.g. "100EUR"
+	FareAmount         int64     `json:"fare_amount"`           // fare in minor currency units
+	FareCurrency       string    `json:"fare_currency"`         // ISO 4217 fare currency code
+	AircraftID         *string   `json:"aircraft_id,omitempty"` // ID of the aircraft configuration of the flights, if any
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// SetFare sets the fare fields of the schedule from the given money.
+func (s *Schedule) SetFare(fare Money) {
+	s.Fare = fare.String()
+	s.FareAmount = fare.Amount
+	s.FareCurrency = fare.Currency
+}
+
+// OperatesOn reports whether the schedule operates on the given weekday.
+func (s Schedule) OperatesOn(day time.Weekday) bool {
+	iso := int(day)
+	if day == time.Sunday {
+		iso = 7
+	}
+	for _, c := range s.DaysOfWeek {
+		if int(c-'0') == iso {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule_OperatesOn(t *testing.T) {
+	s := Schedule{DaysOfWeek: "157"}
+	assert.True(t, s.OperatesOn(time.Monday))
+	assert.True(t, s.OperatesOn(time.Friday))
+	assert.True(t, s.OperatesOn(time.Sunday))
+	assert.False(t, s.OperatesOn(time.Tuesday))
+	assert.False(t, s.OperatesOn(time.Saturday))
+	assert.False(t, Schedule{}.OperatesOn(time.Monday))
+}
@@ -0,0 +1,19 @@
+package entity
+
+// The statuses of a seat of a flight.
+const (
+	SeatAvailable = "available"
+	SeatHeld      = "held"
+	SeatBooked    = "booked"
+)
+
+// Seat represents a seat of a flight.
+type Seat struct {
+	FlightID  string  `json:"flight_id" db:"pk,flight_id"`
+	Number    string  `json:"number" db:"pk,number"` // seat number, e.g. "12A"
+	Cabin     string  `json:"cabin"`                 // cabin class, e.g. "economy"
+	Row       int     `json:"row"`                   // row number
+	Letter    string  `json:"letter"`                // seat letter within the row
+	Status    string  `json:"status"`                // seat status, e.g. "available"
+	BookingID *string `json:"-"`                     // ID of the booking holding the seat, if any
+}
@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+// The statuses of a seat claim.
+const (
+	ClaimClaimed    = "claimed"
+	ClaimWaitlisted = "waitlisted"
+	ClaimReleased   = "released"
+)
+
+// SeatClaim represents a number of seats of a flight claimed by a user without assigning them.
+// A claim exceeding the remaining capacity of the flight waits on its waitlist.
+type SeatClaim struct {
+	ID        string    `json:"id"`
+	FlightID  string    `json:"flight_id"`
+	UserID    string    `json:"user_id"`
+	Seats     int       `json:"seats"`  // number of seats claimed
+	Status    string    `json:"status"` // claim status, e.g. "waitlisted"
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -1,11 +1,23 @@
 package entity
 
+import "time"
+
+// The roles of a user.
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleCustomer = "customer"
+)
+
 // User represents a user.
 type User struct {
 	ID       string `json:"id"`
 	Name     string `json:"name"`
 	Password string
 	Email    string `json:"email"`
+	Role     string `json:"role"` // user role, e.g. "operator"
+	// time the user verified the email address, nil while the address is unverified
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
 }
 
 // GetID returns the user ID.
@@ -17,3 +29,13 @@ func (u User) GetID() string {
 func (u User) GetName() string {
 	return u.Name
 }
+
+// GetRole returns the user role.
+func (u User) GetRole() string {
+	return u.Role
+}
+
+// EmailVerified reports whether the user has verified the email address.
+func (u User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
@@ -79,6 +79,39 @@ func BadRequest(msg string) ErrorResponse {
 	}
 }
 
+// PreconditionFailed creates a new error response representing a failed request precondition (HTTP 412)
+func PreconditionFailed(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The resource has been modified since you last retrieved it."
+	}
+	return ErrorResponse{
+		Status:  http.StatusPreconditionFailed,
+		Message: msg,
+	}
+}
+
+// Conflict creates a new error response representing a request conflicting with the resource state (HTTP 409)
+func Conflict(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The request conflicts with the current state of the resource."
+	}
+	return ErrorResponse{
+		Status:  http.StatusConflict,
+		Message: msg,
+	}
+}
+
+// UnsupportedMediaType creates a new error response representing a request body of an unsupported media type (HTTP 415)
+func UnsupportedMediaType(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The media type of the request body is not supported."
+	}
+	return ErrorResponse{
+		Status:  http.StatusUnsupportedMediaType,
+		Message: msg,
+	}
+}
+
 type invalidField struct {
 	Field string `json:"field"`
 	Error string `json:"error"`
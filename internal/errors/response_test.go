@@ -54,6 +54,14 @@ func TestForbidden(t *testing.T) {
 	assert.NotEmpty(t, res.Error())
 }
 
+func TestConflict(t *testing.T) {
+	res := Conflict("test")
+	assert.Equal(t, http.StatusConflict, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = Conflict("")
+	assert.NotEmpty(t, res.Error())
+}
+
 func TestBadRequest(t *testing.T) {
 	res := BadRequest("test")
 	assert.Equal(t, http.StatusBadRequest, res.StatusCode())
@@ -62,6 +70,14 @@ func TestBadRequest(t *testing.T) {
 	assert.NotEmpty(t, res.Error())
 }
 
+func TestPreconditionFailed(t *testing.T) {
+	res := PreconditionFailed("test")
+	assert.Equal(t, http.StatusPreconditionFailed, res.StatusCode())
+	assert.Equal(t, "test", res.Error())
+	res = PreconditionFailed("")
+	assert.NotEmpty(t, res.Error())
+}
+
 func TestInvalidInput(t *testing.T) {
 	err := InvalidInput(validation.Errors{
 		"xyz": fmt.Errorf("2"),
@@ -1,11 +1,20 @@
 package flight
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
 	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
 	"github.com/nvnoskov/dynamo-backend/internal/errors"
 	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/nvnoskov/dynamo-backend/pkg/mergepatch"
 	"github.com/nvnoskov/dynamo-backend/pkg/pagination"
 )
 
@@ -17,9 +26,16 @@ func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routin
 	r.Use(authHandler)
 	r.Get("/flights/<id>", res.get)
 	r.Get("/flights", res.query)
-	r.Post("/flights", res.create)
-	r.Put("/flights/<id>", res.update)
-	r.Delete("/flights/<id>", res.delete)
+	r.Get("/flights/<id>/status/history", res.statusHistory)
+	r.Get("/flights/<id>/seats", res.seats)
+
+	// the following endpoints require the admin or operator role as well
+	manage := auth.RequireRole(entity.RoleAdmin, entity.RoleOperator)
+	r.Post("/flights", manage, res.create)
+	r.Put("/flights/<id>", manage, res.update)
+	r.Patch("/flights/<id>", manage, res.patch)
+	r.Delete("/flights/<id>", manage, res.delete)
+	r.Post("/flights/<id>/status", manage, res.changeStatus)
 }
 
 type resource struct {
@@ -33,20 +49,45 @@ func (r resource) get(c *routing.Context) error {
 		return err
 	}
 
+	tag := etag(flight)
+	c.Response.Header().Set("ETag", tag)
+	if header := c.Request.Header.Get("If-None-Match"); header != "" {
+		for _, t := range strings.Split(header, ",") {
+			if t = strings.TrimPrefix(strings.TrimSpace(t), "W/"); t == tag || t == "*" {
+				c.Response.WriteHeader(http.StatusNotModified)
+				return nil
+			}
+		}
+	}
 	return c.Write(flight)
 }
 
 func (r resource) query(c *routing.Context) error {
 
 	input := SearchFlightRequest{
-		Name:          c.Query("name"),
-		Departure:     c.Query("departure"),
-		Destination:   c.Query("destination"),
-		DepartureTime: c.Query("departure_time"),
+		Name:            c.Query("name"),
+		Departure:       c.Query("departure"),
+		Destination:     c.Query("destination"),
+		DepartureTime:   c.Query("departure_time"),
+		DepartureFrom:   c.Query("departure_from"),
+		DepartureTo:     c.Query("departure_to"),
+		ArrivalFrom:     c.Query("arrival_from"),
+		ArrivalTo:       c.Query("arrival_to"),
+		MinFare:         c.Query("min_fare"),
+		MaxFare:         c.Query("max_fare"),
+		Currency:        strings.ToUpper(c.Query("currency")),
+		DisplayCurrency: strings.ToUpper(c.Query("display_currency")),
+		MinDuration:     strings.ToUpper(c.Query("min_duration")),
+		MaxDuration:     strings.ToUpper(c.Query("max_duration")),
+		Status:          strings.ToLower(c.Query("status")),
+		AvailableSeats:  c.Query("available_seats"),
+		Q:               strings.TrimSpace(c.Query("q")),
+		Sort:            c.Query(pagination.SortVar),
+		Cursor:          c.Query(pagination.CursorVar),
 	}
 
 	ctx := c.Request.Context()
-	count, err := r.service.Count(ctx)
+	count, err := r.service.Count(ctx, input)
 	if err != nil {
 		return err
 	}
@@ -56,6 +97,12 @@ func (r resource) query(c *routing.Context) error {
 		return err
 	}
 	pages.Items = flights
+	if len(flights) > 0 && len(flights) == pages.Limit() {
+		pages.NextCursor = r.service.Cursor(input, flights[len(flights)-1])
+	}
+	if link := pages.BuildLinkHeader(linkBaseURL(c), pagination.DefaultPageSize); link != "" {
+		c.Response.Header().Set("Link", link)
+	}
 	return c.Write(pages)
 }
 
@@ -80,11 +127,43 @@ func (r resource) update(c *routing.Context) error {
 		return errors.BadRequest("")
 	}
 
-	flight, err := r.service.Update(c.Request.Context(), c.Param("id"), input)
+	version, err := r.ifMatchVersion(c)
+	if err != nil {
+		return err
+	}
+	flight, err := r.service.Update(c.Request.Context(), c.Param("id"), version, input)
+	if err != nil {
+		return err
+	}
+
+	c.Response.Header().Set("ETag", etag(flight))
+	return c.Write(flight)
+}
+
+func (r resource) patch(c *routing.Context) error {
+	if mediaType, _, _ := mime.ParseMediaType(c.Request.Header.Get("Content-Type")); mediaType != mergepatch.ContentType {
+		return errors.UnsupportedMediaType(fmt.Sprintf("The request body must be a JSON merge patch (%v).", mergepatch.ContentType))
+	}
+	patch, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(patch, &fields); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	version, err := r.ifMatchVersion(c)
+	if err != nil {
+		return err
+	}
+	flight, err := r.service.Patch(c.Request.Context(), c.Param("id"), version, patch)
 	if err != nil {
 		return err
 	}
 
+	c.Response.Header().Set("ETag", etag(flight))
 	return c.Write(flight)
 }
 
@@ -96,3 +175,96 @@ func (r resource) delete(c *routing.Context) error {
 
 	return c.Write(flight)
 }
+
+func (r resource) changeStatus(c *routing.Context) error {
+	var input ChangeStatusRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	version, err := r.ifMatchVersion(c)
+	if err != nil {
+		return err
+	}
+	flight, err := r.service.ChangeStatus(c.Request.Context(), c.Param("id"), version, input)
+	if err != nil {
+		return err
+	}
+
+	c.Response.Header().Set("ETag", etag(flight))
+	return c.Write(flight)
+}
+
+func (r resource) statusHistory(c *routing.Context) error {
+	changes, err := r.service.StatusHistory(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(changes)
+}
+
+func (r resource) seats(c *routing.Context) error {
+	seatMap, err := r.service.Seats(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(seatMap)
+}
+
+// linkBaseURL returns the request URL without the pagination parameters,
+// so that the pagination links keep the search filters of the request.
+func linkBaseURL(c *routing.Context) string {
+	query := c.Request.URL.Query()
+	query.Del(pagination.PageVar)
+	query.Del(pagination.PageSizeVar)
+	query.Del(pagination.SortVar)
+	query.Del(pagination.CursorVar)
+	if len(query) == 0 {
+		return c.Request.URL.Path
+	}
+	return c.Request.URL.Path + "?" + query.Encode()
+}
+
+// etag returns the entity tag identifying the version of the flight.
+func etag(flight Flight) string {
+	return fmt.Sprintf(`"%v"`, flight.Version)
+}
+
+// ifMatchVersion returns the flight version required by the If-Match header of the request.
+// Zero is returned if the header is absent or is "*".
+// If the header lists several entity tags, the current flight version is returned if it is one of them.
+func (r resource) ifMatchVersion(c *routing.Context) (int, error) {
+	header := strings.TrimSpace(c.Request.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	var versions []int
+	for _, t := range strings.Split(header, ",") {
+		// If-Match uses the strong comparison, so weak entity tags never match
+		t = strings.TrimSpace(t)
+		if len(t) < 2 || t[0] != '"' || t[len(t)-1] != '"' {
+			continue
+		}
+		if version, err := strconv.Atoi(t[1 : len(t)-1]); err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 1 {
+		return versions[0], nil
+	}
+	if len(versions) > 1 {
+		flight, err := r.service.Get(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			return 0, err
+		}
+		for _, version := range versions {
+			if version == flight.Version {
+				return version, nil
+			}
+		}
+	}
+	return 0, ErrVersionConflict
+}
@@ -5,10 +5,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/nvnoskov/dynamo-backend/internal/aircraft"
+	"github.com/nvnoskov/dynamo-backend/internal/airport"
 	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/claim"
 	"github.com/nvnoskov/dynamo-backend/internal/entity"
 	"github.com/nvnoskov/dynamo-backend/internal/test"
 	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/nvnoskov/dynamo-backend/pkg/mergepatch"
+	"github.com/nvnoskov/dynamo-backend/pkg/pagination"
 )
 
 func TestAPI(t *testing.T) {
@@ -16,40 +21,132 @@ func TestAPI(t *testing.T) {
 	router := test.MockRouter(logger)
 	repo := &mockRepository{items: []entity.Flight{
 		{
-			ID:            "123",
-			Name:          "flight123",
-			Number:        "123",
-			Departure:     "Minsk",
-			DepartureTime: time.Now(),
-			Destination:   "Stockholm",
-			ArrivalTime:   time.Now(),
-			Fare:          "100EUR",
-			Duration:      "3 hours",
-			CreatedAt:     time.Now(),
-			UpdatedAt:     time.Now(),
+			ID:              "123",
+			Name:            "flight123",
+			Number:          "123",
+			Departure:       "MSQ",
+			DepartureTime:   time.Now(),
+			Destination:     "ARN",
+			ArrivalTime:     time.Now(),
+			Fare:            "100EUR",
+			FareAmount:      10000,
+			FareCurrency:    "EUR",
+			DurationMinutes: 180,
+			Version:         1,
+			Status:          entity.FlightScheduled,
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
 		},
 	}}
 	RegisterHandlers(router.Group(""),
 		NewService(repo,
+			mockTransactional,
+			airport.MockService{},
+			aircraft.MockService{},
+			&claim.MockService{},
+			entity.ExchangeRates{"EUR": 1, "USD": 1.2},
+			"cursor-key",
 			logger),
 		auth.MockAuthHandler, logger)
-	header := auth.MockAuthHeader()
+	header := auth.MockRoleAuthHeader(entity.RoleAdmin)
+	customer := auth.MockRoleAuthHeader(entity.RoleCustomer)
+	withHeader := func(name, value string) http.Header {
+		h := auth.MockRoleAuthHeader(entity.RoleAdmin)
+		h.Set(name, value)
+		return h
+	}
+	patch := withHeader("Content-Type", mergepatch.ContentType)
+	withPatchHeader := func(name, value string) http.Header {
+		h := withHeader(name, value)
+		h.Set("Content-Type", mergepatch.ContentType)
+		return h
+	}
 
 	tests := []test.APITestCase{
 		{"get all", "GET", "/flights", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get filtered count", "GET", "/flights?destination=LED", "", header, http.StatusOK, `*"total_count":0*`},
+		{"get display currency", "GET", "/flights?display_currency=usd", "", header, http.StatusOK, `*"display_fare":"120USD"*`},
+		{"get fare range", "GET", "/flights?min_fare=50&max_fare=150.50&currency=EUR", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get fare range without currency", "GET", "/flights?min_fare=50", "", header, http.StatusBadRequest, `*currency*`},
+		{"get invalid fare range", "GET", "/flights?max_fare=abc&currency=EUR", "", header, http.StatusBadRequest, `*max_fare*`},
 		{"get 123", "GET", "/flights/123", "", header, http.StatusOK, `*flight123*`},
+		{"get duration", "GET", "/flights/123", "", header, http.StatusOK, `*"duration":"3 hours","duration_iso":"PT3H"*`},
+		{"get duration range", "GET", "/flights?min_duration=120&max_duration=pt4h", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get invalid duration range", "GET", "/flights?min_duration=3h", "", header, http.StatusBadRequest, `*min_duration*`},
+		{"get sorted", "GET", "/flights?sort=departure_time,-fare", "", header, http.StatusOK, `*"sort":"departure_time,-fare"*`},
+		{"get invalid sort", "GET", "/flights?sort=fare,password", "", header, http.StatusBadRequest, `*unknown sort key \"password\"*`},
+		{"get duplicate sort", "GET", "/flights?sort=fare,-fare", "", header, http.StatusBadRequest, `*sort*`},
+		{"get next cursor", "GET", "/flights?per_page=1", "", header, http.StatusOK, `*"next_cursor":"*`},
+		{"get with cursor", "GET", "/flights?per_page=1&cursor=" + pagination.EncodeCursor([]byte("cursor-key"), "", "", "2020-10-01T14:36:38Z", "100"), "", header, http.StatusOK, `*"cursor":"*`},
+		{"get forged cursor", "GET", "/flights?cursor=" + pagination.EncodeCursor([]byte("other"), "", "", "2020-10-01T14:36:38Z", "100"), "", header, http.StatusBadRequest, `*cursor*`},
+		{"get cursor of other sort", "GET", "/flights?sort=-fare&cursor=" + pagination.EncodeCursor([]byte("cursor-key"), "", "", "2020-10-01T14:36:38Z", "100"), "", header, http.StatusBadRequest, `*cursor*`},
+		{"get full-text", "GET", "/flights?q=FLIGHT", "", header, http.StatusOK, `*"score":1*`},
+		{"get full-text no match", "GET", "/flights?q=malmo", "", header, http.StatusOK, `*"total_count":0*`},
+		{"get relevance sort", "GET", "/flights?q=flight&sort=-relevance,name", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get relevance sort without q", "GET", "/flights?sort=-relevance", "", header, http.StatusBadRequest, `*sort*`},
+		{"get full-text cursor", "GET", "/flights?q=flight&cursor=" + pagination.EncodeCursor([]byte("cursor-key"), "-relevance", "flight", "0.5", "100"), "", header, http.StatusOK, `*"score":1*`},
+		{"get cursor of other query", "GET", "/flights?q=other&cursor=" + pagination.EncodeCursor([]byte("cursor-key"), "-relevance", "flight", "0.5", "100"), "", header, http.StatusBadRequest, `*cursor*`},
+		{"get time range", "GET", "/flights?departure_from=2020-10-01&departure_to=2020-10-01T23:00:00%2B02:00&arrival_to=2020-10-02", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get invalid time range", "GET", "/flights?departure_from=yesterday&arrival_to=2020-13-01", "", header, http.StatusBadRequest, `*"field":"arrival_to"*`},
+		{"get invalid departure day", "GET", "/flights?departure_time=01.10.2020", "", header, http.StatusBadRequest, `*departure_time*`},
 		{"get unknown", "GET", "/flights/1234", "", header, http.StatusNotFound, ""},
-		{"create ok", "POST", "/flights", `{"name": "BOEING 737-400","number": "UR-CSV","departure": "MALMÖ, SWEDEN2","departure_time": "2020-10-01T14:36:38Z","destination": "MERZIFON, TURKEY","arrival_time": "2020-10-01T17:36:38Z","fare": "100EUR"}`, header, http.StatusCreated, "*BOEING 737-400*"},
+		{"create ok", "POST", "/flights", `{"name": "BOEING 737-400","number": "UR-CSV","departure": "MMX","departure_time": "2020-10-01T14:36:38Z","destination": "MZH","arrival_time": "2020-10-01T17:36:38Z","fare": "100EUR"}`, header, http.StatusCreated, "*BOEING 737-400*"},
 		{"create ok count", "GET", "/flights", "", header, http.StatusOK, `*"total_count":2*`},
-		{"create auth error", "POST", "/flights", `{"name": "BOEING 737-400","number": "UR-CSV","departure": "MALMÖ, SWEDEN2","departure_time": "2020-10-01T14:36:38Z","destination": "MERZIFON, TURKEY","arrival_time": "2020-10-01T17:36:38Z","fare": "100EUR"}`, nil, http.StatusUnauthorized, ""},
+		{"create unknown airport", "POST", "/flights", `{"name": "BOEING 737-400","number": "UR-CSV","departure": "XXX","departure_time": "2020-10-01T14:36:38Z","destination": "MZH","arrival_time": "2020-10-01T17:36:38Z","fare": "100EUR"}`, header, http.StatusBadRequest, `*"field":"departure"*`},
+		{"create arrival before departure", "POST", "/flights", `{"name": "BOEING 737-400","number": "UR-CSV","departure": "MMX","departure_time": "2020-10-01T14:36:38Z","destination": "MZH","arrival_time": "2020-10-01T13:36:38Z","fare": "100EUR"}`, header, http.StatusBadRequest, `*{"field":"arrival_time","error":"must be later than departure_time"}*`},
+		{"create same airports", "POST", "/flights", `{"name": "BOEING 737-400","number": "UR-CSV","departure": "MMX","departure_time": "2020-10-01T14:36:38Z","destination": "MMX","arrival_time": "2020-10-01T17:36:38Z","fare": "100EUR"}`, header, http.StatusBadRequest, `*{"field":"destination","error":"must be different from departure"}*`},
+		{"create auth error", "POST", "/flights", `{"name": "BOEING 737-400","number": "UR-CSV","departure": "MMX","departure_time": "2020-10-01T14:36:38Z","destination": "MZH","arrival_time": "2020-10-01T17:36:38Z","fare": "100EUR"}`, nil, http.StatusUnauthorized, ""},
+		{"create customer", "POST", "/flights", `{"name": "BOEING 737-400","number": "UR-CSV","departure": "MMX","departure_time": "2020-10-01T14:36:38Z","destination": "MZH","arrival_time": "2020-10-01T17:36:38Z","fare": "100EUR"}`, customer, http.StatusForbidden, ""},
+		{"create operator", "POST", "/flights", `{"name":"test"}`, auth.MockRoleAuthHeader(entity.RoleOperator), http.StatusBadRequest, ""},
 		{"create input error", "POST", "/flights", `"name":"test"}`, header, http.StatusBadRequest, ""},
-		{"update ok", "PUT", "/flights/123", `{"name": "flightxyz","number": "UR-CSV","departure": "MALMÖ, SWEDEN2","departure_time": "2020-10-01T14:36:38Z","destination": "MERZIFON, TURKEY","arrival_time": "2020-10-01T17:36:38Z","fare": "100EUR"}`, header, http.StatusOK, "*flightxyz*"},
+		{"update ok", "PUT", "/flights/123", `{"name": "flightxyz","number": "UR-CSV","departure": "MMX","departure_time": "2020-10-01T14:36:38Z","destination": "MZH","arrival_time": "2020-10-01T17:36:38Z","fare": "100EUR"}`, header, http.StatusOK, "*flightxyz*"},
 		{"update verify", "GET", "/flights/123", "", header, http.StatusOK, `*flightxyz*`},
+		{"get local time", "GET", "/flights/123", "", header, http.StatusOK, `*"departure_time_local":"2020-10-01T16:36:38+02:00"*`},
 		{"update auth error", "PUT", "/flights/123", `{"name":"flightxyz"}`, nil, http.StatusUnauthorized, ""},
+		{"update customer", "PUT", "/flights/123", `{"name":"flightxyz"}`, customer, http.StatusForbidden, ""},
 		{"update input error", "PUT", "/flights/123", `"name":"flightxyz"}`, header, http.StatusBadRequest, ""},
+		{"patch ok", "PATCH", "/flights/123", `{"fare": "120.50EUR"}`, patch, http.StatusOK, `*"fare":"120.50EUR"*`},
+		{"patch verify", "GET", "/flights/123", "", header, http.StatusOK, `*"name":"flightxyz"*`},
+		{"patch times", "PATCH", "/flights/123", `{"arrival_time": "2020-10-01T18:06:38Z"}`, patch, http.StatusOK, `*"duration_iso":"PT3H30M"*`},
+		{"patch remove required", "PATCH", "/flights/123", `{"name": null}`, patch, http.StatusBadRequest, `*"field":"name"*`},
+		{"patch invalid merged", "PATCH", "/flights/123", `{"arrival_time": "2020-10-01T10:00:00Z"}`, patch, http.StatusBadRequest, `*"field":"arrival_time"*`},
+		{"patch invalid type", "PATCH", "/flights/123", `{"departure_time": 5}`, patch, http.StatusBadRequest, `*"field":"departure_time"*`},
+		{"patch json", "PATCH", "/flights/123", `{"name": "x"}`, header, http.StatusUnsupportedMediaType, ""},
+		{"patch not object", "PATCH", "/flights/123", `["name"]`, patch, http.StatusBadRequest, ""},
+		{"patch unknown", "PATCH", "/flights/1234", `{"name": "x"}`, patch, http.StatusNotFound, ""},
+		{"get not modified", "GET", "/flights/123", "", withHeader("If-None-Match", `"4"`), http.StatusNotModified, ""},
+		{"get weak not modified", "GET", "/flights/123", "", withHeader("If-None-Match", `"1", W/"4"`), http.StatusNotModified, ""},
+		{"get modified", "GET", "/flights/123", "", withHeader("If-None-Match", `"3"`), http.StatusOK, `*"version":4*`},
+		{"patch stale version", "PATCH", "/flights/123", `{"name": "flightabc"}`, withPatchHeader("If-Match", `"3"`), http.StatusPreconditionFailed, ""},
+		{"patch current version", "PATCH", "/flights/123", `{"name": "flightabc"}`, withPatchHeader("If-Match", `"4"`), http.StatusOK, `*"version":5*`},
+		{"update weak version", "PUT", "/flights/123", `{"name": "flightxyz","number": "UR-CSV","departure": "MMX","departure_time": "2020-10-01T14:36:38Z","destination": "MZH","arrival_time": "2020-10-01T17:36:38Z","fare": "100EUR"}`, withHeader("If-Match", `W/"5"`), http.StatusPreconditionFailed, ""},
+		{"update listed version", "PUT", "/flights/123", `{"name": "flightxyz","number": "UR-CSV","departure": "MMX","departure_time": "2020-10-01T14:36:38Z","destination": "MZH","arrival_time": "2020-10-01T17:36:38Z","fare": "100EUR"}`, withHeader("If-Match", `"4", "5"`), http.StatusOK, `*"version":6*`},
+		{"patch auth error", "PATCH", "/flights/123", `{"name": "x"}`, nil, http.StatusUnauthorized, ""},
+		{"get status filter", "GET", "/flights?status=Scheduled,delayed", "", header, http.StatusOK, `*"total_count":2*`},
+		{"get status filter none", "GET", "/flights?status=cancelled", "", header, http.StatusOK, `*"total_count":0*`},
+		{"get invalid status filter", "GET", "/flights?status=landed", "", header, http.StatusBadRequest, `*unknown flight status \"landed\"*`},
+		{"change status ok", "POST", "/flights/123/status", `{"status": "delayed", "reason": "late inbound aircraft", "estimated_departure_time": "2020-10-01T15:36:38Z"}`, header, http.StatusOK, `*"status":"delayed","status_reason":"late inbound aircraft"*`},
+		{"change status estimated arrival", "GET", "/flights/123", "", header, http.StatusOK, `*"estimated_arrival_time":"2020-10-01T18:36:38Z"*`},
+		{"change status not allowed", "POST", "/flights/123/status", `{"status": "arrived", "actual_arrival_time": "2020-10-01T18:36:38Z"}`, header, http.StatusConflict, `*from delayed to arrived*`},
+		{"change status invalid", "POST", "/flights/123/status", `{"status": "delayed"}`, header, http.StatusBadRequest, `*"field":"estimated_departure_time"*`},
+		{"change status stale version", "POST", "/flights/123/status", `{"status": "boarding"}`, withHeader("If-Match", `"6"`), http.StatusPreconditionFailed, ""},
+		{"change status input error", "POST", "/flights/123/status", `"status"}`, header, http.StatusBadRequest, ""},
+		{"change status unknown", "POST", "/flights/1234/status", `{"status": "boarding"}`, header, http.StatusNotFound, ""},
+		{"change status auth error", "POST", "/flights/123/status", `{"status": "boarding"}`, nil, http.StatusUnauthorized, ""},
+		{"status history", "GET", "/flights/123/status/history", "", header, http.StatusOK, `*"previous_status":"scheduled","status":"delayed"*`},
+		{"status history unknown", "GET", "/flights/1234/status/history", "", header, http.StatusNotFound, ""},
+		{"patch aircraft", "PATCH", "/flights/123", `{"aircraft_id": "a320"}`, patch, http.StatusOK, `*"aircraft_id":"a320"*`},
+		{"patch unknown aircraft", "PATCH", "/flights/123", `{"aircraft_id": "b737"}`, patch, http.StatusBadRequest, `*"field":"aircraft_id"*`},
+		{"get seats", "GET", "/flights/123/seats", "", header, http.StatusOK, `*"capacity":8,"available":8*`},
+		{"get seat", "GET", "/flights/123/seats", "", header, http.StatusOK, `*{"number":"1A","letter":"A","available":true}*`},
+		{"get seats unknown", "GET", "/flights/1234/seats", "", header, http.StatusNotFound, ""},
+		{"get available seats filter", "GET", "/flights?available_seats=8", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get available seats filter none", "GET", "/flights?available_seats=9", "", header, http.StatusOK, `*"total_count":0*`},
+		{"get invalid available seats filter", "GET", "/flights?available_seats=-1", "", header, http.StatusBadRequest, `*available_seats*`},
 		{"delete ok", "DELETE", "/flights/123", ``, header, http.StatusOK, "*flightxyz*"},
 		{"delete verify", "DELETE", "/flights/123", ``, header, http.StatusNotFound, ""},
 		{"delete auth error", "DELETE", "/flights/123", ``, nil, http.StatusUnauthorized, ""},
+		{"delete customer", "DELETE", "/flights/123", ``, customer, http.StatusForbidden, ""},
 	}
 	for _, tc := range tests {
 		test.Endpoint(t, router, tc)
@@ -0,0 +1,21 @@
+package flight
+
+import (
+	"fmt"
+
+	"github.com/nvnoskov/dynamo-backend/internal/errors"
+)
+
+// ErrVersionConflict is returned when a flight being updated was modified since it was read.
+var ErrVersionConflict = errors.PreconditionFailed("")
+
+// ErrHasPassengers is returned when deleting a flight that has passengers.
+var ErrHasPassengers = errors.Conflict("the flight has passengers")
+
+// ErrHasClaims is returned when deleting a flight that has claimed or waitlisted seats.
+var ErrHasClaims = errors.Conflict("the flight has seat claims")
+
+// errStatusTransition returns the error of a status change the flight status state machine doesn't allow.
+func errStatusTransition(from, to string) error {
+	return errors.Conflict(fmt.Sprintf("cannot change the flight status from %v to %v", from, to))
+}
@@ -2,9 +2,13 @@ package flight
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/nvnoskov/dynamo-backend/internal/aircraft"
 	"github.com/nvnoskov/dynamo-backend/internal/entity"
 	"github.com/nvnoskov/dynamo-backend/pkg/dbcontext"
 	"github.com/nvnoskov/dynamo-backend/pkg/log"
@@ -14,27 +18,77 @@ import (
 type Repository interface {
 	// Get returns the flight with the specified flight ID.
 	Get(ctx context.Context, id string) (entity.Flight, error)
-	// Count returns the number of flights.
-	Count(ctx context.Context) (int, error)
+	// Lock returns the flight with the specified flight ID and locks it until the end of the transaction.
+	Lock(ctx context.Context, id string) (entity.Flight, error)
+	// Count returns the number of flights matching the search request.
+	Count(ctx context.Context, req SearchFlightRequest) (int, error)
 	// Query returns the list of flights with the given offset and limit.
-	Query(ctx context.Context, req SearchFlightRequest, offset, limit int) ([]entity.Flight, error)
+	Query(ctx context.Context, req SearchFlightRequest, offset, limit int) ([]SearchResult, error)
 	// Create saves a new flight in the storage.
 	Create(ctx context.Context, flight entity.Flight) error
 	// Update updates the flight with given ID in the storage.
 	Update(ctx context.Context, flight entity.Flight) error
 	// Delete removes the flight with given ID from the storage.
+	// It fails with aircraft.ErrSeatsTaken if seats of the flight are held or booked,
+	// with ErrHasPassengers if the flight has passengers and with ErrHasClaims if it has claimed or waitlisted seats.
 	Delete(ctx context.Context, id string) error
+	// UpdateStatus updates the flight with given ID in the storage and records the change of its status.
+	UpdateStatus(ctx context.Context, flight entity.Flight, change entity.FlightStatusChange) error
+	// StatusChanges returns the status changes of the flight with given ID in the order they were made.
+	StatusChanges(ctx context.Context, flightID string) ([]entity.FlightStatusChange, error)
+	// Seats returns the seats of the flight with given ID ordered by row and letter.
+	Seats(ctx context.Context, flightID string) ([]entity.Seat, error)
 }
 
+// SearchResult is a flight found by Query together with its relevance to the full-text query of the search.
+type SearchResult struct {
+	entity.Flight
+	Score float64 `db:"score"`
+}
+
+// sortColumns maps the sort keys accepted by Query to the flight table columns.
+var sortColumns = map[string]string{
+	"name":           "name",
+	"number":         "number",
+	"departure":      "departure",
+	"departure_time": "departure_time",
+	"destination":    "destination",
+	"arrival_time":   "arrival_time",
+	"fare":           "fare_amount",
+	"duration":       "duration_minutes",
+	"created_at":     "created_at",
+	"updated_at":     "updated_at",
+}
+
+// defaultSort is the sort order used when the search request specifies none.
+const defaultSort = "departure_time"
+
+// relevanceSort is the sort key ordering the results of a full-text search by their relevance.
+const relevanceSort = "relevance"
+
+const (
+	// matchExp matches the flights whose name, number or airports contain the words of the full-text query
+	// bound to the "q" parameter, ignoring case and accents and tolerating typos.
+	// The airports are also matched by their city and name.
+	matchExp = "search_vector @@ plainto_tsquery('simple', lower(f_unaccent({:q})))" +
+		" OR lower(f_unaccent({:q})) <% search_text" +
+		" OR departure IN (SELECT code FROM airport WHERE lower(f_unaccent({:q})) <% lower(f_unaccent(city || ' ' || name)))" +
+		" OR destination IN (SELECT code FROM airport WHERE lower(f_unaccent({:q})) <% lower(f_unaccent(city || ' ' || name)))"
+	// scoreExp is the relevance of a flight to the full-text query bound to the "q" parameter.
+	scoreExp = "(ts_rank(search_vector, plainto_tsquery('simple', lower(f_unaccent({:q}))))" +
+		" + word_similarity(lower(f_unaccent({:q})), search_text))"
+)
+
 // repository persists flights in database
 type repository struct {
-	db     *dbcontext.DB
-	logger log.Logger
+	db       *dbcontext.DB
+	aircraft aircraft.Repository
+	logger   log.Logger
 }
 
-// NewRepository creates a new flight repository
-func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
-	return repository{db, logger}
+// NewRepository creates a new flight repository managing the seats of the flights with the aircraft repository
+func NewRepository(db *dbcontext.DB, aircraft aircraft.Repository, logger log.Logger) Repository {
+	return repository{db, aircraft, logger}
 }
 
 // Get reads the flight with the specified ID from the database.
@@ -44,37 +98,167 @@ func (r repository) Get(ctx context.Context, id string) (entity.Flight, error) {
 	return flight, err
 }
 
+// Lock reads the flight with the specified ID from the database and locks its row,
+// so that its seats can't be claimed or booked until the end of the transaction.
+func (r repository) Lock(ctx context.Context, id string) (entity.Flight, error) {
+	var flight entity.Flight
+	query := r.db.With(ctx).Select().From("flight").Where(dbx.HashExp{"id": id}).Build()
+	err := r.db.With(ctx).NewQuery(query.SQL() + " FOR UPDATE").Bind(query.Params()).One(&flight)
+	return flight, err
+}
+
 // Create saves a new flight record in the database.
-// It returns the ID of the newly inserted flight record.
+// The seats of the flight are generated from its aircraft configuration.
 func (r repository) Create(ctx context.Context, flight entity.Flight) error {
-	return r.db.With(ctx).Model(&flight).Insert()
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		if err := r.db.With(ctx).Model(&flight).Insert(); err != nil {
+			return err
+		}
+		if flight.AircraftID == nil {
+			return nil
+		}
+		return r.aircraft.GenerateSeats(ctx, flight.ID)
+	})
 }
 
 // Update saves the changes to an flight in the database.
+// The changes are saved only if the stored flight version still equals flight.Version,
+// in which case the stored version is incremented. Otherwise ErrVersionConflict is returned.
 func (r repository) Update(ctx context.Context, flight entity.Flight) error {
-	return r.db.With(ctx).Model(&flight).Update()
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		return r.update(ctx, flight)
+	})
 }
 
-// Delete deletes an flight with the specified ID from the database.
-func (r repository) Delete(ctx context.Context, id string) error {
-	flight, err := r.Get(ctx, id)
+// UpdateStatus saves the changes to a flight and its status change in the database in a single transaction.
+// Like Update, it fails with ErrVersionConflict if the flight was modified since it was read.
+func (r repository) UpdateStatus(ctx context.Context, flight entity.Flight, change entity.FlightStatusChange) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		if err := r.update(ctx, flight); err != nil {
+			return err
+		}
+		return r.db.With(ctx).Model(&change).Insert()
+	})
+}
+
+// update saves the flight within a transaction if its stored version equals flight.Version.
+// The seats of the flight are generated again if its aircraft configuration changes,
+// which fails with aircraft.ErrSeatsTaken if some of them are held or booked.
+func (r repository) update(ctx context.Context, flight entity.Flight) error {
+	stored, err := r.Get(ctx, flight.ID)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.With(ctx).Update("flight",
+		dbx.Params{"version": dbx.NewExp("version+1")},
+		dbx.HashExp{"id": flight.ID, "version": flight.Version},
+	).Execute()
 	if err != nil {
 		return err
 	}
-	return r.db.With(ctx).Model(&flight).Delete()
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return ErrVersionConflict
+	}
+	flight.Version++
+	// the claimed and taken seats are only changed by the seat claims and the bookings of the flight
+	if err := r.db.With(ctx).Model(&flight).Exclude("ClaimedSeats", "TakenSeats").Update(); err != nil {
+		return err
+	}
+	if aircraft.SameID(stored.AircraftID, flight.AircraftID) {
+		return nil
+	}
+	return r.aircraft.GenerateSeats(ctx, flight.ID)
+}
+
+// Seats reads the seats of the flight with the specified ID from the database.
+func (r repository) Seats(ctx context.Context, flightID string) ([]entity.Seat, error) {
+	var seats []entity.Seat
+	err := r.db.With(ctx).
+		Select().
+		From("seat").
+		Where(dbx.HashExp{"flight_id": flightID}).
+		OrderBy("row", "letter").
+		All(&seats)
+	return seats, err
+}
+
+// StatusChanges reads the status changes of the flight with the specified ID from the database.
+func (r repository) StatusChanges(ctx context.Context, flightID string) ([]entity.FlightStatusChange, error) {
+	var changes []entity.FlightStatusChange
+	err := r.db.With(ctx).
+		Select().
+		From("flight_status_change").
+		Where(dbx.HashExp{"flight_id": flightID}).
+		OrderBy("created_at", "id").
+		All(&changes)
+	return changes, err
+}
+
+// Delete deletes an flight with the specified ID together with its seats from the database.
+// The flight is locked while checked, so that no passenger or seat claim can be added meanwhile.
+// Its status changes and released seat claims are removed by the database when the flight is.
+func (r repository) Delete(ctx context.Context, id string) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		var flight entity.Flight
+		query := r.db.With(ctx).Select().From("flight").Where(dbx.HashExp{"id": id}).Build()
+		if err := r.db.With(ctx).NewQuery(query.SQL() + " FOR UPDATE").Bind(query.Params()).One(&flight); err != nil {
+			return err
+		}
+		var passengers int
+		if err := r.db.With(ctx).Select("COUNT(*)").From("passenger").Where(dbx.HashExp{"flight_id": id}).Row(&passengers); err != nil {
+			return err
+		} else if passengers > 0 {
+			return ErrHasPassengers
+		}
+		var claims int
+		if err := r.db.With(ctx).Select("COUNT(*)").From("seat_claim").Where(dbx.And(
+			dbx.HashExp{"flight_id": id},
+			dbx.Not(dbx.HashExp{"status": entity.ClaimReleased}),
+		)).Row(&claims); err != nil {
+			return err
+		} else if claims > 0 {
+			return ErrHasClaims
+		}
+		if err := r.aircraft.DeleteSeats(ctx, id); err != nil {
+			return err
+		}
+		return r.db.With(ctx).Model(&flight).Delete()
+	})
 }
 
-// Count returns the number of the flight records in the database.
-func (r repository) Count(ctx context.Context) (int, error) {
+// Count returns the number of the flight records matching the search request in the database.
+func (r repository) Count(ctx context.Context, req SearchFlightRequest) (int, error) {
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("flight").Row(&count)
+	err := r.db.With(ctx).Select("COUNT(*)").From("flight").Where(searchExp(req)).Row(&count)
 	return count, err
 }
 
-// Query retrieves the flight records with the specified offset and limit from the database.
-func (r repository) Query(ctx context.Context, req SearchFlightRequest, offset, limit int) ([]entity.Flight, error) {
-	var flights []entity.Flight
+// Query retrieves the flight records matching the search request with the specified offset and limit from the database.
+// If the request has the After sort key values, only the flights following them in the sort order are retrieved.
+func (r repository) Query(ctx context.Context, req SearchFlightRequest, offset, limit int) ([]SearchResult, error) {
+	var flights []SearchResult
+	keys := sortKeys(req.sortOrder())
+	query := r.db.With(ctx).Select("*").From("flight")
+	if req.Q != "" {
+		query.AndSelect(scoreExp + " AS score").Bind(dbx.Params{"q": req.Q})
+	}
+	err := query.
+		Where(dbx.And(searchExp(req), seekExp(keys, req.After))).
+		OrderBy(orderBy(keys)...).
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&flights)
+	return flights, err
+}
+
+// searchExp builds the condition matching the flights with the filters of the search request.
+func searchExp(req SearchFlightRequest) dbx.Expression {
 	whereOptions := make(dbx.HashExp)
+	if req.Q != "" {
+		whereOptions["q"] = dbx.NewExp("("+matchExp+")", dbx.Params{"q": req.Q})
+	}
 	if req.Name != "" {
 		whereOptions["name"] = req.Name
 	}
@@ -82,21 +266,174 @@ func (r repository) Query(ctx context.Context, req SearchFlightRequest, offset,
 		whereOptions["departure"] = req.Departure
 	}
 	if req.DepartureTime != "" {
-		departureTime, err := time.Parse("2006-01-02", req.DepartureTime)
-		if err == nil {
-			whereOptions["departure_time"] = dbx.Between("departure_time", departureTime, departureTime.Add(time.Hour*24)) //departureTime
-		}
+		whereOptions["departure_time"] = dbx.And(
+			timeBoundExp("departure_time", "departure", "departure_day_from", req.DepartureTime, false),
+			timeBoundExp("departure_time", "departure", "departure_day_to", req.DepartureTime, true),
+		)
+	}
+	if req.DepartureFrom != "" {
+		whereOptions["departure_from"] = timeBoundExp("departure_time", "departure", "departure_from", req.DepartureFrom, false)
+	}
+	if req.DepartureTo != "" {
+		whereOptions["departure_to"] = timeBoundExp("departure_time", "departure", "departure_to", req.DepartureTo, true)
+	}
+	if req.ArrivalFrom != "" {
+		whereOptions["arrival_from"] = timeBoundExp("arrival_time", "destination", "arrival_from", req.ArrivalFrom, false)
+	}
+	if req.ArrivalTo != "" {
+		whereOptions["arrival_to"] = timeBoundExp("arrival_time", "destination", "arrival_to", req.ArrivalTo, true)
 	}
 	if req.Destination != "" {
 		whereOptions["destination"] = req.Destination
 	}
+	if req.Status != "" {
+		var statuses []interface{}
+		for _, status := range strings.Split(req.Status, ",") {
+			statuses = append(statuses, strings.TrimSpace(status))
+		}
+		whereOptions["status"] = dbx.In("status", statuses...)
+	}
+	if req.Currency != "" {
+		whereOptions["fare_currency"] = req.Currency
+	}
+	if seats, err := strconv.Atoi(req.AvailableSeats); err == nil {
+		whereOptions["available_seats"] = dbx.NewExp("(SELECT COUNT(*) FROM seat WHERE seat.flight_id=flight.id AND seat.status={:seat_status})>={:available_seats}",
+			dbx.Params{"seat_status": entity.SeatAvailable, "available_seats": seats})
+	}
+	if req.MinFare != "" {
+		if fare, err := entity.ParseMoney(req.MinFare + req.Currency); err == nil {
+			whereOptions["min_fare"] = dbx.NewExp("fare_amount>={:min_fare}", dbx.Params{"min_fare": fare.Amount})
+		}
+	}
+	if req.MaxFare != "" {
+		if fare, err := entity.ParseMoney(req.MaxFare + req.Currency); err == nil {
+			whereOptions["max_fare"] = dbx.NewExp("fare_amount<={:max_fare}", dbx.Params{"max_fare": fare.Amount})
+		}
+	}
+	if req.MinDuration != "" {
+		if duration, err := entity.ParseDuration(req.MinDuration); err == nil {
+			whereOptions["min_duration"] = dbx.NewExp("duration_minutes>={:min_duration}", dbx.Params{"min_duration": int(duration / time.Minute)})
+		}
+	}
+	if req.MaxDuration != "" {
+		if duration, err := entity.ParseDuration(req.MaxDuration); err == nil {
+			whereOptions["max_duration"] = dbx.NewExp("duration_minutes<={:max_duration}", dbx.Params{"max_duration": int(duration / time.Minute)})
+		}
+	}
+	return whereOptions
+}
 
-	err := r.db.With(ctx).
-		Select().
-		Where(whereOptions).
-		OrderBy("id").
-		Offset(int64(offset)).
-		Limit(int64(limit)).
-		All(&flights)
-	return flights, err
+// timeBoundExp builds the condition bounding the time column from below, or from above if upper is true.
+// An RFC 3339 bound is an exact instant. A date bound is taken in the time zone of the airport in the
+// airport column, so that an upper date bound includes the whole local day.
+// A bound that cannot be parsed matches no flights.
+func timeBoundExp(column, airportColumn, param, value string, upper bool) dbx.Expression {
+	t, isDate, err := parseTimeBound(value)
+	if err != nil {
+		return dbx.NewExp("0=1")
+	}
+	op := ">="
+	if upper {
+		op = "<="
+	}
+	if !isDate {
+		return dbx.NewExp(fmt.Sprintf("%v%v{:%v}", column, op, param), dbx.Params{param: t})
+	}
+	if upper {
+		op, t = "<", t.AddDate(0, 0, 1)
+	}
+	return dbx.NewExp(fmt.Sprintf("%v%v({:%v}::timestamp AT TIME ZONE "+
+		"coalesce((SELECT timezone FROM airport WHERE code=flight.%v), 'UTC'))", column, op, param, airportColumn),
+		dbx.Params{param: t.Format(dateLayout)})
+}
+
+// sortKey is a flight table column to sort by.
+type sortKey struct {
+	column string
+	desc   bool
+}
+
+// sortKeys converts a comma-separated list of sort keys, each optionally prefixed with "-"
+// for the descending order, into the flight table columns to sort by. Unknown keys are skipped.
+// The relevance key sorts by the score of the full-text search.
+// The flight ID is always appended so that the order is stable.
+func sortKeys(sort string) []sortKey {
+	if sort == "" {
+		sort = defaultSort
+	}
+	var keys []sortKey
+	for _, key := range strings.Split(sort, ",") {
+		key = strings.TrimSpace(key)
+		desc := strings.HasPrefix(key, "-")
+		if column, ok := sortColumns[strings.TrimPrefix(key, "-")]; ok {
+			keys = append(keys, sortKey{column, desc})
+		} else if strings.TrimPrefix(key, "-") == relevanceSort {
+			keys = append(keys, sortKey{scoreExp, desc})
+		}
+	}
+	return append(keys, sortKey{"id", false})
+}
+
+// orderBy returns the ORDER BY columns for the sort keys.
+func orderBy(keys []sortKey) []string {
+	columns := make([]string, len(keys))
+	for i, key := range keys {
+		if key.desc {
+			columns[i] = key.column + " DESC"
+		} else {
+			columns[i] = key.column + " ASC"
+		}
+	}
+	return columns
+}
+
+// seekExp builds the condition matching the flights that follow the given sort key values in the sort order.
+// For the keys (a, -b, id) it is "a>x OR (a=x AND b<y) OR (a=x AND b=y AND id>z)".
+func seekExp(keys []sortKey, after []string) dbx.Expression {
+	if len(after) == 0 || len(after) != len(keys) {
+		return nil
+	}
+	params := dbx.Params{}
+	var conditions, equals []string
+	for i, key := range keys {
+		param := fmt.Sprintf("seek%v", i)
+		params[param] = after[i]
+		op := ">"
+		if key.desc {
+			op = "<"
+		}
+		conditions = append(conditions, "("+strings.Join(append(equals, fmt.Sprintf("%v%v{:%v}", key.column, op, param)), " AND ")+")")
+		equals = append(equals, fmt.Sprintf("%v={:%v}", key.column, param))
+	}
+	return dbx.NewExp(strings.Join(conditions, " OR "), params)
+}
+
+// sortValue returns the value of the search result column as it is stored in a pagination cursor.
+func sortValue(result SearchResult, column string) string {
+	flight := result.Flight
+	switch column {
+	case scoreExp:
+		return strconv.FormatFloat(result.Score, 'g', -1, 64)
+	case "name":
+		return flight.Name
+	case "number":
+		return flight.Number
+	case "departure":
+		return flight.Departure
+	case "departure_time":
+		return flight.DepartureTime.UTC().Format(time.RFC3339Nano)
+	case "destination":
+		return flight.Destination
+	case "arrival_time":
+		return flight.ArrivalTime.UTC().Format(time.RFC3339Nano)
+	case "fare_amount":
+		return strconv.FormatInt(flight.FareAmount, 10)
+	case "duration_minutes":
+		return strconv.Itoa(flight.DurationMinutes)
+	case "created_at":
+		return flight.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "updated_at":
+		return flight.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return flight.ID
 }
@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/nvnoskov/dynamo-backend/internal/aircraft"
 	"github.com/nvnoskov/dynamo-backend/internal/entity"
 	"github.com/nvnoskov/dynamo-backend/internal/test"
 	"github.com/nvnoskov/dynamo-backend/pkg/log"
@@ -15,31 +17,34 @@ import (
 func TestRepository(t *testing.T) {
 	logger, _ := log.NewForTest()
 	db := test.DB(t)
-	test.ResetTables(t, db, "flight")
-	repo := NewRepository(db, logger)
+	test.ResetTables(t, db, "flight", "flight_status_change", "seat", "aircraft")
+	repo := NewRepository(db, aircraft.NewRepository(db, logger), logger)
 
 	ctx := context.Background()
 
 	// initial count
-	count, err := repo.Count(ctx)
+	count, err := repo.Count(ctx, SearchFlightRequest{})
 	assert.Nil(t, err)
 
 	// create
 	err = repo.Create(ctx, entity.Flight{
-		ID:            "test1",
-		Name:          "flight1",
-		Number:        "123",
-		Departure:     "Minsk",
-		DepartureTime: time.Now(),
-		Destination:   "Stockholm",
-		ArrivalTime:   time.Now(),
-		Fare:          "100EUR",
-		Duration:      "2 hours",
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
+		ID:              "test1",
+		Name:            "flight1",
+		Number:          "123",
+		Departure:       "MSQ",
+		DepartureTime:   time.Now(),
+		Destination:     "ARN",
+		ArrivalTime:     time.Now().Add(2 * time.Hour),
+		Fare:            "100EUR",
+		FareAmount:      10000,
+		FareCurrency:    "EUR",
+		DurationMinutes: 120,
+		Status:          entity.FlightScheduled,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
 	})
 	assert.Nil(t, err)
-	count2, _ := repo.Count(ctx)
+	count2, _ := repo.Count(ctx, SearchFlightRequest{})
 	assert.Equal(t, 1, count2-count)
 
 	// get
@@ -49,24 +54,48 @@ func TestRepository(t *testing.T) {
 	_, err = repo.Get(ctx, "test0")
 	assert.Equal(t, sql.ErrNoRows, err)
 
+	// lock within a transaction
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		locked, err := repo.Lock(ctx, "test1")
+		assert.Equal(t, "flight1", locked.Name)
+		return err
+	})
+	assert.Nil(t, err)
+	_, err = repo.Lock(ctx, "test0")
+	assert.Equal(t, sql.ErrNoRows, err)
+
 	// update
 	err = repo.Update(ctx, entity.Flight{
-		ID:            "test1",
-		Name:          "flight1 updated",
-		Departure:     "MOSKOW",
-		Destination:   "MINSK",
-		Fare:          "200 EUR",
-		DepartureTime: time.Now(),
-		ArrivalTime:   time.Now().Add(3 * time.Hour),
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
+		ID:              "test1",
+		Name:            "flight1 updated",
+		Departure:       "SVO",
+		Destination:     "MSQ",
+		Fare:            "200EUR",
+		FareAmount:      20000,
+		FareCurrency:    "EUR",
+		DepartureTime:   time.Now(),
+		ArrivalTime:     time.Now().Add(3 * time.Hour),
+		DurationMinutes: 180,
+		Status:          entity.FlightScheduled,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
 	})
 	assert.Nil(t, err)
 	flight, _ = repo.Get(ctx, "test1")
 	assert.Equal(t, "flight1 updated", flight.Name)
-	assert.Equal(t, "MOSKOW", flight.Departure)
-	assert.Equal(t, "MINSK", flight.Destination)
-	assert.Equal(t, "200 EUR", flight.Fare)
+	assert.Equal(t, "SVO", flight.Departure)
+	assert.Equal(t, "MSQ", flight.Destination)
+	assert.Equal(t, "200EUR", flight.Fare)
+	assert.Equal(t, int64(20000), flight.FareAmount)
+	assert.Equal(t, 1, flight.Version)
+
+	// update with a stale version
+	flight.Name = "flight1 stale"
+	flight.Version = 0
+	err = repo.Update(ctx, flight)
+	assert.Equal(t, ErrVersionConflict, err)
+	err = repo.Update(ctx, entity.Flight{ID: "test0"})
+	assert.Equal(t, sql.ErrNoRows, err)
 
 	// query all
 	flights, err := repo.Query(ctx, SearchFlightRequest{}, 0, count2)
@@ -77,6 +106,136 @@ func TestRepository(t *testing.T) {
 	flightsByName, err := repo.Query(ctx, SearchFlightRequest{Name: "flight1 updated"}, 0, count2)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(flightsByName))
+	countByName, err := repo.Count(ctx, SearchFlightRequest{Name: "flight1 updated"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countByName)
+
+	// query by fare range
+	flightsByFare, err := repo.Query(ctx, SearchFlightRequest{MinFare: "150", MaxFare: "250", Currency: "EUR"}, 0, count2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(flightsByFare))
+	flightsByFare, err = repo.Query(ctx, SearchFlightRequest{MinFare: "250", Currency: "EUR"}, 0, count2)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(flightsByFare))
+
+	// query by duration range
+	flightsByDuration, err := repo.Query(ctx, SearchFlightRequest{MinDuration: "PT2H", MaxDuration: "240"}, 0, count2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(flightsByDuration))
+
+	// full-text query, ignoring case and tolerating typos
+	flightsByText, err := repo.Query(ctx, SearchFlightRequest{Q: "FLIGHTT1"}, 0, count2)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(flightsByText)) {
+		assert.True(t, flightsByText[0].Score > 0)
+	}
+	countByText, err := repo.Count(ctx, SearchFlightRequest{Q: "flight1"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countByText)
+
+	// query by departure and arrival time ranges
+	flightsByTime, err := repo.Query(ctx, SearchFlightRequest{
+		DepartureFrom: time.Now().Add(-time.Hour).Format(time.RFC3339),
+		ArrivalTo:     time.Now().AddDate(0, 0, 1).Format("2006-01-02"),
+	}, 0, count2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(flightsByTime))
+	flightsByTime, err = repo.Query(ctx, SearchFlightRequest{ArrivalTo: "2019-12-31"}, 0, count2)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(flightsByTime))
+
+	// query sorted
+	flightsSorted, err := repo.Query(ctx, SearchFlightRequest{Sort: "-fare,name"}, 0, count2)
+	assert.Nil(t, err)
+	for i := 1; i < len(flightsSorted); i++ {
+		assert.True(t, flightsSorted[i-1].FareAmount >= flightsSorted[i].FareAmount)
+	}
+
+	// status change
+	flight, _ = repo.Get(ctx, "test1")
+	estimated := flight.DepartureTime.Add(time.Hour)
+	change := entity.FlightStatusChange{
+		ID:                     "change1",
+		FlightID:               "test1",
+		PreviousStatus:         entity.FlightScheduled,
+		Status:                 entity.FlightDelayed,
+		Reason:                 "weather",
+		EstimatedDepartureTime: &estimated,
+		CreatedAt:              time.Now(),
+	}
+	flight.ApplyStatus(change)
+	err = repo.UpdateStatus(ctx, flight, change)
+	assert.Nil(t, err)
+	flight, _ = repo.Get(ctx, "test1")
+	assert.Equal(t, entity.FlightDelayed, flight.Status)
+	assert.Equal(t, "weather", flight.StatusReason)
+	assert.True(t, estimated.Equal(*flight.EstimatedDepartureTime))
+	assert.Equal(t, 2, flight.Version)
+	changes, err := repo.StatusChanges(ctx, "test1")
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(changes)) {
+		assert.Equal(t, entity.FlightScheduled, changes[0].PreviousStatus)
+	}
+	flight.Version = 1
+	change.ID = "change2"
+	err = repo.UpdateStatus(ctx, flight, change)
+	assert.Equal(t, ErrVersionConflict, err)
+	changes, _ = repo.StatusChanges(ctx, "test1")
+	assert.Equal(t, 1, len(changes))
+
+	// query by status
+	countByStatus, err := repo.Count(ctx, SearchFlightRequest{Status: "delayed,cancelled"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countByStatus)
+
+	// seats generated from the aircraft configuration
+	assert.Nil(t, db.DB().Model(&entity.Aircraft{
+		ID:        "a320",
+		Name:      "A320",
+		Cabins:    entity.Cabins{{Class: entity.CabinBusiness, FirstRow: 1, LastRow: 2, Letters: "AC"}, {Class: entity.CabinEconomy, FirstRow: 10, LastRow: 11, Letters: "ABC"}},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}).Insert())
+	flight, _ = repo.Get(ctx, "test1")
+	aircraftID := "a320"
+	flight.AircraftID = &aircraftID
+	err = repo.Update(ctx, flight)
+	assert.Nil(t, err)
+	seats, err := repo.Seats(ctx, "test1")
+	assert.Nil(t, err)
+	if assert.Equal(t, 10, len(seats)) {
+		assert.Equal(t, "1A", seats[0].Number)
+		assert.Equal(t, entity.CabinBusiness, seats[0].Cabin)
+		assert.Equal(t, "11C", seats[9].Number)
+		assert.Equal(t, 11, seats[9].Row)
+		assert.Equal(t, entity.SeatAvailable, seats[9].Status)
+	}
+	countBySeats, err := repo.Count(ctx, SearchFlightRequest{AvailableSeats: "10"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, countBySeats)
+	countBySeats, _ = repo.Count(ctx, SearchFlightRequest{AvailableSeats: "11"})
+	assert.Equal(t, 0, countBySeats)
+
+	// a flight with passengers can't be deleted
+	_, err = db.DB().Insert("passenger", dbx.Params{
+		"id": "p1", "flight_id": "test1", "first_name": "Anna", "last_name": "Berg", "date_of_birth": "1990-05-17",
+		"document_type": entity.DocumentPassport, "document_number": "AB1234567", "nationality": "SE",
+		"created_at": time.Now(), "updated_at": time.Now(),
+	}).Execute()
+	assert.Nil(t, err)
+	err = repo.Delete(ctx, "test1")
+	assert.Equal(t, ErrHasPassengers, err)
+	_, err = db.DB().Delete("passenger", dbx.HashExp{"id": "p1"}).Execute()
+	assert.Nil(t, err)
+
+	// nor can a flight with seat claims
+	claim := entity.SeatClaim{ID: "c1", FlightID: "test1", UserID: "100", Seats: 1, Status: entity.ClaimWaitlisted,
+		CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	assert.Nil(t, db.DB().Model(&claim).Insert())
+	err = repo.Delete(ctx, "test1")
+	assert.Equal(t, ErrHasClaims, err)
+	claim.Status = entity.ClaimReleased
+	assert.Nil(t, db.DB().Model(&claim).Update())
 
 	// delete
 	err = repo.Delete(ctx, "test1")
@@ -85,4 +244,39 @@ func TestRepository(t *testing.T) {
 	assert.Equal(t, sql.ErrNoRows, err)
 	err = repo.Delete(ctx, "test1")
 	assert.Equal(t, sql.ErrNoRows, err)
+	seats, _ = repo.Seats(ctx, "test1")
+	assert.Equal(t, 0, len(seats))
+	changes, _ = repo.StatusChanges(ctx, "test1")
+	assert.Equal(t, 0, len(changes))
+}
+
+func Test_orderBy(t *testing.T) {
+	assert.Equal(t, []string{"departure_time ASC", "id ASC"}, orderBy(sortKeys("")))
+	assert.Equal(t, []string{"departure_time ASC", "fare_amount DESC", "id ASC"}, orderBy(sortKeys("departure_time,-fare")))
+	assert.Equal(t, []string{"duration_minutes DESC", "id ASC"}, orderBy(sortKeys(" -duration , unknown")))
+	assert.Equal(t, []string{scoreExp + " DESC", "id ASC"}, orderBy(sortKeys("-relevance")))
+}
+
+func Test_timeBoundExp(t *testing.T) {
+	params := dbx.Params{}
+	exp := timeBoundExp("departure_time", "departure", "from", "2020-10-01T10:00:00+02:00", false)
+	assert.Equal(t, "departure_time>={:from}", exp.Build(nil, params))
+	assert.True(t, time.Date(2020, 10, 1, 8, 0, 0, 0, time.UTC).Equal(params["from"].(time.Time)))
+
+	params = dbx.Params{}
+	exp = timeBoundExp("arrival_time", "destination", "to", "2020-10-01", true)
+	assert.Equal(t, "arrival_time<({:to}::timestamp AT TIME ZONE coalesce((SELECT timezone FROM airport WHERE code=flight.destination), 'UTC'))", exp.Build(nil, params))
+	assert.Equal(t, "2020-10-02", params["to"])
+
+	assert.Equal(t, "0=1", timeBoundExp("arrival_time", "destination", "to", "tomorrow", true).Build(nil, dbx.Params{}))
+}
+
+func Test_seekExp(t *testing.T) {
+	keys := sortKeys("departure_time,-fare")
+	assert.Nil(t, seekExp(keys, nil))
+	assert.Nil(t, seekExp(keys, []string{"a"}))
+	exp := seekExp(keys, []string{"2020-10-01T14:36:38Z", "10000", "123"})
+	params := dbx.Params{}
+	assert.Equal(t, "(departure_time>{:seek0}) OR (departure_time={:seek0} AND fare_amount<{:seek1}) OR (departure_time={:seek0} AND fare_amount={:seek1} AND id>{:seek2})", exp.Build(nil, params))
+	assert.Equal(t, dbx.Params{"seek0": "2020-10-01T14:36:38Z", "seek1": "10000", "seek2": "123"}, params)
 }
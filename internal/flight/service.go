@@ -2,39 +2,67 @@ package flight
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/hako/durafmt"
+	"github.com/nvnoskov/dynamo-backend/internal/aircraft"
+	"github.com/nvnoskov/dynamo-backend/internal/airport"
+	"github.com/nvnoskov/dynamo-backend/internal/claim"
 	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/dbcontext"
 	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/nvnoskov/dynamo-backend/pkg/mergepatch"
+	"github.com/nvnoskov/dynamo-backend/pkg/pagination"
 )
 
 // Service encapsulates usecase logic for flights.
 type Service interface {
 	Get(ctx context.Context, id string) (Flight, error)
 	Query(ctx context.Context, input SearchFlightRequest, offset, limit int) ([]Flight, error)
-	Count(ctx context.Context) (int, error)
+	Count(ctx context.Context, input SearchFlightRequest) (int, error)
+	Cursor(input SearchFlightRequest, last Flight) string
+	Seats(ctx context.Context, id string) (SeatMap, error)
 	Create(ctx context.Context, input CreateFlightRequest) (Flight, error)
-	Update(ctx context.Context, id string, input UpdateFlightRequest) (Flight, error)
+	Update(ctx context.Context, id string, version int, input UpdateFlightRequest) (Flight, error)
+	Patch(ctx context.Context, id string, version int, patch []byte) (Flight, error)
 	Delete(ctx context.Context, id string) (Flight, error)
+	ChangeStatus(ctx context.Context, id string, version int, input ChangeStatusRequest) (Flight, error)
+	StatusHistory(ctx context.Context, id string) ([]entity.FlightStatusChange, error)
 }
 
 // Flight represents the data about an flight.
 type Flight struct {
 	entity.Flight
+	DepartureTimeLocal *time.Time `json:"departure_time_local,omitempty"` // departure time in the departure airport time zone
+	ArrivalTimeLocal   *time.Time `json:"arrival_time_local,omitempty"`   // arrival time in the destination airport time zone
+	Duration           string     `json:"duration"`                       // human readable flight duration, e.g. "3 hours 20 minutes"
+	DurationISO        string     `json:"duration_iso"`                   // ISO 8601 flight duration, e.g. "PT3H20M"
+	DisplayFare        string     `json:"display_fare,omitempty"`         // fare converted into the requested display currency
+	Score              *float64   `json:"score,omitempty"`                // relevance to the full-text query of the search
+	RemainingCapacity  int        `json:"remaining_capacity"`             // number of seats that can still be claimed
 }
 
 // CreateFlightRequest represents an flight creation request.
 type CreateFlightRequest struct {
 	Name          string    `json:"name"`           // flight name
 	Number        string    `json:"number"`         // flight number
-	Departure     string    `json:"departure"`      // departure
+	Departure     string    `json:"departure"`      // departure airport IATA code
 	DepartureTime time.Time `json:"departure_time"` // scheduled date & time
-	Destination   string    `json:"destination"`    // destination
+	Destination   string    `json:"destination"`    // destination airport IATA code
 	ArrivalTime   time.Time `json:"arrival_time"`   // expected arrival date & time
-	Fare          string    `json:"fare"`           // fare
-	Duration      string    `json:"duration"`       // flight duration
+	Fare          string    `json:"fare"`           // fare, e.g. "100EUR" or "99.90 USD"
+	AircraftID    string    `json:"aircraft_id"`    // ID of the aircraft configuration the seats are derived from, optional
+	// number of seats on sale, defaults to the capacity of the aircraft configuration
+	Capacity int `json:"capacity"`
+	// percentage of the capacity that can be claimed on top of it
+	OverbookingPercent int `json:"overbooking_percent"`
 }
 
 // Validate validates the CreateFlightRequest fields.
@@ -42,11 +70,14 @@ func (m CreateFlightRequest) Validate() error {
 	return validation.ValidateStruct(&m,
 		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
 		validation.Field(&m.Number, validation.Required, validation.Length(0, 20)),
-		validation.Field(&m.Departure, validation.Required, validation.Length(0, 100)),
-		validation.Field(&m.Destination, validation.Required, validation.Length(0, 100)),
-		validation.Field(&m.Fare, validation.Required, validation.Length(0, 20)),
+		validation.Field(&m.Departure, validation.Required, validation.Match(airport.CodeRegex).Error("must be an IATA airport code")),
+		validation.Field(&m.Destination, validation.Required, validation.Match(airport.CodeRegex).Error("must be an IATA airport code"),
+			validation.NotIn(m.Departure).Error("must be different from departure")),
+		validation.Field(&m.Fare, validation.Required, validation.Length(0, 20), validation.By(validateFare)),
 		validation.Field(&m.DepartureTime, validation.Required),
-		validation.Field(&m.ArrivalTime, validation.Required),
+		validation.Field(&m.ArrivalTime, validation.Required, arrivalRule(m.DepartureTime)),
+		validation.Field(&m.Capacity, validation.Min(0), validation.Max(maxCapacity)),
+		validation.Field(&m.OverbookingPercent, validation.Min(0), validation.Max(maxOverbookingPercent)),
 	)
 }
 
@@ -54,12 +85,16 @@ func (m CreateFlightRequest) Validate() error {
 type UpdateFlightRequest struct {
 	Name          string    `json:"name"`           // flight name
 	Number        string    `json:"number"`         // flight number
-	Departure     string    `json:"departure"`      // departure
+	Departure     string    `json:"departure"`      // departure airport IATA code
 	DepartureTime time.Time `json:"departure_time"` // scheduled date & time
-	Destination   string    `json:"destination"`    // destination
+	Destination   string    `json:"destination"`    // destination airport IATA code
 	ArrivalTime   time.Time `json:"arrival_time"`   // expected arrival date & time
-	Fare          string    `json:"fare"`           // fare
-	Duration      string    `json:"duration"`       // flight duration
+	Fare          string    `json:"fare"`           // fare, e.g. "100EUR" or "99.90 USD"
+	AircraftID    string    `json:"aircraft_id"`    // ID of the aircraft configuration the seats are derived from, optional
+	// number of seats on sale, defaults to the capacity of the aircraft configuration
+	Capacity int `json:"capacity"`
+	// percentage of the capacity that can be claimed on top of it
+	OverbookingPercent int `json:"overbooking_percent"`
 }
 
 // Validate validates the UpdateFlightRequest fields.
@@ -67,22 +102,207 @@ func (m UpdateFlightRequest) Validate() error {
 	return validation.ValidateStruct(&m,
 		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
 		validation.Field(&m.Number, validation.Required, validation.Length(0, 20)),
-		validation.Field(&m.Departure, validation.Required, validation.Length(0, 100)),
-		validation.Field(&m.Destination, validation.Required, validation.Length(0, 100)),
-		validation.Field(&m.Fare, validation.Required, validation.Length(0, 20)),
+		validation.Field(&m.Departure, validation.Required, validation.Match(airport.CodeRegex).Error("must be an IATA airport code")),
+		validation.Field(&m.Destination, validation.Required, validation.Match(airport.CodeRegex).Error("must be an IATA airport code"),
+			validation.NotIn(m.Departure).Error("must be different from departure")),
+		validation.Field(&m.Fare, validation.Required, validation.Length(0, 20), validation.By(validateFare)),
 		validation.Field(&m.DepartureTime, validation.Required),
-		validation.Field(&m.ArrivalTime, validation.Required),
+		validation.Field(&m.ArrivalTime, validation.Required, arrivalRule(m.DepartureTime)),
+		validation.Field(&m.Capacity, validation.Min(0), validation.Max(maxCapacity)),
+		validation.Field(&m.OverbookingPercent, validation.Min(0), validation.Max(maxOverbookingPercent)),
 	)
 }
 
+// ChangeStatusRequest represents a request to change the operational status of a flight.
+type ChangeStatusRequest struct {
+	Status                 string     `json:"status"`                   // new status, e.g. "delayed"
+	Reason                 string     `json:"reason"`                   // why the status changes, required for delays and cancellations
+	EstimatedDepartureTime *time.Time `json:"estimated_departure_time"` // estimated departure, required for delays
+	EstimatedArrivalTime   *time.Time `json:"estimated_arrival_time"`   // estimated arrival of a delayed flight, defaults to the estimated departure plus the flight duration
+	ActualDepartureTime    *time.Time `json:"actual_departure_time"`    // actual departure, required for departures
+	ActualArrivalTime      *time.Time `json:"actual_arrival_time"`      // actual arrival, required for arrivals
+}
+
+// Validate validates the ChangeStatusRequest fields.
+func (m ChangeStatusRequest) Validate() error {
+	delayed := m.Status == entity.FlightDelayed
+	var estimatedDeparture time.Time
+	if m.EstimatedDepartureTime != nil {
+		estimatedDeparture = *m.EstimatedDepartureTime
+	}
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Status, validation.Required, validation.By(validateStatus)),
+		validation.Field(&m.Reason, validation.Length(0, 256),
+			validation.When(delayed || m.Status == entity.FlightCancelled, validation.Required)),
+		validation.Field(&m.EstimatedDepartureTime, validation.When(delayed, validation.Required),
+			validation.When(!delayed, absent("is only allowed for delays"))),
+		validation.Field(&m.EstimatedArrivalTime, validation.When(delayed, arrivalRule(estimatedDeparture)),
+			validation.When(!delayed, absent("is only allowed for delays"))),
+		validation.Field(&m.ActualDepartureTime, validation.When(m.Status == entity.FlightDeparted, validation.Required),
+			validation.When(m.Status != entity.FlightDeparted, absent("is only allowed for departures"))),
+		validation.Field(&m.ActualArrivalTime, validation.When(m.Status == entity.FlightArrived, validation.Required),
+			validation.When(m.Status != entity.FlightArrived, absent("is only allowed for arrivals"))),
+	)
+}
+
+// absent returns the rule checking that a time is not given, reporting the message otherwise.
+func absent(message string) validation.Rule {
+	return validation.By(func(value interface{}) error {
+		if t, _ := value.(*time.Time); t != nil {
+			return validation.NewError("validation_absent", message)
+		}
+		return nil
+	})
+}
+
+// validateStatus checks that the value is a known flight status.
+func validateStatus(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" || entity.IsFlightStatus(s) {
+		return nil
+	}
+	return validation.NewError("validation_status", "must be a known flight status")
+}
+
+// validateStatuses checks that the value is a comma-separated list of known flight statuses.
+func validateStatuses(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	for _, status := range strings.Split(s, ",") {
+		if !entity.IsFlightStatus(strings.TrimSpace(status)) {
+			return validation.NewError("validation_status", fmt.Sprintf("unknown flight status %q", strings.TrimSpace(status)))
+		}
+	}
+	return nil
+}
+
+const (
+	// maxCapacity is the largest number of seats on sale on a flight.
+	maxCapacity = 1000
+	// maxOverbookingPercent is the largest overbooking allowance of a flight.
+	maxOverbookingPercent = 50
+)
+
+// maxFlightDuration is the longest time a flight may take from departure to arrival.
+const maxFlightDuration = 24 * time.Hour
+
+// arrivalRule returns the rule checking that the arrival is after the departure and within maxFlightDuration of it.
+func arrivalRule(departure time.Time) validation.Rule {
+	return validation.When(!departure.IsZero(),
+		validation.Min(departure).Exclusive().Error("must be later than departure_time"),
+		validation.Max(departure.Add(maxFlightDuration)).Error("must be within 24 hours of departure_time"),
+	)
+}
+
+// validateFare checks that the value is a fare in a supported ISO 4217 currency, e.g. "100EUR".
+func validateFare(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	_, err := entity.ParseMoney(s)
+	return err
+}
+
+// validateCurrency checks that the value is a supported ISO 4217 currency code.
+func validateCurrency(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" || entity.IsCurrency(s) {
+		return nil
+	}
+	return errors.New("must be a supported ISO 4217 currency code")
+}
+
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo          Repository
+	transactional dbcontext.TransactionFunc
+	airports      airport.Service
+	aircraft      aircraft.Service
+	claims        claim.Service
+	rates         entity.ExchangeRates
+	cursorKey     []byte
+	logger        log.Logger
 }
 
 // NewService creates a new flight service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// The flights are updated in the transactions started by transactional, e.g. dbcontext.DB.Transactional.
+// The airports are used to validate the flight route and the aircraft configurations to validate the seat layout.
+// The seats added to the capacity of a flight go to the seat claims waiting for it.
+// The rates are used to convert fares into the display currency requested by a search.
+// The cursor signing key is used to sign the pagination cursors.
+func NewService(repo Repository, transactional dbcontext.TransactionFunc, airports airport.Service, aircraft aircraft.Service,
+	claims claim.Service, rates entity.ExchangeRates, cursorSigningKey string, logger log.Logger) Service {
+	return service{repo, transactional, airports, aircraft, claims, rates, []byte(cursorSigningKey), logger}
+}
+
+// validateReferences checks that the departure and destination are known airports
+// and that the aircraft configuration, if given, exists and has room for the capacity.
+// It returns the capacity of the flight, which defaults to the capacity of the aircraft configuration.
+func (s service) validateReferences(ctx context.Context, departure, destination, aircraftID string, capacity int) (int, error) {
+	errs, err := airport.ValidateCodes(ctx, s.airports, map[string]string{"departure": departure, "destination": destination})
+	if err != nil {
+		return 0, err
+	}
+	if capacity, err = aircraft.ValidateReference(ctx, s.aircraft, aircraftID, capacity, errs); err != nil {
+		return 0, err
+	}
+	return capacity, errs.Filter()
+}
+
+// newFlight wraps the flight record, rendering its times in UTC and in the local time zones of its airports.
+// The locations map caches the airport time zones between calls and may be nil.
+func (s service) newFlight(ctx context.Context, item entity.Flight, locations map[string]*time.Location) (Flight, error) {
+	if locations == nil {
+		locations = map[string]*time.Location{}
+	}
+	item.DepartureTime = item.DepartureTime.UTC()
+	item.ArrivalTime = item.ArrivalTime.UTC()
+	duration := time.Duration(item.DurationMinutes) * time.Minute
+	flight := Flight{
+		Flight:            item,
+		Duration:          durafmt.Parse(duration).String(),
+		DurationISO:       entity.FormatISODuration(duration),
+		RemainingCapacity: item.RemainingCapacity(),
+	}
+
+	departure, err := s.location(ctx, item.Departure, locations)
+	if err != nil {
+		return Flight{}, err
+	}
+	if departure != nil {
+		t := item.DepartureTime.In(departure)
+		flight.DepartureTimeLocal = &t
+	}
+	destination, err := s.location(ctx, item.Destination, locations)
+	if err != nil {
+		return Flight{}, err
+	}
+	if destination != nil {
+		t := item.ArrivalTime.In(destination)
+		flight.ArrivalTimeLocal = &t
+	}
+	return flight, nil
+}
+
+// location returns the time zone of the airport with the given code, caching it in the locations map.
+// Nil is returned if the airport is unknown.
+func (s service) location(ctx context.Context, code string, locations map[string]*time.Location) (*time.Location, error) {
+	if loc, ok := locations[code]; ok {
+		return loc, nil
+	}
+	var loc *time.Location
+	airport, err := s.airports.Get(ctx, code)
+	if err == nil {
+		if loc, err = airport.Location(); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	locations[code] = loc
+	return loc, nil
 }
 
 // Get returns the flight with the specified the flight ID.
@@ -91,7 +311,7 @@ func (s service) Get(ctx context.Context, id string) (Flight, error) {
 	if err != nil {
 		return Flight{}, err
 	}
-	return Flight{flight}, nil
+	return s.newFlight(ctx, flight, nil)
 }
 
 // Create creates a new flight.
@@ -99,57 +319,207 @@ func (s service) Create(ctx context.Context, req CreateFlightRequest) (Flight, e
 	if err := req.Validate(); err != nil {
 		return Flight{}, err
 	}
+	capacity, err := s.validateReferences(ctx, req.Departure, req.Destination, req.AircraftID, req.Capacity)
+	if err != nil {
+		return Flight{}, err
+	}
 	id := entity.GenerateID()
 	now := time.Now()
 
-	duration := durafmt.Parse(req.ArrivalTime.Sub(req.DepartureTime)).String() // calculate flight duration
-	err := s.repo.Create(ctx, entity.Flight{
-		ID:            id,
-		Name:          req.Name,
-		Number:        req.Number,
-		Departure:     req.Departure,
-		DepartureTime: req.DepartureTime,
-		Destination:   req.Destination,
-		ArrivalTime:   req.ArrivalTime,
-		Fare:          req.Fare,
-		Duration:      duration,
-		CreatedAt:     now,
-		UpdatedAt:     now,
-	})
-	if err != nil {
+	fare, _ := entity.ParseMoney(req.Fare)
+	flight := entity.Flight{
+		ID:          id,
+		Name:        req.Name,
+		Number:      req.Number,
+		Departure:   req.Departure,
+		Destination: req.Destination,
+		Version:     1,
+		Status:      entity.FlightScheduled,
+		AircraftID:  optional(req.AircraftID),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+
+		Capacity:           capacity,
+		OverbookingPercent: req.OverbookingPercent,
+	}
+	flight.SetTimes(req.DepartureTime, req.ArrivalTime)
+	flight.SetFare(fare)
+	if err := s.repo.Create(ctx, flight); err != nil {
 		return Flight{}, err
 	}
 	return s.Get(ctx, id)
 }
 
 // Update updates the flight with the specified ID.
-func (s service) Update(ctx context.Context, id string, req UpdateFlightRequest) (Flight, error) {
+// If version is not zero, the flight is updated only if its current version equals the given one.
+func (s service) Update(ctx context.Context, id string, version int, req UpdateFlightRequest) (Flight, error) {
 	if err := req.Validate(); err != nil {
 		return Flight{}, err
 	}
+	capacity, err := s.validateReferences(ctx, req.Departure, req.Destination, req.AircraftID, req.Capacity)
+	if err != nil {
+		return Flight{}, err
+	}
+	req.Capacity = capacity
 
-	flight, err := s.Get(ctx, id)
+	flight, err := s.getVersion(ctx, id, version)
+	if err != nil {
+		return Flight{}, err
+	}
+	return s.update(ctx, flight, req)
+}
+
+// Patch applies the JSON merge patch (RFC 7396) to the flight with the specified ID.
+// Only the fields present in the patch are changed and the merged flight is validated as a whole.
+// If version is not zero, the flight is patched only if its current version equals the given one.
+func (s service) Patch(ctx context.Context, id string, version int, patch []byte) (Flight, error) {
+	flight, err := s.getVersion(ctx, id, version)
+	if err != nil {
+		return Flight{}, err
+	}
+	doc, err := json.Marshal(UpdateFlightRequest{
+		Name:          flight.Name,
+		Number:        flight.Number,
+		Departure:     flight.Departure,
+		DepartureTime: flight.DepartureTime,
+		Destination:   flight.Destination,
+		ArrivalTime:   flight.ArrivalTime,
+		Fare:          flight.Fare,
+		AircraftID:    aircraftID(flight),
+
+		Capacity:           flight.Capacity,
+		OverbookingPercent: flight.OverbookingPercent,
+	})
+	if err != nil {
+		return Flight{}, err
+	}
+	if doc, err = mergepatch.Apply(doc, patch); err != nil {
+		return Flight{}, err
+	}
+	req, err := decodeUpdateRequest(doc)
+	if err != nil {
+		return Flight{}, err
+	}
+	if err := req.Validate(); err != nil {
+		return Flight{}, err
+	}
+	if req.Capacity, err = s.validateReferences(ctx, req.Departure, req.Destination, req.AircraftID, req.Capacity); err != nil {
+		return Flight{}, err
+	}
+	return s.update(ctx, flight, req)
+}
+
+// getVersion returns the flight with the specified ID.
+// ErrVersionConflict is returned if version is not zero and differs from the current flight version.
+func (s service) getVersion(ctx context.Context, id string, version int) (entity.Flight, error) {
+	flight, err := s.repo.Get(ctx, id)
 	if err != nil {
 		return flight, err
 	}
-	duration := durafmt.Parse(req.ArrivalTime.Sub(req.DepartureTime)).String() // calculate flight duration
+	if version != 0 && flight.Version != version {
+		return flight, ErrVersionConflict
+	}
+	return flight, nil
+}
+
+// decodeUpdateRequest decodes the JSON object into an UpdateFlightRequest.
+// Fields holding values of a wrong type are reported as validation errors.
+func decodeUpdateRequest(doc []byte) (UpdateFlightRequest, error) {
+	var req UpdateFlightRequest
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return req, err
+	}
+	targets := map[string]interface{}{
+		"name":           &req.Name,
+		"number":         &req.Number,
+		"departure":      &req.Departure,
+		"departure_time": &req.DepartureTime,
+		"destination":    &req.Destination,
+		"arrival_time":   &req.ArrivalTime,
+		"fare":           &req.Fare,
+		"aircraft_id":    &req.AircraftID,
+
+		"capacity":            &req.Capacity,
+		"overbooking_percent": &req.OverbookingPercent,
+	}
+	errs := validation.Errors{}
+	for name, value := range fields {
+		if target, ok := targets[name]; ok {
+			if err := json.Unmarshal(value, target); err != nil {
+				errs[name] = errors.New("has an invalid value")
+			}
+		}
+	}
+	return req, errs.Filter()
+}
+
+// update applies the validated request to the flight and saves it.
+// The duration is recomputed only when the flight times change.
+// The flight is locked while it is saved, so that the capacity can't drop below its claimed and taken seats,
+// and the seat claims waiting for the flight are promoted if the capacity grows.
+func (s service) update(ctx context.Context, flight entity.Flight, req UpdateFlightRequest) (Flight, error) {
+	fare, _ := entity.ParseMoney(req.Fare)
 
-	flight.Name = req.Name
 	flight.Name = req.Name
 	flight.Number = req.Number
 	flight.Departure = req.Departure
-	flight.DepartureTime = req.DepartureTime
 	flight.Destination = req.Destination
-	flight.ArrivalTime = req.ArrivalTime
-	flight.Fare = req.Fare
-	flight.Duration = duration
+	if !req.DepartureTime.Equal(flight.DepartureTime) || !req.ArrivalTime.Equal(flight.ArrivalTime) {
+		flight.SetTimes(req.DepartureTime, req.ArrivalTime)
+	}
+	flight.SetFare(fare)
+	flight.AircraftID = optional(req.AircraftID)
+	flight.Capacity = req.Capacity
+	flight.OverbookingPercent = req.OverbookingPercent
 
 	flight.UpdatedAt = time.Now()
+	flight.EditedAt = &flight.UpdatedAt
 
-	if err := s.repo.Update(ctx, flight.Flight); err != nil {
-		return flight, err
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		stored, err := s.repo.Lock(ctx, flight.ID)
+		if err != nil {
+			return err
+		}
+		if stored.Version != flight.Version {
+			return ErrVersionConflict
+		}
+		flight.ClaimedSeats = stored.ClaimedSeats
+		flight.TakenSeats = stored.TakenSeats
+		if flight.ClaimLimit() < flight.ClaimedSeats+flight.TakenSeats {
+			return validation.Errors{
+				"capacity": validation.NewError("validation_capacity", "must leave room for the claimed and booked seats"),
+			}
+		}
+		if err := s.repo.Update(ctx, flight); err != nil {
+			return err
+		}
+		if flight.RemainingCapacity() > stored.RemainingCapacity() {
+			return s.claims.Promote(ctx, flight.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return Flight{}, err
 	}
-	return flight, nil
+	// the promoted claims change the claimed seats of the flight
+	return s.Get(ctx, flight.ID)
+}
+
+// optional returns a pointer to the string, or nil if the string is empty.
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// aircraftID returns the ID of the aircraft configuration of the flight, or an empty string if it has none.
+func aircraftID(flight entity.Flight) string {
+	if flight.AircraftID == nil {
+		return ""
+	}
+	return *flight.AircraftID
 }
 
 // Delete deletes the flight with the specified ID.
@@ -164,30 +534,330 @@ func (s service) Delete(ctx context.Context, id string) (Flight, error) {
 	return flight, nil
 }
 
-// Count returns the number of flights.
-func (s service) Count(ctx context.Context) (int, error) {
-	return s.repo.Count(ctx)
+// ChangeStatus changes the operational status of the flight with the specified ID and records the change.
+// The transition must be allowed by the flight status state machine, otherwise a conflict error is returned.
+// If version is not zero, the status is changed only if the current flight version equals the given one.
+func (s service) ChangeStatus(ctx context.Context, id string, version int, req ChangeStatusRequest) (Flight, error) {
+	if err := req.Validate(); err != nil {
+		return Flight{}, err
+	}
+	flight, err := s.getVersion(ctx, id, version)
+	if err != nil {
+		return Flight{}, err
+	}
+	if !entity.CanTransition(flight.Status, req.Status) {
+		return Flight{}, errStatusTransition(flight.Status, req.Status)
+	}
+
+	now := time.Now()
+	change := entity.FlightStatusChange{
+		ID:             entity.GenerateID(),
+		FlightID:       flight.ID,
+		PreviousStatus: flight.Status,
+		Status:         req.Status,
+		Reason:         req.Reason,
+		CreatedAt:      now,
+	}
+	switch req.Status {
+	case entity.FlightDelayed:
+		if !req.EstimatedDepartureTime.After(flight.DepartureTime) {
+			return Flight{}, validation.Errors{
+				"estimated_departure_time": validation.NewError("validation_estimate", "must be later than departure_time"),
+			}
+		}
+		departure := req.EstimatedDepartureTime.UTC()
+		arrival := departure.Add(time.Duration(flight.DurationMinutes) * time.Minute)
+		if req.EstimatedArrivalTime != nil {
+			arrival = req.EstimatedArrivalTime.UTC()
+		}
+		change.EstimatedDepartureTime, change.EstimatedArrivalTime = &departure, &arrival
+	case entity.FlightDeparted:
+		departure := req.ActualDepartureTime.UTC()
+		change.ActualDepartureTime = &departure
+	case entity.FlightArrived:
+		arrival := req.ActualArrivalTime.UTC()
+		if flight.ActualDepartureTime != nil && !arrival.After(*flight.ActualDepartureTime) {
+			return Flight{}, validation.Errors{
+				"actual_arrival_time": validation.NewError("validation_arrival", "must be later than actual_departure_time"),
+			}
+		}
+		change.ActualArrivalTime = &arrival
+	}
+
+	flight.ApplyStatus(change)
+	flight.UpdatedAt = now
+	if err := s.repo.UpdateStatus(ctx, flight, change); err != nil {
+		return Flight{}, err
+	}
+	s.logger.With(ctx).Infof("flight %v changed status from %v to %v", flight.ID, change.PreviousStatus, change.Status)
+	flight.Version++
+	return s.newFlight(ctx, flight, nil)
+}
+
+// StatusHistory returns the status changes of the flight with the specified ID in the order they were made.
+func (s service) StatusHistory(ctx context.Context, id string) ([]entity.FlightStatusChange, error) {
+	if _, err := s.repo.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	changes, err := s.repo.StatusChanges(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if changes == nil {
+		changes = []entity.FlightStatusChange{}
+	}
+	return changes, nil
+}
+
+// Count returns the number of flights matching the search request.
+func (s service) Count(ctx context.Context, req SearchFlightRequest) (int, error) {
+	if err := req.Validate(); err != nil {
+		return 0, err
+	}
+	return s.repo.Count(ctx, req)
 }
 
 // SearchFlightRequest represents an flight update request.
 type SearchFlightRequest struct {
-	Name          string `json:"name"`           // flight name
-	Departure     string `json:"departure"`      // departure
-	DepartureTime string `json:"departure_time"` // scheduled date & time
-	Destination   string `json:"destination"`    // destination
+	Name            string `json:"name"`             // flight name
+	Departure       string `json:"departure"`        // departure
+	DepartureTime   string `json:"departure_time"`   // departure day in the departure airport time zone, e.g. "2020-10-01"
+	DepartureFrom   string `json:"departure_from"`   // earliest departure as a date or an RFC 3339 time
+	DepartureTo     string `json:"departure_to"`     // latest departure as a date or an RFC 3339 time
+	ArrivalFrom     string `json:"arrival_from"`     // earliest arrival as a date or an RFC 3339 time
+	ArrivalTo       string `json:"arrival_to"`       // latest arrival as a date or an RFC 3339 time
+	Destination     string `json:"destination"`      // destination
+	MinFare         string `json:"min_fare"`         // lowest fare in the currency, e.g. "99.90"
+	MaxFare         string `json:"max_fare"`         // highest fare in the currency
+	Currency        string `json:"currency"`         // fare currency
+	DisplayCurrency string `json:"display_currency"` // currency to convert the fares into
+	MinDuration     string `json:"min_duration"`     // shortest flight duration in minutes or ISO 8601, e.g. "PT2H"
+	MaxDuration     string `json:"max_duration"`     // longest flight duration in minutes or ISO 8601
+	Status          string `json:"status"`           // comma-separated operational statuses, e.g. "delayed,cancelled"
+	AvailableSeats  string `json:"available_seats"`  // lowest number of available seats
+	Q               string `json:"q"`                // full-text query matching the flight name, number and airports
+	Sort            string `json:"sort"`             // comma-separated sort keys, "-" prefix for descending, e.g. "departure_time,-fare"
+	Cursor          string `json:"cursor"`           // pagination cursor returned as next_cursor by the previous search
+
+	// After holds the sort key values decoded from the cursor. Only the flights following them are searched.
+	After []string `json:"-"`
+}
+
+var (
+	amountRegex = regexp.MustCompile(`^\d+([.,]\d+)?$`)
+	seatsRegex  = regexp.MustCompile(`^[1-9]\d{0,3}$`)
+)
+
+// Validate validates the SearchFlightRequest fields.
+func (m SearchFlightRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.MinFare, validation.Match(amountRegex), validation.By(m.validateFareBound)),
+		validation.Field(&m.MaxFare, validation.Match(amountRegex), validation.By(m.validateFareBound)),
+		validation.Field(&m.Currency, validation.When(m.MinFare != "" || m.MaxFare != "", validation.Required), validation.By(validateCurrency)),
+		validation.Field(&m.DisplayCurrency, validation.By(validateCurrency)),
+		validation.Field(&m.MinDuration, validation.By(entity.ValidateDuration)),
+		validation.Field(&m.MaxDuration, validation.By(entity.ValidateDuration)),
+		validation.Field(&m.DepartureTime, validation.Date(dateLayout).Error("must be a date in the format YYYY-MM-DD")),
+		validation.Field(&m.DepartureFrom, validation.By(validateTimeBound)),
+		validation.Field(&m.DepartureTo, validation.By(validateTimeBound)),
+		validation.Field(&m.ArrivalFrom, validation.By(validateTimeBound)),
+		validation.Field(&m.ArrivalTo, validation.By(validateTimeBound)),
+		validation.Field(&m.Status, validation.By(validateStatuses)),
+		validation.Field(&m.AvailableSeats, validation.Match(seatsRegex).Error("must be a positive number of seats")),
+		validation.Field(&m.Q, validation.Length(0, 100)),
+		validation.Field(&m.Sort, validation.By(m.validateSort)),
+	)
+}
+
+// sortOrder returns the sort keys of the search, which are by relevance for a full-text search by default.
+func (m SearchFlightRequest) sortOrder() string {
+	if m.Sort == "" && m.Q != "" {
+		return "-" + relevanceSort
+	}
+	return m.Sort
+}
+
+// validateSort checks that the value is a comma-separated list of the known sort keys.
+// The relevance key is only known to a full-text search.
+func (m SearchFlightRequest) validateSort(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, key := range strings.Split(s, ",") {
+		key = strings.TrimPrefix(strings.TrimSpace(key), "-")
+		if _, ok := sortColumns[key]; !ok && (key != relevanceSort || m.Q == "") {
+			return validation.NewError("validation_sort_key", fmt.Sprintf("unknown sort key %q", key))
+		}
+		if seen[key] {
+			return validation.NewError("validation_sort_duplicate", fmt.Sprintf("duplicate sort key %q", key))
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// dateLayout is the layout of the dates accepted by the time filters of a search.
+const dateLayout = "2006-01-02"
+
+// parseTimeBound parses a time filter given either as an RFC 3339 time or as a date.
+// The returned flag reports whether it is a date, which should be taken in the time zone of the airport.
+func parseTimeBound(s string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(dateLayout, s)
+	return t, true, err
+}
+
+// validateTimeBound checks that the value is an RFC 3339 time or a date.
+func validateTimeBound(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	if _, _, err := parseTimeBound(s); err != nil {
+		return validation.NewError("validation_time_bound", "must be a date in the format YYYY-MM-DD or an RFC 3339 time")
+	}
+	return nil
+}
+
+// validateFareBound checks that the fare bound has no more decimal digits than the currency allows.
+func (m SearchFlightRequest) validateFareBound(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" || !entity.IsCurrency(m.Currency) || !amountRegex.MatchString(s) {
+		return nil
+	}
+	_, err := entity.ParseMoney(s + m.Currency)
+	return err
+}
+
+// Cursor returns the pagination cursor pointing after the given flight in the sort order of the search request.
+func (s service) Cursor(req SearchFlightRequest, last Flight) string {
+	result := SearchResult{Flight: last.Flight}
+	if last.Score != nil {
+		result.Score = *last.Score
+	}
+	values := []string{req.sortOrder(), req.Q}
+	for _, key := range sortKeys(req.sortOrder()) {
+		values = append(values, sortValue(result, key.column))
+	}
+	return pagination.EncodeCursor(s.cursorKey, values...)
+}
+
+// decodeCursor returns the sort key values held by the cursor of the search request.
+// An error is returned if the cursor is forged or was issued for another sort order or full-text query.
+func (s service) decodeCursor(req SearchFlightRequest) ([]string, error) {
+	values, err := pagination.DecodeCursor(s.cursorKey, req.Cursor)
+	if err != nil || len(values) != len(sortKeys(req.sortOrder()))+2 || values[0] != req.sortOrder() || values[1] != req.Q {
+		return nil, validation.Errors{
+			"cursor": validation.NewError("validation_cursor", "is invalid or does not match the search"),
+		}
+	}
+	return values[2:], nil
 }
 
 // Query returns the flights with the specified offset and limit.
+// If the search request has a cursor, the flights following the cursor are returned and the offset is ignored.
+// If a display currency is requested, the fares are also converted into that currency.
+// The results of a full-text search carry their relevance score.
 func (s service) Query(ctx context.Context, req SearchFlightRequest, offset, limit int) ([]Flight, error) {
-	log.New().Infof("%+v", req)
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.Cursor != "" {
+		after, err := s.decodeCursor(req)
+		if err != nil {
+			return nil, err
+		}
+		req.After, offset = after, 0
+	}
 
 	items, err := s.repo.Query(ctx, req, offset, limit)
 	if err != nil {
 		return nil, err
 	}
 	result := []Flight{}
+	locations := map[string]*time.Location{}
 	for _, item := range items {
-		result = append(result, Flight{item})
+		flight, err := s.newFlight(ctx, item.Flight, locations)
+		if err != nil {
+			return nil, err
+		}
+		if req.Q != "" {
+			score := item.Score
+			flight.Score = &score
+		}
+		if req.DisplayCurrency != "" {
+			if fare, ok := s.rates.Convert(entity.Money{Amount: item.FareAmount, Currency: item.FareCurrency}, req.DisplayCurrency); ok {
+				flight.DisplayFare = fare.String()
+			}
+		}
+		result = append(result, flight)
 	}
 	return result, nil
 }
+
+// SeatMap represents the seats of a flight by cabin and row together with their availability.
+type SeatMap struct {
+	FlightID   string      `json:"flight_id"`
+	AircraftID *string     `json:"aircraft_id,omitempty"` // ID of the aircraft configuration the seats are derived from
+	Capacity   int         `json:"capacity"`              // number of seats
+	Available  int         `json:"available"`             // number of available seats
+	Cabins     []SeatCabin `json:"cabins"`                // cabins from the front to the back of the aircraft
+}
+
+// SeatCabin represents the rows of a cabin of a seat map.
+type SeatCabin struct {
+	Class string    `json:"class"` // cabin class, e.g. "economy"
+	Rows  []SeatRow `json:"rows"`
+}
+
+// SeatRow represents the seats of a row of a seat map from left to right.
+type SeatRow struct {
+	Row   int           `json:"row"`
+	Seats []SeatMapSeat `json:"seats"`
+}
+
+// SeatMapSeat represents a seat of a seat map.
+type SeatMapSeat struct {
+	Number    string `json:"number"` // seat number, e.g. "12A"
+	Letter    string `json:"letter"`
+	Available bool   `json:"available"`
+}
+
+// Seats returns the seat map of the flight with the specified ID.
+// The seat map of a flight without an aircraft configuration has no seats.
+func (s service) Seats(ctx context.Context, id string) (SeatMap, error) {
+	flight, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return SeatMap{}, err
+	}
+	seats, err := s.repo.Seats(ctx, id)
+	if err != nil {
+		return SeatMap{}, err
+	}
+	return newSeatMap(flight, seats), nil
+}
+
+// newSeatMap groups the seats of the flight, ordered by row and letter, into cabins and rows.
+func newSeatMap(flight entity.Flight, seats []entity.Seat) SeatMap {
+	seatMap := SeatMap{FlightID: flight.ID, AircraftID: flight.AircraftID, Capacity: len(seats), Cabins: []SeatCabin{}}
+	for _, seat := range seats {
+		if n := len(seatMap.Cabins); n == 0 || seatMap.Cabins[n-1].Class != seat.Cabin {
+			seatMap.Cabins = append(seatMap.Cabins, SeatCabin{Class: seat.Cabin})
+		}
+		cabin := &seatMap.Cabins[len(seatMap.Cabins)-1]
+		if n := len(cabin.Rows); n == 0 || cabin.Rows[n-1].Row != seat.Row {
+			cabin.Rows = append(cabin.Rows, SeatRow{Row: seat.Row})
+		}
+		row := &cabin.Rows[len(cabin.Rows)-1]
+		available := seat.Status == entity.SeatAvailable
+		row.Seats = append(row.Seats, SeatMapSeat{Number: seat.Number, Letter: seat.Letter, Available: available})
+		if available {
+			seatMap.Available++
+		}
+	}
+	return seatMap
+}
@@ -4,9 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/nvnoskov/dynamo-backend/internal/aircraft"
+	"github.com/nvnoskov/dynamo-backend/internal/airport"
+	"github.com/nvnoskov/dynamo-backend/internal/claim"
 	"github.com/nvnoskov/dynamo-backend/internal/entity"
 	"github.com/nvnoskov/dynamo-backend/pkg/log"
 	"github.com/stretchr/testify/assert"
@@ -23,13 +30,49 @@ func TestCreateFlightRequest_Validate(t *testing.T) {
 		{"success", CreateFlightRequest{
 			Name:          "test",
 			Number:        "test number",
-			Departure:     "MOSKOW",
-			Destination:   "MINSK",
+			Departure:     "SVO",
+			Destination:   "MSQ",
 			Fare:          "200 EUR",
 			DepartureTime: time.Now(),
 			ArrivalTime:   time.Now().Add(3 * time.Hour),
 		}, false},
 		{"required", CreateFlightRequest{Name: ""}, true},
+		{"arrival before departure", CreateFlightRequest{
+			Name:          "test",
+			Number:        "test number",
+			Departure:     "SVO",
+			Destination:   "MSQ",
+			Fare:          "200 EUR",
+			DepartureTime: time.Now(),
+			ArrivalTime:   time.Now().Add(-3 * time.Hour),
+		}, true},
+		{"arrival too late", CreateFlightRequest{
+			Name:          "test",
+			Number:        "test number",
+			Departure:     "SVO",
+			Destination:   "MSQ",
+			Fare:          "200 EUR",
+			DepartureTime: time.Now(),
+			ArrivalTime:   time.Now().Add(25 * time.Hour),
+		}, true},
+		{"same departure and destination", CreateFlightRequest{
+			Name:          "test",
+			Number:        "test number",
+			Departure:     "SVO",
+			Destination:   "SVO",
+			Fare:          "200 EUR",
+			DepartureTime: time.Now(),
+			ArrivalTime:   time.Now().Add(3 * time.Hour),
+		}, true},
+		{"invalid fare", CreateFlightRequest{
+			Name:          "test",
+			Number:        "test number",
+			Departure:     "SVO",
+			Destination:   "MSQ",
+			Fare:          "200 XYZ",
+			DepartureTime: time.Now(),
+			ArrivalTime:   time.Now().Add(3 * time.Hour),
+		}, true},
 		{"too long", CreateFlightRequest{Name: "1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"}, true},
 	}
 	for _, tt := range tests {
@@ -49,13 +92,22 @@ func TestUpdateFlightRequest_Validate(t *testing.T) {
 		{"success", UpdateFlightRequest{
 			Name:          "test updated",
 			Number:        "test number updated",
-			Departure:     "MOSKOW updated",
-			Destination:   "MINSK updated",
-			Fare:          "200 EUR updated",
+			Departure:     "LED",
+			Destination:   "ARN",
+			Fare:          "250 EUR",
 			DepartureTime: time.Now(),
 			ArrivalTime:   time.Now().Add(3 * time.Hour),
 		}, false},
 		{"required", UpdateFlightRequest{Name: ""}, true},
+		{"arrival equals departure", UpdateFlightRequest{
+			Name:          "test updated",
+			Number:        "test number updated",
+			Departure:     "LED",
+			Destination:   "ARN",
+			Fare:          "250 EUR",
+			DepartureTime: time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC),
+			ArrivalTime:   time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC),
+		}, true},
 		{"too long", UpdateFlightRequest{Name: "1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"}, true},
 	}
 	for _, tt := range tests {
@@ -68,101 +120,159 @@ func TestUpdateFlightRequest_Validate(t *testing.T) {
 
 func Test_service_CRUD(t *testing.T) {
 	logger, _ := log.NewForTest()
-	s := NewService(&mockRepository{}, logger)
+	s := NewService(&mockRepository{}, mockTransactional, airport.MockService{}, aircraft.MockService{}, &claim.MockService{}, nil, "cursor-key", logger)
 
 	ctx := context.Background()
 
 	// initial count
-	count, _ := s.Count(ctx)
+	count, _ := s.Count(ctx, SearchFlightRequest{})
 	assert.Equal(t, 0, count)
 
 	// successful creation
 	flight, err := s.Create(ctx, CreateFlightRequest{
 		Name:          "test",
 		Number:        "test number",
-		Departure:     "MOSKOW",
-		Destination:   "MINSK",
+		Departure:     "SVO",
+		Destination:   "MSQ",
 		Fare:          "200 EUR",
 		DepartureTime: time.Now(),
 		ArrivalTime:   time.Now().Add(3 * time.Hour),
 	})
 	assert.Nil(t, err)
 	assert.NotEmpty(t, flight.ID)
+	assert.Equal(t, 1, flight.Version)
 	id := flight.ID
 	assert.Equal(t, "test", flight.Name)
 	assert.NotEmpty(t, flight.CreatedAt)
 	assert.NotEmpty(t, flight.UpdatedAt)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, SearchFlightRequest{})
 	assert.Equal(t, 1, count)
 
 	// validation error in creation
 	_, err = s.Create(ctx, CreateFlightRequest{Name: ""})
 	assert.NotNil(t, err)
-	count, _ = s.Count(ctx)
+	_, err = s.Create(ctx, CreateFlightRequest{
+		Name:          "test",
+		Number:        "test number",
+		Departure:     "XXX",
+		Destination:   "MSQ",
+		Fare:          "200 EUR",
+		DepartureTime: time.Now(),
+		ArrivalTime:   time.Now().Add(3 * time.Hour),
+	})
+	assert.NotNil(t, err)
+	count, _ = s.Count(ctx, SearchFlightRequest{})
 	assert.Equal(t, 1, count)
 
 	// unexpected error in creation
 	_, err = s.Create(ctx, CreateFlightRequest{
 		Name:          "error",
 		Number:        "test number",
-		Departure:     "MOSKOW",
-		Destination:   "MINSK",
+		Departure:     "SVO",
+		Destination:   "MSQ",
 		Fare:          "200 EUR",
 		DepartureTime: time.Now(),
 		ArrivalTime:   time.Now().Add(3 * time.Hour),
 	})
 	assert.Equal(t, errCRUD, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, SearchFlightRequest{})
 	assert.Equal(t, 1, count)
 
 	_, _ = s.Create(ctx, CreateFlightRequest{
 		Name:          "test2",
 		Number:        "test number 2",
-		Departure:     "MOSKOW 2",
-		Destination:   "MINSK 2",
+		Departure:     "LED",
+		Destination:   "ARN",
 		Fare:          "200 EUR",
 		DepartureTime: time.Now(),
 		ArrivalTime:   time.Now().Add(3 * time.Hour),
 	})
 
 	// update
-	flight, err = s.Update(ctx, id, UpdateFlightRequest{
+	flight, err = s.Update(ctx, id, 0, UpdateFlightRequest{
 		Name:          "test updated",
 		Number:        "test number",
-		Departure:     "MOSKOW",
-		Destination:   "MINSK",
+		Departure:     "SVO",
+		Destination:   "MSQ",
 		Fare:          "200 EUR",
 		DepartureTime: time.Now(),
 		ArrivalTime:   time.Now().Add(3 * time.Hour),
 	})
 	assert.Nil(t, err)
 	assert.Equal(t, "test updated", flight.Name)
-	assert.Equal(t, "MOSKOW", flight.Departure)
-	assert.Equal(t, "MINSK", flight.Destination)
-	assert.Equal(t, "200 EUR", flight.Fare)
+	assert.Equal(t, "SVO", flight.Departure)
+	assert.Equal(t, "MSQ", flight.Destination)
+	assert.Equal(t, "200EUR", flight.Fare)
+	assert.Equal(t, int64(20000), flight.FareAmount)
+	assert.Equal(t, "EUR", flight.FareCurrency)
 	assert.Equal(t, "3 hours", flight.Duration)
+	assert.Equal(t, "PT3H", flight.DurationISO)
+	assert.Equal(t, 180, flight.DurationMinutes)
+	assert.NotNil(t, flight.EditedAt)
 
-	_, err = s.Update(ctx, "none", UpdateFlightRequest{Name: "test updated"})
+	// times are stored in UTC and rendered in the airport time zones
+	departure := time.Date(2020, 10, 1, 23, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+	flight, err = s.Update(ctx, id, 0, UpdateFlightRequest{
+		Name:          "test updated",
+		Number:        "test number",
+		Departure:     "MMX",
+		Destination:   "MZH",
+		Fare:          "200 EUR",
+		DepartureTime: departure,
+		ArrivalTime:   time.Date(2020, 10, 2, 4, 0, 0, 0, time.UTC),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, time.UTC, flight.DepartureTime.Location())
+	assert.Equal(t, "2020-10-01T21:30:00Z", flight.DepartureTime.Format(time.RFC3339))
+	assert.Equal(t, "2020-10-01T23:30:00+02:00", flight.DepartureTimeLocal.Format(time.RFC3339))
+	assert.Equal(t, "2020-10-02T07:00:00+03:00", flight.ArrivalTimeLocal.Format(time.RFC3339))
+	assert.Equal(t, "6 hours 30 minutes", flight.Duration)
+
+	// patch
+	flight, err = s.Patch(ctx, id, 0, []byte(`{"fare": "300 EUR"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "300EUR", flight.Fare)
+	assert.Equal(t, "MMX", flight.Departure)
+	assert.Equal(t, 390, flight.DurationMinutes)
+	flight, err = s.Patch(ctx, id, 0, []byte(`{"departure_time": "2020-10-01T22:00:00Z"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 360, flight.DurationMinutes)
+	_, err = s.Patch(ctx, id, 0, []byte(`{"destination": "MMX"}`))
+	assert.NotNil(t, err)
+	_, err = s.Patch(ctx, "none", 0, []byte(`{"fare": "300 EUR"}`))
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// optimistic locking
+	version := flight.Version
+	flight, err = s.Patch(ctx, id, version, []byte(`{"fare": "350 EUR"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, version+1, flight.Version)
+	_, err = s.Patch(ctx, id, version, []byte(`{"fare": "400 EUR"}`))
+	assert.Equal(t, ErrVersionConflict, err)
+	flight, _ = s.Get(ctx, id)
+	assert.Equal(t, "350EUR", flight.Fare)
+
+	_, err = s.Update(ctx, "none", 0, UpdateFlightRequest{Name: "test updated"})
 	assert.NotNil(t, err)
 
 	// validation error in update
-	_, err = s.Update(ctx, id, UpdateFlightRequest{Name: ""})
+	_, err = s.Update(ctx, id, 0, UpdateFlightRequest{Name: ""})
 	assert.NotNil(t, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, SearchFlightRequest{})
 	assert.Equal(t, 2, count)
 
 	// unexpected error in update
-	_, err = s.Update(ctx, id, UpdateFlightRequest{
+	_, err = s.Update(ctx, id, 0, UpdateFlightRequest{
 		Name:          "error",
 		Number:        "test number",
-		Departure:     "MOSKOW",
-		Destination:   "MINSK",
+		Departure:     "SVO",
+		Destination:   "MSQ",
 		Fare:          "200 EUR",
 		DepartureTime: time.Now(),
 		ArrivalTime:   time.Now().Add(3 * time.Hour),
 	})
 	assert.Equal(t, errCRUD, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, SearchFlightRequest{})
 	assert.Equal(t, 2, count)
 
 	// get
@@ -177,18 +287,270 @@ func Test_service_CRUD(t *testing.T) {
 	flightsAll, _ := s.Query(ctx, SearchFlightRequest{}, 0, 0)
 	assert.Equal(t, 2, len(flightsAll))
 
+	// filtered count
+	count, _ = s.Count(ctx, SearchFlightRequest{Name: "test updated"})
+	assert.Equal(t, 1, count)
+	_, err = s.Count(ctx, SearchFlightRequest{MinFare: "abc"})
+	assert.NotNil(t, err)
+
 	// delete
 	_, err = s.Delete(ctx, "none")
 	assert.NotNil(t, err)
 	flight, err = s.Delete(ctx, id)
 	assert.Nil(t, err)
 	assert.Equal(t, id, flight.ID)
-	count, _ = s.Count(ctx)
+	count, _ = s.Count(ctx, SearchFlightRequest{})
 	assert.Equal(t, 1, count)
 }
 
+func TestChangeStatusRequest_Validate(t *testing.T) {
+	now := time.Now()
+	later := now.Add(3 * time.Hour)
+	tests := []struct {
+		name      string
+		model     ChangeStatusRequest
+		wantError bool
+	}{
+		{"delay", ChangeStatusRequest{Status: "delayed", Reason: "weather", EstimatedDepartureTime: &now}, false},
+		{"delay with arrival", ChangeStatusRequest{Status: "delayed", Reason: "weather", EstimatedDepartureTime: &now, EstimatedArrivalTime: &later}, false},
+		{"delay without estimate", ChangeStatusRequest{Status: "delayed", Reason: "weather"}, true},
+		{"delay without reason", ChangeStatusRequest{Status: "delayed", EstimatedDepartureTime: &now}, true},
+		{"delay arrival before departure", ChangeStatusRequest{Status: "delayed", Reason: "weather", EstimatedDepartureTime: &later, EstimatedArrivalTime: &now}, true},
+		{"boarding", ChangeStatusRequest{Status: "boarding"}, false},
+		{"boarding with estimate", ChangeStatusRequest{Status: "boarding", EstimatedDepartureTime: &now}, true},
+		{"departure", ChangeStatusRequest{Status: "departed", ActualDepartureTime: &now}, false},
+		{"departure without time", ChangeStatusRequest{Status: "departed"}, true},
+		{"arrival", ChangeStatusRequest{Status: "arrived", ActualArrivalTime: &now}, false},
+		{"arrival with departure", ChangeStatusRequest{Status: "arrived", ActualArrivalTime: &now, ActualDepartureTime: &now}, true},
+		{"cancellation", ChangeStatusRequest{Status: "cancelled", Reason: "strike"}, false},
+		{"cancellation without reason", ChangeStatusRequest{Status: "cancelled"}, true},
+		{"unknown status", ChangeStatusRequest{Status: "landed"}, true},
+		{"required", ChangeStatusRequest{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_ChangeStatus(t *testing.T) {
+	logger, _ := log.NewForTest()
+	departure := time.Date(2020, 10, 1, 10, 0, 0, 0, time.UTC)
+	item := entity.Flight{ID: "1", Name: "flight1", Departure: "MSQ", Destination: "ARN", Version: 1, Status: entity.FlightScheduled}
+	item.SetTimes(departure, departure.Add(2*time.Hour))
+	repo := &mockRepository{items: []entity.Flight{item}}
+	s := NewService(repo, mockTransactional, airport.MockService{}, aircraft.MockService{}, &claim.MockService{}, nil, "cursor-key", logger)
+	ctx := context.Background()
+
+	// delay with the arrival estimated from the flight duration
+	estimated := departure.Add(90 * time.Minute)
+	flight, err := s.ChangeStatus(ctx, "1", 0, ChangeStatusRequest{Status: "delayed", Reason: "weather", EstimatedDepartureTime: &estimated})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.FlightDelayed, flight.Status)
+	assert.Equal(t, "weather", flight.StatusReason)
+	assert.Equal(t, departure.Add(210*time.Minute), *flight.EstimatedArrivalTime)
+	assert.Equal(t, 2, flight.Version)
+
+	// the estimate must be later than the scheduled departure
+	early := departure.Add(-time.Hour)
+	_, err = s.ChangeStatus(ctx, "1", 0, ChangeStatusRequest{Status: "delayed", Reason: "weather", EstimatedDepartureTime: &early})
+	assert.NotNil(t, err)
+
+	// transitions not allowed by the state machine conflict
+	actual := departure.Add(100 * time.Minute)
+	_, err = s.ChangeStatus(ctx, "1", 0, ChangeStatusRequest{Status: "departed", ActualDepartureTime: &actual})
+	assert.NotNil(t, err)
+
+	// stale version
+	_, err = s.ChangeStatus(ctx, "1", 1, ChangeStatusRequest{Status: "boarding"})
+	assert.Equal(t, ErrVersionConflict, err)
+
+	flight, err = s.ChangeStatus(ctx, "1", 2, ChangeStatusRequest{Status: "boarding"})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.FlightBoarding, flight.Status)
+	assert.Equal(t, estimated, *flight.EstimatedDepartureTime)
+	flight, err = s.ChangeStatus(ctx, "1", 0, ChangeStatusRequest{Status: "departed", ActualDepartureTime: &actual})
+	assert.Nil(t, err)
+	assert.Equal(t, actual, *flight.ActualDepartureTime)
+
+	// the arrival must be later than the actual departure
+	_, err = s.ChangeStatus(ctx, "1", 0, ChangeStatusRequest{Status: "arrived", ActualArrivalTime: &departure})
+	assert.NotNil(t, err)
+	arrival := actual.Add(2 * time.Hour)
+	flight, err = s.ChangeStatus(ctx, "1", 0, ChangeStatusRequest{Status: "arrived", ActualArrivalTime: &arrival})
+	assert.Nil(t, err)
+	assert.Equal(t, entity.FlightArrived, flight.Status)
+
+	// arrived flights are final
+	_, err = s.ChangeStatus(ctx, "1", 0, ChangeStatusRequest{Status: "cancelled", Reason: "strike"})
+	assert.NotNil(t, err)
+	_, err = s.ChangeStatus(ctx, "none", 0, ChangeStatusRequest{Status: "boarding"})
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// history
+	changes, err := s.StatusHistory(ctx, "1")
+	assert.Nil(t, err)
+	if assert.Equal(t, 4, len(changes)) {
+		assert.Equal(t, entity.FlightScheduled, changes[0].PreviousStatus)
+		assert.Equal(t, entity.FlightDelayed, changes[0].Status)
+		assert.Equal(t, entity.FlightArrived, changes[3].Status)
+	}
+	_, err = s.StatusHistory(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// status filter
+	count, _ := s.Count(ctx, SearchFlightRequest{Status: "delayed,arrived"})
+	assert.Equal(t, 1, count)
+	count, _ = s.Count(ctx, SearchFlightRequest{Status: "cancelled"})
+	assert.Equal(t, 0, count)
+	_, err = s.Count(ctx, SearchFlightRequest{Status: "landed"})
+	assert.NotNil(t, err)
+}
+
+func Test_service_Seats(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, mockTransactional, airport.MockService{}, aircraft.MockService{}, &claim.MockService{}, nil, "cursor-key", logger)
+	ctx := context.Background()
+	req := CreateFlightRequest{
+		Name:          "test",
+		Number:        "test number",
+		Departure:     "SVO",
+		Destination:   "MSQ",
+		Fare:          "200 EUR",
+		DepartureTime: time.Now(),
+		ArrivalTime:   time.Now().Add(3 * time.Hour),
+		AircraftID:    "a320",
+	}
+
+	// unknown aircraft configuration
+	req.AircraftID = "b737"
+	_, err := s.Create(ctx, req)
+	assert.NotNil(t, err)
+
+	// the seats are derived from the aircraft configuration
+	req.AircraftID = "a320"
+	flight, err := s.Create(ctx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, "a320", *flight.AircraftID)
+	seatMap, err := s.Seats(ctx, flight.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, seatMap.Capacity)
+	assert.Equal(t, 8, seatMap.Available)
+	if assert.Equal(t, 1, len(seatMap.Cabins)) {
+		assert.Equal(t, entity.CabinBusiness, seatMap.Cabins[0].Class)
+		if assert.Equal(t, 2, len(seatMap.Cabins[0].Rows)) {
+			assert.Equal(t, 2, seatMap.Cabins[0].Rows[1].Row)
+			assert.Equal(t, "2C", seatMap.Cabins[0].Rows[1].Seats[1].Number)
+		}
+	}
+
+	// available seats filter
+	repo.seats[0].Status = "booked"
+	seatMap, _ = s.Seats(ctx, flight.ID)
+	assert.Equal(t, 7, seatMap.Available)
+	assert.False(t, seatMap.Cabins[0].Rows[0].Seats[0].Available)
+	count, _ := s.Count(ctx, SearchFlightRequest{AvailableSeats: "7"})
+	assert.Equal(t, 1, count)
+	count, _ = s.Count(ctx, SearchFlightRequest{AvailableSeats: "8"})
+	assert.Equal(t, 0, count)
+	_, err = s.Count(ctx, SearchFlightRequest{AvailableSeats: "0"})
+	assert.NotNil(t, err)
+
+	// removing the aircraft configuration removes the seats
+	_, err = s.Patch(ctx, flight.ID, 0, []byte(`{"aircraft_id": null}`))
+	assert.Nil(t, err)
+	seatMap, err = s.Seats(ctx, flight.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, seatMap.Capacity)
+	assert.Empty(t, seatMap.Cabins)
+
+	_, err = s.Seats(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func Test_service_Capacity(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	claims := &claim.MockService{}
+	s := NewService(repo, mockTransactional, airport.MockService{}, aircraft.MockService{}, claims, nil, "cursor-key", logger)
+	ctx := context.Background()
+	req := CreateFlightRequest{
+		Name:          "test",
+		Number:        "test number",
+		Departure:     "SVO",
+		Destination:   "MSQ",
+		Fare:          "200 EUR",
+		DepartureTime: time.Now(),
+		ArrivalTime:   time.Now().Add(3 * time.Hour),
+	}
+
+	// the capacity defaults to the capacity of the aircraft configuration
+	req.AircraftID = "a320"
+	flight, err := s.Create(ctx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, flight.Capacity)
+	assert.Equal(t, 8, flight.RemainingCapacity)
+
+	// the capacity can't exceed the capacity of the aircraft configuration
+	req.Capacity = 9
+	_, err = s.Create(ctx, req)
+	assert.NotNil(t, err)
+
+	// overbooking adds to the remaining capacity
+	req.Capacity, req.OverbookingPercent = 6, 50
+	flight, err = s.Create(ctx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, flight.Capacity)
+	assert.Equal(t, 9, flight.RemainingCapacity)
+	req.OverbookingPercent = 51
+	_, err = s.Create(ctx, req)
+	assert.NotNil(t, err)
+
+	// without an aircraft configuration the capacity is taken as given
+	req.AircraftID, req.Capacity, req.OverbookingPercent = "", 100, 10
+	flight, err = s.Create(ctx, req)
+	assert.Nil(t, err)
+	assert.Equal(t, 110, flight.RemainingCapacity)
+
+	flight, err = s.Patch(ctx, flight.ID, 0, []byte(`{"overbooking_percent": 0}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 100, flight.Capacity)
+	assert.Equal(t, 100, flight.RemainingCapacity)
+	_, err = s.Patch(ctx, flight.ID, 0, []byte(`{"capacity": -1}`))
+	assert.NotNil(t, err)
+	assert.Empty(t, claims.Promoted)
+
+	// the capacity can't drop below the claimed and taken seats
+	stored := &repo.items[len(repo.items)-1]
+	stored.ClaimedSeats, stored.TakenSeats = 60, 30
+	_, err = s.Patch(ctx, flight.ID, 0, []byte(`{"capacity": 80, "overbooking_percent": 10}`))
+	assert.NotNil(t, err)
+	_, ok := err.(validation.Errors)
+	assert.True(t, ok)
+	flight, err = s.Patch(ctx, flight.ID, 0, []byte(`{"capacity": 90}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 60, flight.ClaimedSeats)
+	assert.Equal(t, 0, flight.RemainingCapacity)
+	assert.Empty(t, claims.Promoted)
+
+	// growing the capacity promotes the seat claims waiting for the flight
+	_, err = s.Patch(ctx, flight.ID, 0, []byte(`{"capacity": 95}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{flight.ID}, claims.Promoted)
+}
+
+// mockTransactional runs the function without a transaction.
+func mockTransactional(ctx context.Context, f func(ctx context.Context) error) error {
+	return f(ctx)
+}
+
 type mockRepository struct {
-	items []entity.Flight
+	items   []entity.Flight
+	changes []entity.FlightStatusChange
+	seats   []entity.Seat
 }
 
 func (m mockRepository) Get(ctx context.Context, id string) (entity.Flight, error) {
@@ -200,12 +562,83 @@ func (m mockRepository) Get(ctx context.Context, id string) (entity.Flight, erro
 	return entity.Flight{}, sql.ErrNoRows
 }
 
-func (m mockRepository) Count(ctx context.Context) (int, error) {
-	return len(m.items), nil
+func (m mockRepository) Lock(ctx context.Context, id string) (entity.Flight, error) {
+	return m.Get(ctx, id)
+}
+
+func (m mockRepository) Count(ctx context.Context, req SearchFlightRequest) (int, error) {
+	return len(m.search(req)), nil
 }
 
-func (m mockRepository) Query(ctx context.Context, req SearchFlightRequest, offset, limit int) ([]entity.Flight, error) {
-	return m.items, nil
+func (m mockRepository) Query(ctx context.Context, req SearchFlightRequest, offset, limit int) ([]SearchResult, error) {
+	var results []SearchResult
+	for _, item := range m.search(req) {
+		results = append(results, SearchResult{Flight: item, Score: 1})
+	}
+	return results, nil
+}
+
+// search returns the items matching the exact match filters and the case-insensitive full-text query of the search request.
+func (m mockRepository) search(req SearchFlightRequest) []entity.Flight {
+	var items []entity.Flight
+	for _, item := range m.items {
+		if (req.Name == "" || req.Name == item.Name) &&
+			(req.Departure == "" || req.Departure == item.Departure) &&
+			(req.Destination == "" || req.Destination == item.Destination) &&
+			(req.Status == "" || strings.Contains(","+req.Status+",", ","+item.Status+",")) &&
+			(req.AvailableSeats == "" || m.available(item.ID) >= atoi(req.AvailableSeats)) &&
+			strings.Contains(strings.ToLower(item.Name), strings.ToLower(req.Q)) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// available returns the number of the available seats of the flight.
+func (m mockRepository) available(flightID string) int {
+	count := 0
+	for _, seat := range m.seats {
+		if seat.FlightID == flightID && seat.Status == entity.SeatAvailable {
+			count++
+		}
+	}
+	return count
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// generateSeats replaces the seats of the flight with the seats of the mock aircraft configuration.
+func (m *mockRepository) generateSeats(flight entity.Flight) {
+	var seats []entity.Seat
+	for _, seat := range m.seats {
+		if seat.FlightID != flight.ID {
+			seats = append(seats, seat)
+		}
+	}
+	if flight.AircraftID != nil {
+		for _, cabin := range aircraft.MockAircraft.Cabins {
+			for row := cabin.FirstRow; row <= cabin.LastRow; row++ {
+				for _, letter := range cabin.Letters {
+					seats = append(seats, entity.Seat{FlightID: flight.ID, Number: fmt.Sprintf("%v%c", row, letter),
+						Cabin: cabin.Class, Row: row, Letter: string(letter), Status: entity.SeatAvailable})
+				}
+			}
+		}
+	}
+	m.seats = seats
+}
+
+func (m mockRepository) Seats(ctx context.Context, flightID string) ([]entity.Seat, error) {
+	var seats []entity.Seat
+	for _, seat := range m.seats {
+		if seat.FlightID == flightID {
+			seats = append(seats, seat)
+		}
+	}
+	return seats, nil
 }
 
 func (m *mockRepository) Create(ctx context.Context, flight entity.Flight) error {
@@ -213,6 +646,7 @@ func (m *mockRepository) Create(ctx context.Context, flight entity.Flight) error
 		return errCRUD
 	}
 	m.items = append(m.items, flight)
+	m.generateSeats(flight)
 	return nil
 }
 
@@ -222,7 +656,14 @@ func (m *mockRepository) Update(ctx context.Context, flight entity.Flight) error
 	}
 	for i, item := range m.items {
 		if item.ID == flight.ID {
+			if item.Version != flight.Version {
+				return ErrVersionConflict
+			}
+			flight.Version++
 			m.items[i] = flight
+			if !aircraft.SameID(item.AircraftID, flight.AircraftID) {
+				m.generateSeats(flight)
+			}
 			break
 		}
 	}
@@ -239,3 +680,21 @@ func (m *mockRepository) Delete(ctx context.Context, id string) error {
 	}
 	return nil
 }
+
+func (m *mockRepository) UpdateStatus(ctx context.Context, flight entity.Flight, change entity.FlightStatusChange) error {
+	if err := m.Update(ctx, flight); err != nil {
+		return err
+	}
+	m.changes = append(m.changes, change)
+	return nil
+}
+
+func (m mockRepository) StatusChanges(ctx context.Context, flightID string) ([]entity.FlightStatusChange, error) {
+	var changes []entity.FlightStatusChange
+	for _, change := range m.changes {
+		if change.FlightID == flightID {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,45 @@
+package itinerary
+
+import (
+	"strings"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/nvnoskov/dynamo-backend/pkg/pagination"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	// the following endpoints require a valid JWT
+	r.Use(authHandler)
+	r.Get("/itineraries", res.search)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) search(c *routing.Context) error {
+	input := SearchRequest{
+		From:          strings.ToUpper(c.Query("from")),
+		To:            strings.ToUpper(c.Query("to")),
+		Date:          c.Query("date"),
+		MaxStops:      c.Query("max_stops"),
+		MinConnection: strings.ToUpper(c.Query("min_connection")),
+	}
+
+	itineraries, err := r.service.Search(c.Request.Context(), input)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, len(itineraries))
+	end := pages.Offset() + pages.Limit()
+	if end > len(itineraries) {
+		end = len(itineraries)
+	}
+	pages.Items = itineraries[pages.Offset():end]
+	return c.Write(pages)
+}
@@ -0,0 +1,35 @@
+package itinerary
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nvnoskov/dynamo-backend/internal/airport"
+	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{items: mockFlights()}
+	RegisterHandlers(router.Group(""), NewService(repo, airport.MockService{}, entity.ExchangeRates{"EUR": 1}, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{"search", "GET", "/itineraries?from=MSQ&to=ARN&date=2020-10-01", "", header, http.StatusOK, `*"total_count":2*`},
+		{"search lowercase", "GET", "/itineraries?from=msq&to=arn&date=2020-10-01", "", header, http.StatusOK, `*"total_count":2*`},
+		{"search direct", "GET", "/itineraries?from=MSQ&to=ARN&date=2020-10-01&max_stops=0", "", header, http.StatusOK, `*"total_count":1*`},
+		{"search short connections", "GET", "/itineraries?from=MSQ&to=ARN&date=2020-10-01&min_connection=PT30M", "", header, http.StatusOK, `*"total_count":3*`},
+		{"search paged", "GET", "/itineraries?from=MSQ&to=ARN&date=2020-10-01&per_page=1&page=2", "", header, http.StatusOK, `*"stops":1*`},
+		{"search none", "GET", "/itineraries?from=ARN&to=MSQ&date=2020-10-01", "", header, http.StatusOK, `*"total_count":0*`},
+		{"search unknown airport", "GET", "/itineraries?from=MSQ&to=XXX&date=2020-10-01", "", header, http.StatusBadRequest, `*"field":"to"*`},
+		{"search invalid", "GET", "/itineraries?from=MSQ&to=ARN&date=tomorrow&max_stops=5", "", header, http.StatusBadRequest, `*"field":"date"*`},
+		{"search auth error", "GET", "/itineraries?from=MSQ&to=ARN&date=2020-10-01", "", nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
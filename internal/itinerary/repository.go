@@ -0,0 +1,49 @@
+package itinerary
+
+import (
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/dbcontext"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+// Repository encapsulates the logic to access the flights that itineraries are built from.
+type Repository interface {
+	// Departures returns the flights departing from the given airports at or after from and before to.
+	// Cancelled flights are not returned.
+	Departures(ctx context.Context, airports []string, from, to time.Time) ([]entity.Flight, error)
+}
+
+// repository reads flights from database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new itinerary repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Departures reads the flights departing from the given airports within the time range from the database.
+func (r repository) Departures(ctx context.Context, airports []string, from, to time.Time) ([]entity.Flight, error) {
+	var flights []entity.Flight
+	codes := make([]interface{}, len(airports))
+	for i, code := range airports {
+		codes[i] = code
+	}
+	err := r.db.With(ctx).
+		Select().
+		From("flight").
+		Where(dbx.And(
+			dbx.In("departure", codes...),
+			dbx.NewExp("departure_time>={:from} AND departure_time<{:to}", dbx.Params{"from": from, "to": to}),
+			dbx.Not(dbx.HashExp{"status": entity.FlightCancelled}),
+		)).
+		OrderBy("departure_time", "id").
+		All(&flights)
+	return flights, err
+}
@@ -0,0 +1,42 @@
+package itinerary
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "flight")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	for _, flight := range mockFlights() {
+		flight.CreatedAt, flight.UpdatedAt = time.Now(), time.Now()
+		assert.Nil(t, db.DB().Model(&flight).Insert())
+	}
+
+	from := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	flights, err := repo.Departures(ctx, []string{"MSQ"}, from, from.AddDate(0, 0, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(flights))
+
+	flights, err = repo.Departures(ctx, []string{"LED", "SVO"}, from.Add(8*time.Hour), from.Add(9*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(flights))
+
+	// cancelled flights are skipped
+	_, err = db.DB().Update("flight", dbx.Params{"status": entity.FlightCancelled}, dbx.HashExp{"id": "1"}).Execute()
+	assert.Nil(t, err)
+	flights, err = repo.Departures(ctx, []string{"MSQ"}, from, from.AddDate(0, 0, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(flights))
+}
@@ -0,0 +1,259 @@
+package itinerary
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hako/durafmt"
+	"github.com/nvnoskov/dynamo-backend/internal/airport"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+const (
+	// defaultMaxStops is the number of stops allowed when the search request specifies none.
+	defaultMaxStops = 1
+	// defaultMinConnection is the minimum layover when the search request specifies none.
+	defaultMinConnection = 45 * time.Minute
+	// maxConnection is the longest layover between two legs of an itinerary.
+	maxConnection = 24 * time.Hour
+	// dateLayout is the layout of the travel date of a search.
+	dateLayout = "2006-01-02"
+)
+
+// Service encapsulates usecase logic for itineraries.
+type Service interface {
+	Search(ctx context.Context, input SearchRequest) ([]Itinerary, error)
+}
+
+// Itinerary represents a journey of one or several connecting flights.
+type Itinerary struct {
+	Legs            []entity.Flight `json:"legs"`             // flights in the order they are taken
+	Stops           int             `json:"stops"`            // number of connections
+	DepartureTime   time.Time       `json:"departure_time"`   // departure time of the first leg
+	ArrivalTime     time.Time       `json:"arrival_time"`     // arrival time of the last leg
+	DurationMinutes int             `json:"duration_minutes"` // total travel time including layovers
+	Duration        string          `json:"duration"`         // human readable total travel time
+	DurationISO     string          `json:"duration_iso"`     // ISO 8601 total travel time, e.g. "PT5H30M"
+	Fare            string          `json:"fare,omitempty"`   // total fare in the currency of the first leg, empty if it can't be converted
+
+	fare *entity.Money
+}
+
+// SearchRequest represents an itinerary search request.
+type SearchRequest struct {
+	From          string `json:"from"`           // departure airport IATA code
+	To            string `json:"to"`             // destination airport IATA code
+	Date          string `json:"date"`           // travel date in the departure airport time zone, e.g. "2020-10-01"
+	MaxStops      string `json:"max_stops"`      // maximum number of connections, 0 to 2. Defaults to 1
+	MinConnection string `json:"min_connection"` // minimum layover in minutes or ISO 8601. Defaults to 45 minutes
+}
+
+var maxStopsRegex = regexp.MustCompile(`^[0-2]$`)
+
+// Validate validates the SearchRequest fields.
+func (m SearchRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.From, validation.Required, validation.Match(airport.CodeRegex).Error("must be an IATA airport code")),
+		validation.Field(&m.To, validation.Required, validation.Match(airport.CodeRegex).Error("must be an IATA airport code"),
+			validation.NotIn(m.From).Error("must be different from from")),
+		validation.Field(&m.Date, validation.Required, validation.Date(dateLayout).Error("must be a date in the format YYYY-MM-DD")),
+		validation.Field(&m.MaxStops, validation.Match(maxStopsRegex).Error("must be a number from 0 to 2")),
+		validation.Field(&m.MinConnection, validation.By(entity.ValidateDuration)),
+	)
+}
+
+type service struct {
+	repo     Repository
+	airports airport.Service
+	rates    entity.ExchangeRates
+	logger   log.Logger
+}
+
+// NewService creates a new itinerary service.
+// The airports provide the time zone of the travel date.
+// The rates are used to total the fares of legs in different currencies.
+func NewService(repo Repository, airports airport.Service, rates entity.ExchangeRates, logger log.Logger) Service {
+	return service{repo, airports, rates, logger}
+}
+
+// Search returns the itineraries from one airport to another departing on the given date,
+// ranked by the total duration and then by the total fare.
+func (s service) Search(ctx context.Context, req SearchRequest) ([]Itinerary, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	origin, err := s.origin(ctx, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := origin.Location()
+	if err != nil {
+		return nil, err
+	}
+	date, err := time.ParseInLocation(dateLayout, req.Date, loc)
+	if err != nil {
+		return nil, err
+	}
+	maxStops := defaultMaxStops
+	if req.MaxStops != "" {
+		maxStops, _ = strconv.Atoi(req.MaxStops)
+	}
+	minConnection := defaultMinConnection
+	if req.MinConnection != "" {
+		minConnection, _ = entity.ParseDuration(req.MinConnection)
+	}
+
+	departures, err := s.repo.Departures(ctx, []string{req.From}, date, date.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	var paths [][]entity.Flight
+	for _, departure := range departures {
+		paths = append(paths, []entity.Flight{departure})
+	}
+
+	result := []Itinerary{}
+	for stops := 0; len(paths) > 0; stops++ {
+		var open [][]entity.Flight
+		for _, path := range paths {
+			if path[len(path)-1].Destination == req.To {
+				result = append(result, s.newItinerary(path))
+			} else if stops < maxStops {
+				open = append(open, path)
+			}
+		}
+		if len(open) == 0 {
+			break
+		}
+		if paths, err = s.connect(ctx, open, minConnection); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.DurationMinutes != b.DurationMinutes {
+			return a.DurationMinutes < b.DurationMinutes
+		}
+		if (a.fare == nil) != (b.fare == nil) {
+			return a.fare != nil
+		}
+		if a.fare != nil {
+			if fare, ok := s.rates.Convert(*b.fare, a.fare.Currency); ok && fare.Amount != a.fare.Amount {
+				return a.fare.Amount < fare.Amount
+			}
+		}
+		return a.DepartureTime.Before(b.DepartureTime)
+	})
+	return result, nil
+}
+
+// origin returns the departure airport of the search, checking that both airports of the search are known.
+func (s service) origin(ctx context.Context, from, to string) (airport.Airport, error) {
+	errs := validation.Errors{}
+	var origin airport.Airport
+	for field, code := range map[string]string{"from": from, "to": to} {
+		a, err := s.airports.Get(ctx, code)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return origin, err
+			}
+			errs[field] = validation.NewError("validation_airport_unknown", "must be a known airport")
+		}
+		if field == "from" {
+			origin = a
+		}
+	}
+	if len(errs) > 0 {
+		return origin, errs
+	}
+	return origin, nil
+}
+
+// connect extends the paths with the flights departing from their last destination after the minimum layover
+// and within the maximum one. Airports already visited by a path are not flown to again.
+func (s service) connect(ctx context.Context, paths [][]entity.Flight, minConnection time.Duration) ([][]entity.Flight, error) {
+	var airports []string
+	seen := map[string]bool{}
+	var earliest, latest time.Time
+	for i, path := range paths {
+		last := path[len(path)-1]
+		if !seen[last.Destination] {
+			seen[last.Destination] = true
+			airports = append(airports, last.Destination)
+		}
+		if i == 0 || last.ArrivalTime.Before(earliest) {
+			earliest = last.ArrivalTime
+		}
+		if i == 0 || last.ArrivalTime.After(latest) {
+			latest = last.ArrivalTime
+		}
+	}
+
+	flights, err := s.repo.Departures(ctx, airports, earliest.Add(minConnection), latest.Add(maxConnection))
+	if err != nil {
+		return nil, err
+	}
+	var result [][]entity.Flight
+	for _, path := range paths {
+		last := path[len(path)-1]
+		for _, flight := range flights {
+			if flight.Departure != last.Destination || visits(path, flight.Destination) ||
+				flight.DepartureTime.Before(last.ArrivalTime.Add(minConnection)) ||
+				flight.DepartureTime.After(last.ArrivalTime.Add(maxConnection)) {
+				continue
+			}
+			next := make([]entity.Flight, len(path), len(path)+1)
+			copy(next, path)
+			result = append(result, append(next, flight))
+		}
+	}
+	return result, nil
+}
+
+// visits reports whether the path departs from or arrives at the given airport.
+func visits(path []entity.Flight, code string) bool {
+	if path[0].Departure == code {
+		return true
+	}
+	for _, flight := range path {
+		if flight.Destination == code {
+			return true
+		}
+	}
+	return false
+}
+
+// newItinerary creates the itinerary taking the given flights.
+// The fares are totalled in the currency of the first leg.
+func (s service) newItinerary(legs []entity.Flight) Itinerary {
+	first, last := legs[0], legs[len(legs)-1]
+	duration := last.ArrivalTime.Sub(first.DepartureTime).Round(time.Minute)
+	itinerary := Itinerary{
+		Legs:            legs,
+		Stops:           len(legs) - 1,
+		DepartureTime:   first.DepartureTime.UTC(),
+		ArrivalTime:     last.ArrivalTime.UTC(),
+		DurationMinutes: int(duration / time.Minute),
+		Duration:        durafmt.Parse(duration).String(),
+		DurationISO:     entity.FormatISODuration(duration),
+	}
+	total := entity.Money{Currency: first.FareCurrency}
+	for _, leg := range legs {
+		fare, ok := s.rates.Convert(entity.Money{Amount: leg.FareAmount, Currency: leg.FareCurrency}, total.Currency)
+		if !ok {
+			return itinerary
+		}
+		total.Amount += fare.Amount
+	}
+	itinerary.fare = &total
+	itinerary.Fare = total.String()
+	return itinerary
+}
@@ -0,0 +1,137 @@
+package itinerary
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nvnoskov/dynamo-backend/internal/airport"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     SearchRequest
+		wantError bool
+	}{
+		{"success", SearchRequest{From: "MSQ", To: "ARN", Date: "2020-10-01"}, false},
+		{"all options", SearchRequest{From: "MSQ", To: "ARN", Date: "2020-10-01", MaxStops: "2", MinConnection: "PT1H"}, false},
+		{"required", SearchRequest{}, true},
+		{"same airports", SearchRequest{From: "MSQ", To: "MSQ", Date: "2020-10-01"}, true},
+		{"invalid date", SearchRequest{From: "MSQ", To: "ARN", Date: "01.10.2020"}, true},
+		{"too many stops", SearchRequest{From: "MSQ", To: "ARN", Date: "2020-10-01", MaxStops: "3"}, true},
+		{"invalid connection", SearchRequest{From: "MSQ", To: "ARN", Date: "2020-10-01", MinConnection: "1h"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_Search(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewService(&mockRepository{items: mockFlights()}, airport.MockService{}, entity.ExchangeRates{"EUR": 1, "USD": 1.2}, logger)
+	ctx := context.Background()
+
+	// the direct flight first, then the connection via LED as the one via SVO is too tight
+	itineraries, err := s.Search(ctx, SearchRequest{From: "MSQ", To: "ARN", Date: "2020-10-01"})
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(itineraries)) {
+		assert.Equal(t, 0, itineraries[0].Stops)
+		assert.Equal(t, "100EUR", itineraries[0].Fare)
+		assert.Equal(t, 1, itineraries[1].Stops)
+		assert.Equal(t, "LED", itineraries[1].Legs[0].Destination)
+		assert.Equal(t, 360, itineraries[1].DurationMinutes)
+		assert.Equal(t, "PT6H", itineraries[1].DurationISO)
+		assert.Equal(t, "90EUR", itineraries[1].Fare)
+	}
+
+	// shorter layovers allow the connection via SVO
+	itineraries, err = s.Search(ctx, SearchRequest{From: "MSQ", To: "ARN", Date: "2020-10-01", MinConnection: "30"})
+	assert.Nil(t, err)
+	if assert.Equal(t, 3, len(itineraries)) {
+		assert.Equal(t, "SVO", itineraries[1].Legs[0].Destination)
+		assert.Equal(t, 270, itineraries[1].DurationMinutes)
+	}
+
+	// direct flights only
+	itineraries, err = s.Search(ctx, SearchRequest{From: "MSQ", To: "ARN", Date: "2020-10-01", MaxStops: "0"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(itineraries))
+
+	// the travel date is taken in the departure airport time zone
+	itineraries, err = s.Search(ctx, SearchRequest{From: "MSQ", To: "ARN", Date: "2020-10-02"})
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(itineraries)) {
+		assert.Equal(t, "7", itineraries[0].Legs[0].ID)
+	}
+
+	// unknown airport
+	_, err = s.Search(ctx, SearchRequest{From: "MSQ", To: "XXX", Date: "2020-10-01"})
+	assert.NotNil(t, err)
+
+	// invalid request
+	_, err = s.Search(ctx, SearchRequest{From: "MSQ"})
+	assert.NotNil(t, err)
+}
+
+func Test_service_Search_ranksByFare(t *testing.T) {
+	logger, _ := log.NewForTest()
+	flights := []entity.Flight{
+		mockFlight("1", "MSQ", "ARN", "2020-10-01T06:00:00Z", 120, 15000, "USD"),
+		mockFlight("2", "MSQ", "ARN", "2020-10-01T08:00:00Z", 120, 10000, "EUR"),
+		mockFlight("3", "MSQ", "ARN", "2020-10-01T10:00:00Z", 120, 11000, "USD"),
+	}
+	s := NewService(&mockRepository{items: flights}, airport.MockService{}, entity.ExchangeRates{"EUR": 1, "USD": 1.2}, logger)
+
+	itineraries, err := s.Search(context.Background(), SearchRequest{From: "MSQ", To: "ARN", Date: "2020-10-01"})
+	assert.Nil(t, err)
+	if assert.Equal(t, 3, len(itineraries)) {
+		assert.Equal(t, "110USD", itineraries[0].Fare)
+		assert.Equal(t, "100EUR", itineraries[1].Fare)
+		assert.Equal(t, "150USD", itineraries[2].Fare)
+	}
+}
+
+func mockFlight(id, departure, destination, departureTime string, minutes int, fare int64, currency string) entity.Flight {
+	t, _ := time.Parse(time.RFC3339, departureTime)
+	flight := entity.Flight{ID: id, Name: "flight" + id, Number: id, Departure: departure, Destination: destination,
+		Status: entity.FlightScheduled}
+	flight.SetTimes(t, t.Add(time.Duration(minutes)*time.Minute))
+	flight.SetFare(entity.Money{Amount: fare, Currency: currency})
+	return flight
+}
+
+func mockFlights() []entity.Flight {
+	return []entity.Flight{
+		mockFlight("1", "MSQ", "ARN", "2020-10-01T08:00:00Z", 120, 10000, "EUR"),
+		mockFlight("2", "MSQ", "SVO", "2020-10-01T06:00:00Z", 90, 5000, "EUR"),
+		mockFlight("3", "SVO", "ARN", "2020-10-01T08:00:00Z", 150, 4000, "EUR"),
+		mockFlight("4", "MSQ", "LED", "2020-10-01T05:00:00Z", 90, 3000, "EUR"),
+		mockFlight("5", "LED", "ARN", "2020-10-01T09:00:00Z", 120, 6000, "EUR"),
+		mockFlight("6", "LED", "MSQ", "2020-10-01T08:00:00Z", 90, 3000, "EUR"),
+		mockFlight("7", "MSQ", "ARN", "2020-10-01T22:00:00Z", 120, 10000, "EUR"),
+	}
+}
+
+type mockRepository struct {
+	items []entity.Flight
+}
+
+func (m mockRepository) Departures(ctx context.Context, airports []string, from, to time.Time) ([]entity.Flight, error) {
+	var flights []entity.Flight
+	for _, item := range m.items {
+		for _, code := range airports {
+			if item.Departure == code && !item.DepartureTime.Before(from) && item.DepartureTime.Before(to) &&
+				item.Status != entity.FlightCancelled {
+				flights = append(flights, item)
+			}
+		}
+	}
+	return flights, nil
+}
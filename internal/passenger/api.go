@@ -0,0 +1,84 @@
+package passenger
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/errors"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/nvnoskov/dynamo-backend/pkg/pagination"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	// the following endpoints require a valid JWT
+	r.Use(authHandler)
+	r.Get("/flights/<id>/passengers", res.query)
+
+	// the following endpoints require the admin or operator role as well
+	manage := auth.RequireRole(entity.RoleAdmin, entity.RoleOperator)
+	r.Post("/flights/<id>/passengers", manage, res.create)
+	r.Delete("/flights/<id>/passengers/<passenger>", manage, res.delete)
+	r.Get("/flights/<id>/manifest", manage, res.manifest)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	count, err := r.service.Count(ctx, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	passengers, err := r.service.Query(ctx, c.Param("id"), pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = passengers
+	return c.Write(pages)
+}
+
+func (r resource) create(c *routing.Context) error {
+	var input CreatePassengerRequest
+	if err := c.Read(&input); err != nil {
+		// the request may carry a document number, so the error is not logged with its content
+		r.logger.With(c.Request.Context()).Info("invalid passenger request")
+		return errors.BadRequest("")
+	}
+	passenger, err := r.service.Create(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteWithStatus(passenger, http.StatusCreated)
+}
+
+func (r resource) delete(c *routing.Context) error {
+	passenger, err := r.service.Delete(c.Request.Context(), c.Param("id"), c.Param("passenger"))
+	if err != nil {
+		return err
+	}
+
+	return c.Write(passenger)
+}
+
+func (r resource) manifest(c *routing.Context) error {
+	var buf bytes.Buffer
+	if err := r.service.Manifest(c.Request.Context(), c.Param("id"), &buf); err != nil {
+		return err
+	}
+	c.Response.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	c.Response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="manifest-%v.csv"`, c.Param("id")))
+	_, err := c.Response.Write(buf.Bytes())
+	return err
+}
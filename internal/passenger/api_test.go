@@ -0,0 +1,58 @@
+package passenger
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{items: []entity.Passenger{
+		{
+			ID:             "123",
+			FlightID:       "f1",
+			FirstName:      "Anna",
+			LastName:       "Berg",
+			DateOfBirth:    time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC),
+			DocumentType:   entity.DocumentPassport,
+			DocumentNumber: "AB1234567",
+			Nationality:    "SE",
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, logger)
+	header := auth.MockRoleAuthHeader(entity.RoleAdmin)
+	customer := auth.MockRoleAuthHeader(entity.RoleCustomer)
+
+	body := `{"first_name":"Jan","last_name":"Nowak","date_of_birth":"1985-01-02","document_type":"id_card","document_number":"ZX98765","nationality":"PL"}`
+	tests := []test.APITestCase{
+		{"get all", "GET", "/flights/f1/passengers", "", header, http.StatusOK, `*"document_number":"*****4567"*`},
+		{"get unknown flight", "GET", "/flights/none/passengers", "", header, http.StatusNotFound, ""},
+		{"get auth error", "GET", "/flights/f1/passengers", "", nil, http.StatusUnauthorized, ""},
+		{"create ok", "POST", "/flights/f1/passengers", body, header, http.StatusCreated, `*"document_number":"***8765"*`},
+		{"create ok count", "GET", "/flights/f1/passengers", "", header, http.StatusOK, `*"total_count":2*`},
+		{"create customer", "POST", "/flights/f1/passengers", body, customer, http.StatusForbidden, ""},
+		{"create duplicate", "POST", "/flights/f1/passengers", body, header, http.StatusConflict, ""},
+		{"create unknown flight", "POST", "/flights/none/passengers", body, header, http.StatusNotFound, ""},
+		{"create input error", "POST", "/flights/f1/passengers", `"first_name":"Jan"}`, header, http.StatusBadRequest, ""},
+		{"create validation error", "POST", "/flights/f1/passengers", `{"first_name":"Jan"}`, header, http.StatusBadRequest, `*"field":"date_of_birth"*`},
+		{"manifest", "GET", "/flights/f1/manifest", "", header, http.StatusOK, `*F1,MSQ,ARN,2020-10-01T09:30:00Z,Berg,Anna,1990-05-17,SE,passport,AB1234567*`},
+		{"manifest customer", "GET", "/flights/f1/manifest", "", customer, http.StatusForbidden, ""},
+		{"manifest unknown flight", "GET", "/flights/none/manifest", "", header, http.StatusNotFound, ""},
+		{"delete other flight", "DELETE", "/flights/f2/passengers/123", "", header, http.StatusNotFound, ""},
+		{"delete customer", "DELETE", "/flights/f1/passengers/123", "", customer, http.StatusForbidden, ""},
+		{"delete ok", "DELETE", "/flights/f1/passengers/123", "", header, http.StatusOK, `*"last_name":"Berg"*`},
+		{"delete verify", "DELETE", "/flights/f1/passengers/123", "", header, http.StatusNotFound, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
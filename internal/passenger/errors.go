@@ -0,0 +1,8 @@
+package passenger
+
+import (
+	"github.com/nvnoskov/dynamo-backend/internal/errors"
+)
+
+// ErrDuplicate is returned when a passenger with the same travel document is on the flight already.
+var ErrDuplicate = errors.Conflict("a passenger with the same document is on the flight already")
@@ -0,0 +1,98 @@
+package passenger
+
+import (
+	"context"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/dbcontext"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+// Repository encapsulates the logic to access the passengers of flights from the data source.
+type Repository interface {
+	// Flight returns the flight with the specified flight ID.
+	Flight(ctx context.Context, id string) (entity.Flight, error)
+	// Get returns the passenger with the specified passenger ID.
+	Get(ctx context.Context, id string) (entity.Passenger, error)
+	// GetByDocument returns the passenger of the flight with the given travel document.
+	GetByDocument(ctx context.Context, flightID, documentType, documentNumber string) (entity.Passenger, error)
+	// Count returns the number of passengers of the flight.
+	Count(ctx context.Context, flightID string) (int, error)
+	// Query returns the passengers of the flight with the given offset and limit ordered by name.
+	// A negative limit returns all of them.
+	Query(ctx context.Context, flightID string, offset, limit int) ([]entity.Passenger, error)
+	// Create saves a new passenger in the storage.
+	Create(ctx context.Context, passenger entity.Passenger) error
+	// Delete removes the passenger with given ID from the storage.
+	Delete(ctx context.Context, id string) error
+}
+
+// repository persists passengers in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new passenger repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Flight reads the flight with the specified ID from the database.
+func (r repository) Flight(ctx context.Context, id string) (entity.Flight, error) {
+	var flight entity.Flight
+	err := r.db.With(ctx).Select().Model(id, &flight)
+	return flight, err
+}
+
+// Get reads the passenger with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Passenger, error) {
+	var passenger entity.Passenger
+	err := r.db.With(ctx).Select().Model(id, &passenger)
+	return passenger, err
+}
+
+// GetByDocument reads the passenger of the flight with the given travel document from the database.
+func (r repository) GetByDocument(ctx context.Context, flightID, documentType, documentNumber string) (entity.Passenger, error) {
+	var passenger entity.Passenger
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"flight_id": flightID, "document_type": documentType, "document_number": documentNumber}).
+		One(&passenger)
+	return passenger, err
+}
+
+// Count returns the number of the passenger records of the flight in the database.
+func (r repository) Count(ctx context.Context, flightID string) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("passenger").Where(dbx.HashExp{"flight_id": flightID}).Row(&count)
+	return count, err
+}
+
+// Query retrieves the passenger records of the flight with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, flightID string, offset, limit int) ([]entity.Passenger, error) {
+	var passengers []entity.Passenger
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"flight_id": flightID}).
+		OrderBy("last_name", "first_name", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&passengers)
+	return passengers, err
+}
+
+// Create saves a new passenger record in the database.
+func (r repository) Create(ctx context.Context, passenger entity.Passenger) error {
+	return r.db.With(ctx).Model(&passenger).Insert()
+}
+
+// Delete deletes the passenger with the specified ID from the database.
+func (r repository) Delete(ctx context.Context, id string) error {
+	passenger, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.db.With(ctx).Model(&passenger).Delete()
+}
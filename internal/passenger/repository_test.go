@@ -0,0 +1,86 @@
+package passenger
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "passenger", "flight")
+	repo := NewRepository(db, logger)
+
+	ctx := context.Background()
+	now := time.Now()
+
+	// flight
+	flight := entity.Flight{ID: "f1", Name: "flight1", Number: "F1", Departure: "MSQ", Destination: "ARN",
+		Version: 1, Status: entity.FlightScheduled, CreatedAt: now, UpdatedAt: now}
+	flight.SetTimes(now.Add(48*time.Hour), now.Add(50*time.Hour))
+	flight.SetFare(entity.Money{Amount: 10000, Currency: "EUR"})
+	assert.Nil(t, db.DB().Model(&flight).Insert())
+	flight, err := repo.Flight(ctx, "f1")
+	assert.Nil(t, err)
+	assert.Equal(t, "F1", flight.Number)
+	_, err = repo.Flight(ctx, "f0")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// create
+	for i, name := range []string{"Berg", "Andersson"} {
+		assert.Nil(t, repo.Create(ctx, entity.Passenger{
+			ID:             name,
+			FlightID:       "f1",
+			FirstName:      "Anna",
+			LastName:       name,
+			DateOfBirth:    time.Date(1990, 5, 17+i, 0, 0, 0, 0, time.UTC),
+			DocumentType:   entity.DocumentPassport,
+			DocumentNumber: "AB123456" + string(rune('0'+i)),
+			Nationality:    "SE",
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}))
+	}
+	count, err := repo.Count(ctx, "f1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	// get
+	passenger, err := repo.Get(ctx, "Berg")
+	assert.Nil(t, err)
+	assert.Equal(t, "AB1234560", passenger.DocumentNumber)
+	assert.Equal(t, "1990-05-17", passenger.DateOfBirth.Format(dateLayout))
+	_, err = repo.Get(ctx, "Nowak")
+	assert.Equal(t, sql.ErrNoRows, err)
+	passenger, err = repo.GetByDocument(ctx, "f1", entity.DocumentPassport, "AB1234561")
+	assert.Nil(t, err)
+	assert.Equal(t, "Andersson", passenger.ID)
+	_, err = repo.GetByDocument(ctx, "f1", entity.DocumentIDCard, "AB1234561")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// query is ordered by name
+	passengers, err := repo.Query(ctx, "f1", 0, -1)
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(passengers)) {
+		assert.Equal(t, "Andersson", passengers[0].LastName)
+	}
+	passengers, _ = repo.Query(ctx, "f1", 1, 1)
+	if assert.Equal(t, 1, len(passengers)) {
+		assert.Equal(t, "Berg", passengers[0].LastName)
+	}
+
+	// delete
+	assert.Nil(t, repo.Delete(ctx, "Berg"))
+	_, err = repo.Get(ctx, "Berg")
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Equal(t, sql.ErrNoRows, repo.Delete(ctx, "Berg"))
+	count, _ = repo.Count(ctx, "f1")
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,202 @@
+package passenger
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+// dateLayout is the layout of the date of birth.
+const dateLayout = "2006-01-02"
+
+// manifestHeader is the header row of the CSV manifest of a flight.
+var manifestHeader = []string{
+	"flight_number", "departure", "destination", "departure_time",
+	"last_name", "first_name", "date_of_birth", "nationality", "document_type", "document_number",
+}
+
+// Service encapsulates usecase logic for the passengers of flights.
+type Service interface {
+	Query(ctx context.Context, flightID string, offset, limit int) ([]Passenger, error)
+	Count(ctx context.Context, flightID string) (int, error)
+	Create(ctx context.Context, flightID string, input CreatePassengerRequest) (Passenger, error)
+	Delete(ctx context.Context, flightID, id string) (Passenger, error)
+	Manifest(ctx context.Context, flightID string, w io.Writer) error
+}
+
+// Passenger represents the data about a passenger.
+type Passenger struct {
+	entity.Passenger
+	DateOfBirth    string `json:"date_of_birth"`   // date of birth, e.g. "1990-05-17"
+	DocumentNumber string `json:"document_number"` // travel document number with all but the last four characters masked
+}
+
+// CreatePassengerRequest represents a passenger creation request.
+type CreatePassengerRequest struct {
+	FirstName      string `json:"first_name"`
+	LastName       string `json:"last_name"`
+	DateOfBirth    string `json:"date_of_birth"`   // date of birth, e.g. "1990-05-17"
+	DocumentType   string `json:"document_type"`   // travel document type: "passport" or "id_card"
+	DocumentNumber string `json:"document_number"` // travel document number
+	Nationality    string `json:"nationality"`     // ISO 3166-1 alpha-2 country code, e.g. "SE"
+}
+
+var (
+	nameRegex           = regexp.MustCompile(`^\p{L}[\p{L} '\-]*$`)
+	documentNumberRegex = regexp.MustCompile(`^[A-Z0-9]{5,20}$`)
+	countryRegex        = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// Validate validates the CreatePassengerRequest fields.
+func (m CreatePassengerRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.FirstName, validation.Required, validation.Length(0, 64),
+			validation.Match(nameRegex).Error("must contain letters, spaces, hyphens and apostrophes only")),
+		validation.Field(&m.LastName, validation.Required, validation.Length(0, 64),
+			validation.Match(nameRegex).Error("must contain letters, spaces, hyphens and apostrophes only")),
+		validation.Field(&m.DateOfBirth, validation.Required,
+			validation.Date(dateLayout).Max(time.Now()).
+				Error("must be a date in the format YYYY-MM-DD").
+				RangeError("must not be in the future")),
+		validation.Field(&m.DocumentType, validation.Required, validation.In(entity.DocumentPassport, entity.DocumentIDCard)),
+		validation.Field(&m.DocumentNumber, validation.Required,
+			validation.Match(documentNumberRegex).Error("must be 5 to 20 letters and digits")),
+		validation.Field(&m.Nationality, validation.Required,
+			validation.Match(countryRegex).Error("must be an ISO 3166-1 alpha-2 country code")),
+	)
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// NewService creates a new passenger service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// newPassenger returns the passenger data with the document number masked.
+func newPassenger(passenger entity.Passenger) Passenger {
+	return Passenger{
+		Passenger:      passenger,
+		DateOfBirth:    passenger.DateOfBirth.Format(dateLayout),
+		DocumentNumber: entity.MaskDocumentNumber(passenger.DocumentNumber),
+	}
+}
+
+// Count returns the number of passengers of the flight with the specified ID.
+func (s service) Count(ctx context.Context, flightID string) (int, error) {
+	if _, err := s.repo.Flight(ctx, flightID); err != nil {
+		return 0, err
+	}
+	return s.repo.Count(ctx, flightID)
+}
+
+// Query returns the passengers of the flight with the specified ID with the given offset and limit.
+func (s service) Query(ctx context.Context, flightID string, offset, limit int) ([]Passenger, error) {
+	if _, err := s.repo.Flight(ctx, flightID); err != nil {
+		return nil, err
+	}
+	items, err := s.repo.Query(ctx, flightID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Passenger{}
+	for _, item := range items {
+		result = append(result, newPassenger(item))
+	}
+	return result, nil
+}
+
+// Create adds a passenger to the flight with the specified ID.
+// A passenger can't be added twice with the same travel document.
+func (s service) Create(ctx context.Context, flightID string, req CreatePassengerRequest) (Passenger, error) {
+	req.DocumentNumber = strings.ToUpper(strings.TrimSpace(req.DocumentNumber))
+	req.Nationality = strings.ToUpper(req.Nationality)
+	if err := req.Validate(); err != nil {
+		return Passenger{}, err
+	}
+	if _, err := s.repo.Flight(ctx, flightID); err != nil {
+		return Passenger{}, err
+	}
+	if _, err := s.repo.GetByDocument(ctx, flightID, req.DocumentType, req.DocumentNumber); err == nil {
+		return Passenger{}, ErrDuplicate
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return Passenger{}, err
+	}
+
+	now := time.Now()
+	dateOfBirth, _ := time.Parse(dateLayout, req.DateOfBirth)
+	passenger := entity.Passenger{
+		ID:             entity.GenerateID(),
+		FlightID:       flightID,
+		FirstName:      strings.TrimSpace(req.FirstName),
+		LastName:       strings.TrimSpace(req.LastName),
+		DateOfBirth:    dateOfBirth,
+		DocumentType:   req.DocumentType,
+		DocumentNumber: req.DocumentNumber,
+		Nationality:    req.Nationality,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := s.repo.Create(ctx, passenger); err != nil {
+		return Passenger{}, err
+	}
+	s.logger.With(ctx).Infof("added passenger %v to flight %v", passenger, flightID)
+	return newPassenger(passenger), nil
+}
+
+// Delete removes the passenger with the specified ID from the flight with the specified ID.
+func (s service) Delete(ctx context.Context, flightID, id string) (Passenger, error) {
+	passenger, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Passenger{}, err
+	}
+	if passenger.FlightID != flightID {
+		return Passenger{}, sql.ErrNoRows
+	}
+	if err = s.repo.Delete(ctx, id); err != nil {
+		return Passenger{}, err
+	}
+	s.logger.With(ctx).Infof("removed passenger %v from flight %v", passenger, flightID)
+	return newPassenger(passenger), nil
+}
+
+// Manifest writes the passenger manifest of the flight with the specified ID as CSV.
+// Unlike the other responses, the manifest contains the full document numbers.
+func (s service) Manifest(ctx context.Context, flightID string, w io.Writer) error {
+	flight, err := s.repo.Flight(ctx, flightID)
+	if err != nil {
+		return err
+	}
+	passengers, err := s.repo.Query(ctx, flightID, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(manifestHeader); err != nil {
+		return err
+	}
+	for _, p := range passengers {
+		if err := cw.Write([]string{
+			flight.Number, flight.Departure, flight.Destination, flight.DepartureTime.UTC().Format(time.RFC3339),
+			p.LastName, p.FirstName, p.DateOfBirth.Format(dateLayout), p.Nationality, p.DocumentType, p.DocumentNumber,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	s.logger.With(ctx).Infof("exported the manifest of %v passengers of flight %v", len(passengers), flightID)
+	return cw.Error()
+}
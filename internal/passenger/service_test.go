@@ -0,0 +1,210 @@
+package passenger
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var errCRUD = errors.New("error crud")
+
+func TestCreatePassengerRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     CreatePassengerRequest
+		wantError bool
+	}{
+		{"success", mockRequest(), false},
+		{"required", CreatePassengerRequest{}, true},
+		{"accented name", func() CreatePassengerRequest { r := mockRequest(); r.LastName = "Öberg-d'Ávila"; return r }(), false},
+		{"invalid name", func() CreatePassengerRequest { r := mockRequest(); r.FirstName = "Anna1"; return r }(), true},
+		{"invalid date", func() CreatePassengerRequest { r := mockRequest(); r.DateOfBirth = "17.05.1990"; return r }(), true},
+		{"future date", func() CreatePassengerRequest {
+			r := mockRequest()
+			r.DateOfBirth = time.Now().AddDate(1, 0, 0).Format(dateLayout)
+			return r
+		}(), true},
+		{"unknown document type", func() CreatePassengerRequest { r := mockRequest(); r.DocumentType = "visa"; return r }(), true},
+		{"invalid document number", func() CreatePassengerRequest { r := mockRequest(); r.DocumentNumber = "AB-12"; return r }(), true},
+		{"invalid nationality", func() CreatePassengerRequest { r := mockRequest(); r.Nationality = "SWE"; return r }(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_service_CRUD(t *testing.T) {
+	logger, logs := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, logger)
+
+	ctx := context.Background()
+
+	// initial count
+	count, _ := s.Count(ctx, "f1")
+	assert.Equal(t, 0, count)
+	_, err := s.Count(ctx, "none")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// successful creation masks the document number
+	req := mockRequest()
+	req.DocumentNumber = " ab1234567 "
+	req.Nationality = "se"
+	passenger, err := s.Create(ctx, "f1", req)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, passenger.ID)
+	id := passenger.ID
+	assert.Equal(t, "Anna", passenger.FirstName)
+	assert.Equal(t, "1990-05-17", passenger.DateOfBirth)
+	assert.Equal(t, "SE", passenger.Nationality)
+	assert.Equal(t, "*****4567", passenger.DocumentNumber)
+	assert.Equal(t, "AB1234567", repo.items[0].DocumentNumber)
+	count, _ = s.Count(ctx, "f1")
+	assert.Equal(t, 1, count)
+
+	// the logs contain the masked document number only
+	for _, entry := range logs.All() {
+		assert.NotContains(t, entry.Message, "1234567")
+	}
+	assert.Equal(t, 1, logs.FilterMessageSnippet("*****4567").Len())
+
+	// the same document can't be added twice
+	_, err = s.Create(ctx, "f1", req)
+	assert.Equal(t, ErrDuplicate, err)
+
+	// validation error in creation
+	_, err = s.Create(ctx, "f1", CreatePassengerRequest{})
+	assert.NotNil(t, err)
+
+	// unknown flight
+	_, err = s.Create(ctx, "none", mockRequest())
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// unexpected error in creation
+	req = mockRequest()
+	req.FirstName = "error"
+	req.DocumentNumber = "CD7654321"
+	_, err = s.Create(ctx, "f1", req)
+	assert.Equal(t, errCRUD, err)
+
+	// query
+	passengers, _ := s.Query(ctx, "f1", 0, 0)
+	if assert.Equal(t, 1, len(passengers)) {
+		assert.Equal(t, "*****4567", passengers[0].DocumentNumber)
+	}
+	_, err = s.Query(ctx, "none", 0, 0)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// manifest
+	var buf bytes.Buffer
+	assert.Nil(t, s.Manifest(ctx, "f1", &buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Equal(t, 2, len(lines)) {
+		assert.Equal(t, "flight_number,departure,destination,departure_time,last_name,first_name,date_of_birth,nationality,document_type,document_number", lines[0])
+		assert.Equal(t, "F1,MSQ,ARN,2020-10-01T09:30:00Z,Berg,Anna,1990-05-17,SE,passport,AB1234567", lines[1])
+	}
+	assert.Equal(t, sql.ErrNoRows, s.Manifest(ctx, "none", &buf))
+
+	// delete
+	_, err = s.Delete(ctx, "f2", id)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.Delete(ctx, "f1", "none")
+	assert.NotNil(t, err)
+	passenger, err = s.Delete(ctx, "f1", id)
+	assert.Nil(t, err)
+	assert.Equal(t, id, passenger.ID)
+	assert.Equal(t, "*****4567", passenger.DocumentNumber)
+	count, _ = s.Count(ctx, "f1")
+	assert.Equal(t, 0, count)
+}
+
+func mockRequest() CreatePassengerRequest {
+	return CreatePassengerRequest{
+		FirstName:      "Anna",
+		LastName:       "Berg",
+		DateOfBirth:    "1990-05-17",
+		DocumentType:   entity.DocumentPassport,
+		DocumentNumber: "AB1234567",
+		Nationality:    "SE",
+	}
+}
+
+// mockFlights are the flights known to mockRepository.
+var mockFlights = map[string]entity.Flight{
+	"f1": {ID: "f1", Number: "F1", Departure: "MSQ", Destination: "ARN", DepartureTime: time.Date(2020, 10, 1, 9, 30, 0, 0, time.UTC)},
+	"f2": {ID: "f2", Number: "F2", Departure: "ARN", Destination: "MSQ", DepartureTime: time.Date(2020, 10, 2, 9, 30, 0, 0, time.UTC)},
+}
+
+type mockRepository struct {
+	items []entity.Passenger
+}
+
+func (m mockRepository) Flight(ctx context.Context, id string) (entity.Flight, error) {
+	if flight, ok := mockFlights[id]; ok {
+		return flight, nil
+	}
+	return entity.Flight{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.Passenger, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.Passenger{}, sql.ErrNoRows
+}
+
+func (m mockRepository) GetByDocument(ctx context.Context, flightID, documentType, documentNumber string) (entity.Passenger, error) {
+	for _, item := range m.items {
+		if item.FlightID == flightID && item.DocumentType == documentType && item.DocumentNumber == documentNumber {
+			return item, nil
+		}
+	}
+	return entity.Passenger{}, sql.ErrNoRows
+}
+
+func (m mockRepository) Count(ctx context.Context, flightID string) (int, error) {
+	items, _ := m.Query(ctx, flightID, 0, -1)
+	return len(items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, flightID string, offset, limit int) ([]entity.Passenger, error) {
+	var items []entity.Passenger
+	for _, item := range m.items {
+		if item.FlightID == flightID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, passenger entity.Passenger) error {
+	if passenger.FirstName == "error" {
+		return errCRUD
+	}
+	m.items = append(m.items, passenger)
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items[i] = m.items[len(m.items)-1]
+			m.items = m.items[:len(m.items)-1]
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package schedule
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nvnoskov/dynamo-backend/internal/aircraft"
+	"github.com/nvnoskov/dynamo-backend/internal/airport"
+	"github.com/nvnoskov/dynamo-backend/internal/auth"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	repo := &mockRepository{items: []entity.Schedule{
+		{
+			ID:                 "123",
+			Name:               "schedule123",
+			Number:             "123",
+			Departure:          "MSQ",
+			Destination:        "ARN",
+			DaysOfWeek:         "135",
+			LocalDepartureTime: "09:30",
+			DurationMinutes:    120,
+			ValidFrom:          time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
+			ValidTo:            time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC),
+			Fare:               "100EUR",
+			FareAmount:         10000,
+			FareCurrency:       "EUR",
+			CreatedAt:          time.Now(),
+			UpdatedAt:          time.Now(),
+		},
+	}}
+	RegisterHandlers(router.Group(""), NewService(repo, mockTransactional, airport.MockService{}, aircraft.MockService{}, 60, logger), auth.MockAuthHandler, logger)
+	header := auth.MockRoleAuthHeader(entity.RoleAdmin)
+	customer := auth.MockRoleAuthHeader(entity.RoleCustomer)
+
+	req := mockRequest()
+	body := fmt.Sprintf(`{"name":"test","number":"T1","departure":"MSQ","destination":"ARN","days_of_week":"15","local_departure_time":"12:00","duration_minutes":120,"valid_from":"%v","valid_to":"%v","fare":"100EUR"}`,
+		req.ValidFrom, req.ValidTo)
+	tests := []test.APITestCase{
+		{"get all", "GET", "/schedules", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get 123", "GET", "/schedules/123", "", header, http.StatusOK, `*"valid_from":"2020-10-01"*`},
+		{"get unknown", "GET", "/schedules/1234", "", header, http.StatusNotFound, ""},
+		{"create ok", "POST", "/schedules", body, header, http.StatusCreated, `*"days_of_week":"15"*`},
+		{"create ok count", "GET", "/schedules", "", header, http.StatusOK, `*"total_count":2*`},
+		{"create auth error", "POST", "/schedules", body, nil, http.StatusUnauthorized, ""},
+		{"create customer", "POST", "/schedules", body, customer, http.StatusForbidden, ""},
+		{"create input error", "POST", "/schedules", `"name":"test"}`, header, http.StatusBadRequest, ""},
+		{"create validation error", "POST", "/schedules", `{"name":"test","days_of_week":"8"}`, header, http.StatusBadRequest, `*"field":"days_of_week"*`},
+		{"update ok", "PUT", "/schedules/123", body, header, http.StatusOK, `*"number":"T1"*`},
+		{"update verify", "GET", "/schedules/123", "", header, http.StatusOK, `*"name":"test"*`},
+		{"update auth error", "PUT", "/schedules/123", body, nil, http.StatusUnauthorized, ""},
+		{"update customer", "PUT", "/schedules/123", body, customer, http.StatusForbidden, ""},
+		{"update input error", "PUT", "/schedules/123", `"name":"test"}`, header, http.StatusBadRequest, ""},
+		{"delete customer", "DELETE", "/schedules/123", ``, customer, http.StatusForbidden, ""},
+		{"delete ok", "DELETE", "/schedules/123", ``, header, http.StatusOK, "*test*"},
+		{"delete verify", "DELETE", "/schedules/123", ``, header, http.StatusNotFound, ""},
+		{"delete auth error", "DELETE", "/schedules/123", ``, nil, http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
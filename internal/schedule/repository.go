@@ -0,0 +1,240 @@
+package schedule
+
+import (
+	"context"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/nvnoskov/dynamo-backend/internal/aircraft"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/dbcontext"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+// Repository encapsulates the logic to access schedules and the flights they generate from the data source.
+type Repository interface {
+	// Get returns the schedule with the specified schedule ID.
+	Get(ctx context.Context, id string) (entity.Schedule, error)
+	// Lock returns the schedule with the specified schedule ID and locks it until the end of the transaction,
+	// so that the flights of the schedule are changed one transaction at a time.
+	Lock(ctx context.Context, id string) (entity.Schedule, error)
+	// Count returns the number of schedules.
+	Count(ctx context.Context) (int, error)
+	// Query returns the list of schedules with the given offset and limit.
+	Query(ctx context.Context, offset, limit int) ([]entity.Schedule, error)
+	// Create saves a new schedule in the storage.
+	Create(ctx context.Context, schedule entity.Schedule) error
+	// Update updates the schedule with given ID in the storage.
+	Update(ctx context.Context, schedule entity.Schedule) error
+	// Delete removes the schedule with given ID from the storage.
+	// Its flights departing after the given time are removed too unless they have held or booked seats
+	// or passengers, while the other ones are detached from it.
+	Delete(ctx context.Context, id string, after time.Time) error
+	// Instances returns the flights of the schedule departing after the given time and locks them
+	// until the end of the transaction it is called in.
+	Instances(ctx context.Context, scheduleID string, after time.Time) ([]entity.Flight, error)
+	// BookedInstances returns the IDs of the flights of the schedule departing after the given time
+	// that have held or booked seats or passengers.
+	BookedInstances(ctx context.Context, scheduleID string, after time.Time) ([]string, error)
+	// CreateInstance saves a new flight generated by a schedule together with its seats in the storage.
+	CreateInstance(ctx context.Context, flight entity.Flight) error
+	// UpdateInstance updates a flight generated by a schedule in the storage, incrementing its version.
+	// Its seats are generated again if its aircraft configuration changes.
+	UpdateInstance(ctx context.Context, flight entity.Flight) error
+	// DeleteInstance removes a flight generated by a schedule together with its seats from the storage.
+	DeleteInstance(ctx context.Context, id string) error
+}
+
+// repository persists schedules in database
+type repository struct {
+	db       *dbcontext.DB
+	aircraft aircraft.Repository
+	logger   log.Logger
+}
+
+// NewRepository creates a new schedule repository managing the seats of the flights with the aircraft repository
+func NewRepository(db *dbcontext.DB, aircraft aircraft.Repository, logger log.Logger) Repository {
+	return repository{db, aircraft, logger}
+}
+
+// Get reads the schedule with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Schedule, error) {
+	var schedule entity.Schedule
+	err := r.db.With(ctx).Select().Model(id, &schedule)
+	return schedule, err
+}
+
+// Lock reads the schedule with the specified ID from the database with SELECT ... FOR UPDATE.
+func (r repository) Lock(ctx context.Context, id string) (entity.Schedule, error) {
+	var schedule entity.Schedule
+	query := r.db.With(ctx).Select().From("schedule").Where(dbx.HashExp{"id": id}).Build()
+	err := r.db.With(ctx).NewQuery(query.SQL() + " FOR UPDATE").Bind(query.Params()).One(&schedule)
+	return schedule, err
+}
+
+// Create saves a new schedule record in the database.
+func (r repository) Create(ctx context.Context, schedule entity.Schedule) error {
+	return r.db.With(ctx).Model(&schedule).Insert()
+}
+
+// Update saves the changes to a schedule in the database.
+func (r repository) Update(ctx context.Context, schedule entity.Schedule) error {
+	return r.db.With(ctx).Model(&schedule).Update()
+}
+
+// takenExp matches the flights having held or booked seats, passengers or seat claims.
+const takenExp = "(EXISTS (SELECT 1 FROM seat WHERE seat.flight_id=flight.id AND seat.status<>'available')" +
+	" OR EXISTS (SELECT 1 FROM passenger WHERE passenger.flight_id=flight.id)" +
+	" OR EXISTS (SELECT 1 FROM seat_claim WHERE seat_claim.flight_id=flight.id AND seat_claim.status<>'released'))"
+
+// Delete deletes the schedule with the specified ID together with its flights departing after the given time.
+// The earlier flights and the ones with held or booked seats or passengers are kept but no longer refer to the schedule.
+func (r repository) Delete(ctx context.Context, id string, after time.Time) error {
+	schedule, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		var ids []string
+		if err := r.db.With(ctx).
+			Select("id").
+			From("flight").
+			Where(dbx.And(
+				dbx.HashExp{"schedule_id": id},
+				dbx.NewExp("departure_time>{:after}", dbx.Params{"after": after}),
+				dbx.NewExp("NOT "+takenExp),
+			)).
+			Column(&ids); err != nil {
+			return err
+		}
+		if err := r.aircraft.DeleteSeats(ctx, ids...); err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			if _, err := r.db.With(ctx).Delete("flight", dbx.HashExp{"id": ids}).Execute(); err != nil {
+				return err
+			}
+		}
+		if _, err := r.db.With(ctx).Update("flight", dbx.Params{"schedule_id": nil}, dbx.HashExp{"schedule_id": id}).Execute(); err != nil {
+			return err
+		}
+		return r.db.With(ctx).Model(&schedule).Delete()
+	})
+}
+
+// Count returns the number of the schedule records in the database.
+func (r repository) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("schedule").Row(&count)
+	return count, err
+}
+
+// Query retrieves the schedule records with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Schedule, error) {
+	var schedules []entity.Schedule
+	err := r.db.With(ctx).
+		Select().
+		OrderBy("number", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&schedules)
+	return schedules, err
+}
+
+// Instances reads the flights of the schedule departing after the given time from the database
+// with SELECT ... FOR UPDATE, so that no seats of them can be held until the transaction ends.
+func (r repository) Instances(ctx context.Context, scheduleID string, after time.Time) ([]entity.Flight, error) {
+	var flights []entity.Flight
+	query := r.db.With(ctx).
+		Select().
+		From("flight").
+		Where(dbx.And(
+			dbx.HashExp{"schedule_id": scheduleID},
+			dbx.NewExp("departure_time>{:after}", dbx.Params{"after": after}),
+		)).
+		OrderBy("departure_time", "id").
+		Build()
+	err := r.db.With(ctx).NewQuery(query.SQL() + " FOR UPDATE").Bind(query.Params()).All(&flights)
+	return flights, err
+}
+
+// BookedInstances reads the IDs of the flights of the schedule departing after the given time
+// that have held or booked seats or passengers from the database.
+func (r repository) BookedInstances(ctx context.Context, scheduleID string, after time.Time) ([]string, error) {
+	var ids []string
+	err := r.db.With(ctx).
+		Select("id").
+		From("flight").
+		Where(dbx.And(
+			dbx.HashExp{"schedule_id": scheduleID},
+			dbx.NewExp("departure_time>{:after}", dbx.Params{"after": after}),
+			dbx.NewExp(takenExp),
+		)).
+		OrderBy("id").
+		Column(&ids)
+	return ids, err
+}
+
+// CreateInstance saves a new flight record generated by a schedule in the database.
+// The seats of the flight are generated from its aircraft configuration.
+func (r repository) CreateInstance(ctx context.Context, flight entity.Flight) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		if err := r.db.With(ctx).Model(&flight).Insert(); err != nil {
+			return err
+		}
+		if flight.AircraftID == nil {
+			return nil
+		}
+		return r.aircraft.GenerateSeats(ctx, flight.ID)
+	})
+}
+
+// UpdateInstance saves the changes to a flight generated by a schedule in the database.
+// The flight version is incremented so that clients holding the previous version get a conflict.
+func (r repository) UpdateInstance(ctx context.Context, flight entity.Flight) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		var stored entity.Flight
+		if err := r.db.With(ctx).Select().Model(flight.ID, &stored); err != nil {
+			return err
+		}
+		if err := r.updateInstance(ctx, flight); err != nil {
+			return err
+		}
+		if aircraft.SameID(stored.AircraftID, flight.AircraftID) {
+			return nil
+		}
+		return r.aircraft.GenerateSeats(ctx, flight.ID)
+	})
+}
+
+// updateInstance saves the fields of a flight generated by a schedule in the database.
+func (r repository) updateInstance(ctx context.Context, flight entity.Flight) error {
+	_, err := r.db.With(ctx).Update("flight", dbx.Params{
+		"name":             flight.Name,
+		"number":           flight.Number,
+		"departure":        flight.Departure,
+		"departure_time":   flight.DepartureTime,
+		"destination":      flight.Destination,
+		"arrival_time":     flight.ArrivalTime,
+		"fare":             flight.Fare,
+		"fare_amount":      flight.FareAmount,
+		"fare_currency":    flight.FareCurrency,
+		"duration_minutes": flight.DurationMinutes,
+		"aircraft_id":      flight.AircraftID,
+		"capacity":         flight.Capacity,
+		"updated_at":       flight.UpdatedAt,
+		"version":          dbx.NewExp("version+1"),
+	}, dbx.HashExp{"id": flight.ID}).Execute()
+	return err
+}
+
+// DeleteInstance deletes a flight generated by a schedule from the database.
+func (r repository) DeleteInstance(ctx context.Context, id string) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		if err := r.aircraft.DeleteSeats(ctx, id); err != nil {
+			return err
+		}
+		_, err := r.db.With(ctx).Delete("flight", dbx.HashExp{"id": id}).Execute()
+		return err
+	})
+}
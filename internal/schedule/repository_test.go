@@ -0,0 +1,143 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/nvnoskov/dynamo-backend/internal/aircraft"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/internal/test"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	logger, _ := log.NewForTest()
+	db := test.DB(t)
+	test.ResetTables(t, db, "flight", "schedule", "seat", "aircraft")
+	repo := NewRepository(db, aircraft.NewRepository(db, logger), logger)
+
+	ctx := context.Background()
+	now := time.Now()
+
+	// create
+	schedule := entity.Schedule{
+		ID:                 "s1",
+		Name:               "schedule1",
+		Number:             "S1",
+		Departure:          "MSQ",
+		Destination:        "ARN",
+		DaysOfWeek:         "135",
+		LocalDepartureTime: "09:30",
+		DurationMinutes:    120,
+		ValidFrom:          time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
+		ValidTo:            time.Date(2030, 12, 31, 0, 0, 0, 0, time.UTC),
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	schedule.SetFare(entity.Money{Amount: 10000, Currency: "EUR"})
+	assert.Nil(t, repo.Create(ctx, schedule))
+	count, err := repo.Count(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	// get
+	schedule, err = repo.Get(ctx, "s1")
+	assert.Nil(t, err)
+	assert.Equal(t, "schedule1", schedule.Name)
+	assert.Equal(t, "135", schedule.DaysOfWeek)
+	_, err = repo.Get(ctx, "s0")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// lock within a transaction
+	err = db.Transactional(ctx, func(ctx context.Context) error {
+		locked, err := repo.Lock(ctx, "s1")
+		assert.Equal(t, "schedule1", locked.Name)
+		return err
+	})
+	assert.Nil(t, err)
+	_, err = repo.Lock(ctx, "s0")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// update
+	schedule.Name = "schedule1 updated"
+	assert.Nil(t, repo.Update(ctx, schedule))
+	schedule, _ = repo.Get(ctx, "s1")
+	assert.Equal(t, "schedule1 updated", schedule.Name)
+
+	// query
+	schedules, err := repo.Query(ctx, 0, count)
+	assert.Nil(t, err)
+	assert.Equal(t, count, len(schedules))
+
+	// instances
+	scheduleID := "s1"
+	past := entity.Flight{ID: "s1-past", Name: "past", Number: "S1", Departure: "MSQ", Destination: "ARN",
+		ScheduleID: &scheduleID, Version: 1, Status: entity.FlightScheduled, CreatedAt: now, UpdatedAt: now}
+	past.SetTimes(now.Add(-48*time.Hour), now.Add(-46*time.Hour))
+	past.SetFare(entity.Money{Amount: 10000, Currency: "EUR"})
+	future := past
+	future.ID, future.Name = "s1-future", "future"
+	future.SetTimes(now.Add(48*time.Hour), now.Add(50*time.Hour))
+	assert.Nil(t, repo.CreateInstance(ctx, past))
+	assert.Nil(t, repo.CreateInstance(ctx, future))
+	flights, err := repo.Instances(ctx, "s1", now)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(flights)) {
+		assert.Equal(t, "s1-future", flights[0].ID)
+	}
+
+	future.Name = "future updated"
+	assert.Nil(t, repo.UpdateInstance(ctx, future))
+	flights, _ = repo.Instances(ctx, "s1", now)
+	if assert.Equal(t, 1, len(flights)) {
+		assert.Equal(t, "future updated", flights[0].Name)
+		assert.Equal(t, 2, flights[0].Version)
+	}
+
+	// changing the aircraft configuration generates the seats
+	assert.Nil(t, db.DB().Model(&entity.Aircraft{
+		ID:        "a320",
+		Name:      "A320",
+		Cabins:    entity.Cabins{{Class: entity.CabinEconomy, FirstRow: 1, LastRow: 2, Letters: "ABC"}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}).Insert())
+	aircraftID := "a320"
+	future.AircraftID = &aircraftID
+	assert.Nil(t, repo.UpdateInstance(ctx, future))
+	var seats int
+	assert.Nil(t, db.DB().Select("COUNT(*)").From("seat").Where(dbx.HashExp{"flight_id": "s1-future"}).Row(&seats))
+	assert.Equal(t, 6, seats)
+
+	// booked flights keep their seats
+	booked, err := repo.BookedInstances(ctx, "s1", now)
+	assert.Nil(t, err)
+	assert.Empty(t, booked)
+	_, err = db.DB().Update("seat", dbx.Params{"status": entity.SeatBooked}, dbx.HashExp{"flight_id": "s1-future", "number": "1A"}).Execute()
+	assert.Nil(t, err)
+	booked, _ = repo.BookedInstances(ctx, "s1", now)
+	assert.Equal(t, []string{"s1-future"}, booked)
+	assert.NotNil(t, repo.DeleteInstance(ctx, "s1-future"))
+	_, err = db.DB().Update("seat", dbx.Params{"status": entity.SeatAvailable}, dbx.HashExp{"flight_id": "s1-future"}).Execute()
+	assert.Nil(t, err)
+
+	assert.Nil(t, repo.DeleteInstance(ctx, "s1-future"))
+	flights, _ = repo.Instances(ctx, "s1", now)
+	assert.Equal(t, 0, len(flights))
+	assert.Nil(t, db.DB().Select("COUNT(*)").From("seat").Where(dbx.HashExp{"flight_id": "s1-future"}).Row(&seats))
+	assert.Equal(t, 0, seats)
+
+	// delete keeps the past flights detached from the schedule
+	assert.Nil(t, repo.CreateInstance(ctx, future))
+	assert.Nil(t, repo.Delete(ctx, "s1", now))
+	_, err = repo.Get(ctx, "s1")
+	assert.Equal(t, sql.ErrNoRows, err)
+	var flight entity.Flight
+	assert.Nil(t, db.DB().Select().From("flight").Where(dbx.HashExp{"id": "s1-past"}).One(&flight))
+	assert.Nil(t, flight.ScheduleID)
+	assert.NotNil(t, db.DB().Select().From("flight").Where(dbx.HashExp{"id": "s1-future"}).One(&flight))
+}
@@ -0,0 +1,460 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/nvnoskov/dynamo-backend/internal/aircraft"
+	"github.com/nvnoskov/dynamo-backend/internal/airport"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/dbcontext"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+// dateLayout is the layout of the validity period dates.
+const dateLayout = "2006-01-02"
+
+// Service encapsulates usecase logic for schedules.
+type Service interface {
+	Get(ctx context.Context, id string) (Schedule, error)
+	Query(ctx context.Context, offset, limit int) ([]Schedule, error)
+	Count(ctx context.Context) (int, error)
+	Create(ctx context.Context, input CreateScheduleRequest) (Schedule, error)
+	Update(ctx context.Context, id string, input UpdateScheduleRequest) (Schedule, error)
+	Delete(ctx context.Context, id string) (Schedule, error)
+	Generate(ctx context.Context) (int, error)
+}
+
+// Schedule represents the data about a schedule.
+type Schedule struct {
+	entity.Schedule
+	ValidFrom string `json:"valid_from"` // first day of operation, e.g. "2020-10-01"
+	ValidTo   string `json:"valid_to"`   // last day of operation
+}
+
+// CreateScheduleRequest represents a schedule creation request.
+type CreateScheduleRequest struct {
+	Name               string `json:"name"`                 // name of the scheduled flights
+	Number             string `json:"number"`               // flight number
+	Departure          string `json:"departure"`            // departure airport IATA code
+	Destination        string `json:"destination"`          // destination airport IATA code
+	DaysOfWeek         string `json:"days_of_week"`         // ISO weekdays of operation, e.g. "135"
+	LocalDepartureTime string `json:"local_departure_time"` // departure time in the departure airport time zone, e.g. "14:35"
+	DurationMinutes    int    `json:"duration_minutes"`     // flight duration in minutes
+	ValidFrom          string `json:"valid_from"`           // first day of operation, e.g. "2020-10-01"
+	ValidTo            string `json:"valid_to"`             // last day of operation
+	Fare               string `json:"fare"`                 // fare, e.g. "100EUR"
+	AircraftID         string `json:"aircraft_id"`          // ID of the aircraft configuration of the flights, optional
+}
+
+var (
+	daysOfWeekRegex = regexp.MustCompile(`^[1-7]{1,7}$`)
+	localTimeRegex  = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+)
+
+// Validate validates the CreateScheduleRequest fields.
+func (m CreateScheduleRequest) Validate() error {
+	validTo := validation.Date(dateLayout).Error("must be a date in the format YYYY-MM-DD")
+	if from, err := time.Parse(dateLayout, m.ValidFrom); err == nil {
+		validTo = validTo.Min(from).RangeError("must not be earlier than valid_from")
+	}
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.Number, validation.Required, validation.Length(0, 20)),
+		validation.Field(&m.Departure, validation.Required, validation.Match(airport.CodeRegex).Error("must be an IATA airport code")),
+		validation.Field(&m.Destination, validation.Required, validation.Match(airport.CodeRegex).Error("must be an IATA airport code"),
+			validation.NotIn(m.Departure).Error("must be different from departure")),
+		validation.Field(&m.DaysOfWeek, validation.Required,
+			validation.Match(daysOfWeekRegex).Error(`must be ISO weekday numbers, e.g. "135" for Monday, Wednesday and Friday`),
+			validation.By(validateDistinct)),
+		validation.Field(&m.LocalDepartureTime, validation.Required, validation.Match(localTimeRegex).Error("must be a time in the format HH:MM")),
+		validation.Field(&m.DurationMinutes, validation.Required, validation.Min(1), validation.Max(24*60)),
+		validation.Field(&m.ValidFrom, validation.Required, validation.Date(dateLayout).Error("must be a date in the format YYYY-MM-DD")),
+		validation.Field(&m.ValidTo, validation.Required, validTo),
+		validation.Field(&m.Fare, validation.Required, validation.Length(0, 20), validation.By(validateFare)),
+	)
+}
+
+// UpdateScheduleRequest represents a schedule update request.
+type UpdateScheduleRequest CreateScheduleRequest
+
+// Validate validates the UpdateScheduleRequest fields.
+func (m UpdateScheduleRequest) Validate() error {
+	return CreateScheduleRequest(m).Validate()
+}
+
+// validateDistinct checks that no weekday is repeated.
+func validateDistinct(value interface{}) error {
+	s, _ := value.(string)
+	for i, c := range s {
+		if strings.ContainsRune(s[i+1:], c) {
+			return validation.NewError("validation_days_distinct", "must not repeat a weekday")
+		}
+	}
+	return nil
+}
+
+// validateFare checks that the value is money in a supported currency.
+func validateFare(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	if _, err := entity.ParseMoney(s); err != nil {
+		return validation.NewError("validation_fare", "must be an amount with an ISO 4217 currency code, e.g. 100EUR")
+	}
+	return nil
+}
+
+type service struct {
+	repo          Repository
+	transactional dbcontext.TransactionFunc
+	airports      airport.Service
+	aircraft      aircraft.Service
+	horizonDays   int
+	logger        log.Logger
+}
+
+// NewService creates a new schedule service.
+// The airports provide the time zones the local departure times are in.
+// The aircraft configurations are used to validate the seat layout of the flights.
+// The flights of the schedules are generated for the given number of days ahead,
+// in the same transaction as the changes of the schedule they are generated from.
+func NewService(repo Repository, transactional dbcontext.TransactionFunc, airports airport.Service, aircraft aircraft.Service,
+	horizonDays int, logger log.Logger) Service {
+	return service{repo, transactional, airports, aircraft, horizonDays, logger}
+}
+
+// Get returns the schedule with the specified the schedule ID.
+func (s service) Get(ctx context.Context, id string) (Schedule, error) {
+	schedule, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Schedule{}, err
+	}
+	return newSchedule(schedule), nil
+}
+
+// newSchedule creates the Schedule with the validity period given as dates.
+func newSchedule(schedule entity.Schedule) Schedule {
+	return Schedule{
+		Schedule:  schedule,
+		ValidFrom: schedule.ValidFrom.Format(dateLayout),
+		ValidTo:   schedule.ValidTo.Format(dateLayout),
+	}
+}
+
+// Create creates a new schedule and generates its flights.
+func (s service) Create(ctx context.Context, req CreateScheduleRequest) (Schedule, error) {
+	if err := req.Validate(); err != nil {
+		return Schedule{}, err
+	}
+	if err := s.validateReferences(ctx, req.Departure, req.Destination, req.AircraftID); err != nil {
+		return Schedule{}, err
+	}
+	now := time.Now()
+	schedule := entity.Schedule{
+		ID:        entity.GenerateID(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	setFields(&schedule, req)
+	if err := s.transactional(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, schedule); err != nil {
+			return err
+		}
+		_, err := s.sync(ctx, schedule, now)
+		return err
+	}); err != nil {
+		return Schedule{}, err
+	}
+	return s.Get(ctx, schedule.ID)
+}
+
+// Update updates the schedule with the specified ID.
+// The changes are propagated to the future flights of the schedule.
+func (s service) Update(ctx context.Context, id string, req UpdateScheduleRequest) (Schedule, error) {
+	if err := req.Validate(); err != nil {
+		return Schedule{}, err
+	}
+	if err := s.validateReferences(ctx, req.Departure, req.Destination, req.AircraftID); err != nil {
+		return Schedule{}, err
+	}
+
+	now := time.Now()
+	if err := s.transactional(ctx, func(ctx context.Context) error {
+		schedule, err := s.repo.Lock(ctx, id)
+		if err != nil {
+			return err
+		}
+		setFields(&schedule, CreateScheduleRequest(req))
+		schedule.UpdatedAt = now
+		if err := s.repo.Update(ctx, schedule); err != nil {
+			return err
+		}
+		_, err = s.sync(ctx, schedule, now)
+		return err
+	}); err != nil {
+		return Schedule{}, err
+	}
+	return s.Get(ctx, id)
+}
+
+// setFields copies the fields of the validated request into the schedule.
+func setFields(schedule *entity.Schedule, req CreateScheduleRequest) {
+	fare, _ := entity.ParseMoney(req.Fare)
+	schedule.Name = req.Name
+	schedule.Number = req.Number
+	schedule.Departure = req.Departure
+	schedule.Destination = req.Destination
+	schedule.DaysOfWeek = req.DaysOfWeek
+	schedule.LocalDepartureTime = req.LocalDepartureTime
+	schedule.DurationMinutes = req.DurationMinutes
+	schedule.ValidFrom, _ = time.Parse(dateLayout, req.ValidFrom)
+	schedule.ValidTo, _ = time.Parse(dateLayout, req.ValidTo)
+	schedule.SetFare(fare)
+	schedule.AircraftID = nil
+	if req.AircraftID != "" {
+		schedule.AircraftID = &req.AircraftID
+	}
+}
+
+// Delete deletes the schedule with the specified ID together with its future flights.
+// The schedule is locked meanwhile, so that no flights of it can be generated concurrently.
+func (s service) Delete(ctx context.Context, id string) (Schedule, error) {
+	var schedule entity.Schedule
+	err := s.transactional(ctx, func(ctx context.Context) error {
+		var err error
+		if schedule, err = s.repo.Lock(ctx, id); err != nil {
+			return err
+		}
+		return s.repo.Delete(ctx, id, time.Now())
+	})
+	if err != nil {
+		return Schedule{}, err
+	}
+	return newSchedule(schedule), nil
+}
+
+// Count returns the number of schedules.
+func (s service) Count(ctx context.Context) (int, error) {
+	return s.repo.Count(ctx)
+}
+
+// Query returns the schedules with the specified offset and limit.
+func (s service) Query(ctx context.Context, offset, limit int) ([]Schedule, error) {
+	items, err := s.repo.Query(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Schedule{}
+	for _, item := range items {
+		result = append(result, newSchedule(item))
+	}
+	return result, nil
+}
+
+// Generate brings the flights of all schedules up to date for the horizon.
+// It is idempotent and returns the number of flights created, updated or deleted.
+// The schedules failing to synchronize are skipped, and the first of their errors is returned.
+func (s service) Generate(ctx context.Context) (int, error) {
+	const batchSize = 100
+	now := time.Now()
+	changed := 0
+	var failed error
+	for offset := 0; ; offset += batchSize {
+		schedules, err := s.repo.Query(ctx, offset, batchSize)
+		if err != nil {
+			return changed, err
+		}
+		for _, schedule := range schedules {
+			count := 0
+			// a schedule failing to synchronize doesn't keep the other ones from being synchronized,
+			// and the schedules deleted since they were read are skipped
+			if err := s.transactional(ctx, func(ctx context.Context) error {
+				locked, err := s.repo.Lock(ctx, schedule.ID)
+				if errors.Is(err, sql.ErrNoRows) {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				count, err = s.sync(ctx, locked, now)
+				return err
+			}); err != nil {
+				s.logger.With(ctx).Errorf("failed to synchronize the flights of schedule %v: %v", schedule.ID, err)
+				if failed == nil {
+					failed = err
+				}
+				continue
+			}
+			changed += count
+		}
+		if len(schedules) < batchSize {
+			return changed, failed
+		}
+	}
+}
+
+// sync creates the missing flights of the schedule departing within the horizon, updates the future flights
+// that differ from the schedule and deletes the future flights the schedule no longer operates.
+// The flights with held or booked seats or passengers and the flights edited since they were generated are not changed.
+// It returns the number of flights created, updated or deleted.
+func (s service) sync(ctx context.Context, schedule entity.Schedule, now time.Time) (int, error) {
+	a, err := s.airports.Get(ctx, schedule.Departure)
+	if err != nil {
+		return 0, err
+	}
+	loc, err := a.Location()
+	if err != nil {
+		return 0, err
+	}
+	current, err := s.repo.Instances(ctx, schedule.ID, now)
+	if err != nil {
+		return 0, err
+	}
+	existing := map[string]entity.Flight{}
+	for _, flight := range current {
+		existing[flight.ID] = flight
+	}
+	// the flights somebody has seats on or flies on are left as they are
+	booked, err := s.repo.BookedInstances(ctx, schedule.ID, now)
+	if err != nil {
+		return 0, err
+	}
+	skip := map[string]bool{}
+	for _, id := range booked {
+		delete(existing, id)
+		skip[id] = true
+	}
+	// so are the flights edited by hand, which would otherwise lose the changes
+	for id, flight := range existing {
+		if flight.EditedAt != nil {
+			delete(existing, id)
+			skip[id] = true
+		}
+	}
+
+	// the flights have as many seats on sale as the aircraft configuration has
+	capacity := 0
+	if schedule.AircraftID != nil {
+		a, err := s.aircraft.Get(ctx, *schedule.AircraftID)
+		if err != nil {
+			return 0, err
+		}
+		capacity = a.Capacity
+	}
+
+	changed := 0
+	for _, flight := range instances(schedule, loc, now, s.horizonDays) {
+		if skip[flight.ID] {
+			continue
+		}
+		flight.Capacity = capacity
+		if old, ok := existing[flight.ID]; ok {
+			delete(existing, flight.ID)
+			if sameInstance(old, flight) {
+				continue
+			}
+			flight.CreatedAt = old.CreatedAt
+			err = s.repo.UpdateInstance(ctx, flight)
+		} else {
+			err = s.repo.CreateInstance(ctx, flight)
+		}
+		if errors.Is(err, aircraft.ErrSeatsTaken) {
+			s.logger.With(ctx).Infof("left flight %v of schedule %v unchanged as it has held or booked seats", flight.ID, schedule.ID)
+			continue
+		} else if err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	for id := range existing {
+		if err := s.repo.DeleteInstance(ctx, id); errors.Is(err, aircraft.ErrSeatsTaken) {
+			s.logger.With(ctx).Infof("left flight %v of schedule %v unchanged as it has held or booked seats", id, schedule.ID)
+			continue
+		} else if err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	if changed > 0 {
+		s.logger.With(ctx).Infof("synchronized %v flights of schedule %v", changed, schedule.ID)
+	}
+	return changed, nil
+}
+
+// instances returns the flights of the schedule departing after now and within the horizon.
+// A flight ID is derived from the schedule ID and the local departure date, so that generating is idempotent.
+func instances(schedule entity.Schedule, loc *time.Location, now time.Time, horizonDays int) []entity.Flight {
+	var hour, minute int
+	if _, err := fmt.Sscanf(schedule.LocalDepartureTime, "%d:%d", &hour, &minute); err != nil {
+		return nil
+	}
+	local := now.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	end := day.AddDate(0, 0, horizonDays)
+	if from := time.Date(schedule.ValidFrom.Year(), schedule.ValidFrom.Month(), schedule.ValidFrom.Day(), 0, 0, 0, 0, loc); from.After(day) {
+		day = from
+	}
+	if to := time.Date(schedule.ValidTo.Year(), schedule.ValidTo.Month(), schedule.ValidTo.Day()+1, 0, 0, 0, 0, loc); to.Before(end) {
+		end = to
+	}
+
+	var flights []entity.Flight
+	for ; day.Before(end); day = day.AddDate(0, 0, 1) {
+		departure := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+		if !schedule.OperatesOn(day.Weekday()) || !departure.After(now) {
+			continue
+		}
+		scheduleID := schedule.ID
+		flight := entity.Flight{
+			ID:          fmt.Sprintf("%v-%v", schedule.ID, day.Format("20060102")),
+			Name:        schedule.Name,
+			Number:      schedule.Number,
+			Departure:   schedule.Departure,
+			Destination: schedule.Destination,
+			Version:     1,
+			Status:      entity.FlightScheduled,
+			ScheduleID:  &scheduleID,
+			AircraftID:  schedule.AircraftID,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		flight.SetTimes(departure, departure.Add(time.Duration(schedule.DurationMinutes)*time.Minute))
+		flight.SetFare(entity.Money{Amount: schedule.FareAmount, Currency: schedule.FareCurrency})
+		flights = append(flights, flight)
+	}
+	return flights
+}
+
+// sameInstance reports whether the stored flight matches the flight generated from its schedule.
+func sameInstance(stored, generated entity.Flight) bool {
+	return stored.Name == generated.Name &&
+		stored.Number == generated.Number &&
+		stored.Departure == generated.Departure &&
+		stored.Destination == generated.Destination &&
+		stored.DepartureTime.Equal(generated.DepartureTime) &&
+		stored.ArrivalTime.Equal(generated.ArrivalTime) &&
+		stored.FareAmount == generated.FareAmount &&
+		stored.FareCurrency == generated.FareCurrency &&
+		stored.Capacity == generated.Capacity &&
+		aircraft.SameID(stored.AircraftID, generated.AircraftID)
+}
+
+// validateReferences checks that the departure and destination are known airports
+// and that the aircraft configuration, if given, exists.
+func (s service) validateReferences(ctx context.Context, departure, destination, aircraftID string) error {
+	errs, err := airport.ValidateCodes(ctx, s.airports, map[string]string{"departure": departure, "destination": destination})
+	if err != nil {
+		return err
+	}
+	if _, err := aircraft.ValidateReference(ctx, s.aircraft, aircraftID, 0, errs); err != nil {
+		return err
+	}
+	return errs.Filter()
+}
@@ -0,0 +1,390 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nvnoskov/dynamo-backend/internal/aircraft"
+	"github.com/nvnoskov/dynamo-backend/internal/airport"
+	"github.com/nvnoskov/dynamo-backend/internal/entity"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+var errCRUD = errors.New("error crud")
+
+func TestCreateScheduleRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     CreateScheduleRequest
+		wantError bool
+	}{
+		{"success", mockRequest(), false},
+		{"required", CreateScheduleRequest{}, true},
+		{"same airports", func() CreateScheduleRequest { r := mockRequest(); r.Destination = r.Departure; return r }(), true},
+		{"invalid days", func() CreateScheduleRequest { r := mockRequest(); r.DaysOfWeek = "08"; return r }(), true},
+		{"repeated days", func() CreateScheduleRequest { r := mockRequest(); r.DaysOfWeek = "113"; return r }(), true},
+		{"invalid time", func() CreateScheduleRequest { r := mockRequest(); r.LocalDepartureTime = "24:00"; return r }(), true},
+		{"negative duration", func() CreateScheduleRequest { r := mockRequest(); r.DurationMinutes = -60; return r }(), true},
+		{"invalid period", func() CreateScheduleRequest { r := mockRequest(); r.ValidTo = "2020-09-30"; return r }(), true},
+		{"invalid fare", func() CreateScheduleRequest { r := mockRequest(); r.Fare = "100"; return r }(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func Test_instances(t *testing.T) {
+	loc, _ := time.LoadLocation("Europe/Minsk")
+	schedule := entity.Schedule{
+		ID:                 "s1",
+		DaysOfWeek:         "13",
+		LocalDepartureTime: "09:30",
+		DurationMinutes:    90,
+		ValidFrom:          time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
+		ValidTo:            time.Date(2020, 10, 31, 0, 0, 0, 0, time.UTC),
+	}
+	schedule.SetFare(entity.Money{Amount: 10000, Currency: "EUR"})
+
+	// Monday, 5 October 2020, after the departure of the day
+	now := time.Date(2020, 10, 5, 7, 0, 0, 0, time.UTC)
+	flights := instances(schedule, loc, now, 8)
+	if assert.Equal(t, 2, len(flights)) {
+		assert.Equal(t, "s1-20201007", flights[0].ID)
+		assert.Equal(t, time.Date(2020, 10, 7, 6, 30, 0, 0, time.UTC), flights[0].DepartureTime.UTC())
+		assert.Equal(t, time.Date(2020, 10, 7, 8, 0, 0, 0, time.UTC), flights[0].ArrivalTime.UTC())
+		assert.Equal(t, "100EUR", flights[0].Fare)
+		assert.Equal(t, "s1", *flights[0].ScheduleID)
+		assert.Equal(t, "s1-20201012", flights[1].ID)
+	}
+
+	// the validity period bounds the flights
+	flights = instances(schedule, loc, now, 60)
+	if assert.Equal(t, 7, len(flights)) {
+		assert.Equal(t, "s1-20201028", flights[6].ID)
+	}
+	assert.Empty(t, instances(schedule, loc, time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC), 7))
+}
+
+func Test_service_CRUD(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, mockTransactional, airport.MockService{}, aircraft.MockService{}, 15, logger)
+
+	ctx := context.Background()
+
+	// initial count
+	count, _ := s.Count(ctx)
+	assert.Equal(t, 0, count)
+
+	// successful creation generates the flights of the horizon
+	req := mockRequest()
+	schedule, err := s.Create(ctx, req)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, schedule.ID)
+	id := schedule.ID
+	assert.Equal(t, "test", schedule.Name)
+	assert.Equal(t, req.ValidFrom, schedule.ValidFrom)
+	assert.Equal(t, "100EUR", schedule.Fare)
+	assert.Equal(t, 4, len(repo.flights))
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 1, count)
+
+	// validation error in creation
+	_, err = s.Create(ctx, CreateScheduleRequest{})
+	assert.NotNil(t, err)
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 1, count)
+
+	// unknown airport
+	req.Destination = "XXX"
+	_, err = s.Create(ctx, req)
+	assert.NotNil(t, err)
+
+	// generating again changes nothing
+	changed, err := s.Generate(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, changed)
+	assert.Equal(t, 4, len(repo.flights))
+
+	// unknown aircraft configuration
+	req = mockRequest()
+	req.AircraftID = "b737"
+	_, err = s.Create(ctx, req)
+	assert.NotNil(t, err)
+
+	// update propagates to the future flights
+	update := UpdateScheduleRequest(mockRequest())
+	update.DaysOfWeek = "1"
+	update.Fare = "120EUR"
+	update.AircraftID = "a320"
+	schedule, err = s.Update(ctx, id, update)
+	assert.Nil(t, err)
+	assert.Equal(t, "120EUR", schedule.Fare)
+	assert.Equal(t, 2, len(repo.flights))
+	for _, flight := range repo.flights {
+		assert.Equal(t, "120EUR", flight.Fare)
+		assert.Equal(t, "a320", *flight.AircraftID)
+		assert.Equal(t, 8, flight.Capacity)
+		assert.Equal(t, time.Monday, flight.DepartureTime.Weekday())
+	}
+	_, err = s.Update(ctx, "none", update)
+	assert.NotNil(t, err)
+
+	// update leaves the booked flights as they are
+	booked := repo.flights[0].ID
+	repo.booked = map[string]bool{booked: true}
+	update.Fare = "130EUR"
+	_, err = s.Update(ctx, id, update)
+	assert.Nil(t, err)
+	for _, flight := range repo.flights {
+		if flight.ID == booked {
+			assert.Equal(t, "120EUR", flight.Fare)
+		} else {
+			assert.Equal(t, "130EUR", flight.Fare)
+		}
+	}
+
+	// update leaves the flights edited by hand as they are
+	edited := repo.flights[1].ID
+	editedAt := time.Now()
+	repo.flights[1].EditedAt = &editedAt
+	update.Fare = "140EUR"
+	update.DaysOfWeek = "5"
+	_, err = s.Update(ctx, id, update)
+	assert.Nil(t, err)
+	for _, flight := range repo.flights {
+		switch flight.ID {
+		case booked:
+			assert.Equal(t, "120EUR", flight.Fare)
+		case edited:
+			assert.Equal(t, "130EUR", flight.Fare)
+			assert.Equal(t, time.Monday, flight.DepartureTime.Weekday())
+		default:
+			assert.Equal(t, "140EUR", flight.Fare)
+		}
+	}
+	update.Fare = "130EUR"
+	update.DaysOfWeek = "1"
+	for i := range repo.flights {
+		repo.flights[i].EditedAt = nil
+	}
+	_, err = s.Update(ctx, id, update)
+	assert.Nil(t, err)
+
+	// get
+	_, err = s.Get(ctx, "none")
+	assert.NotNil(t, err)
+	schedule, err = s.Get(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, "130EUR", schedule.Fare)
+	assert.Equal(t, "1", schedule.DaysOfWeek)
+	assert.Equal(t, "a320", *schedule.AircraftID)
+
+	// query
+	schedules, _ := s.Query(ctx, 0, 0)
+	assert.Equal(t, 1, len(schedules))
+
+	// delete removes the future flights but the booked ones
+	_, err = s.Delete(ctx, "none")
+	assert.NotNil(t, err)
+	repo.locked = nil
+	schedule, err = s.Delete(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, id, schedule.ID)
+	assert.Equal(t, []string{id}, repo.locked)
+	count, _ = s.Count(ctx)
+	assert.Equal(t, 0, count)
+	if assert.Equal(t, 1, len(repo.flights)) {
+		assert.Equal(t, booked, repo.flights[0].ID)
+		assert.Nil(t, repo.flights[0].ScheduleID)
+	}
+}
+
+func Test_service_Generate(t *testing.T) {
+	logger, entries := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, mockTransactional, airport.MockService{}, aircraft.MockService{}, 15, logger)
+	ctx := context.Background()
+
+	schedule, err := s.Create(ctx, mockRequest())
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(repo.flights))
+
+	// a schedule failing to synchronize doesn't stop the other ones
+	broken := schedule.Schedule
+	broken.ID = "broken"
+	broken.Departure = "XXX"
+	repo.items = append([]entity.Schedule{broken}, repo.items...)
+	schedule.Fare = "120EUR"
+	schedule.FareAmount = 12000
+	repo.items[1] = schedule.Schedule
+
+	// the flights whose seats got held meanwhile are left unchanged
+	taken := repo.flights[0].ID
+	repo.taken = map[string]bool{taken: true}
+	changed, err := s.Generate(ctx)
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, changed)
+	for _, flight := range repo.flights {
+		if flight.ID == taken {
+			assert.Equal(t, "100EUR", flight.Fare)
+		} else {
+			assert.Equal(t, "120EUR", flight.Fare)
+		}
+	}
+	assert.Equal(t, 1, entries.FilterMessageSnippet("failed to synchronize the flights of schedule broken").Len())
+}
+
+func mockRequest() CreateScheduleRequest {
+	today := time.Now().UTC()
+	return CreateScheduleRequest{
+		Name:               "test",
+		Number:             "T1",
+		Departure:          "MSQ",
+		Destination:        "ARN",
+		DaysOfWeek:         "15",
+		LocalDepartureTime: "12:00",
+		DurationMinutes:    120,
+		ValidFrom:          today.AddDate(0, 0, 1).Format(dateLayout),
+		ValidTo:            today.AddDate(1, 0, 0).Format(dateLayout),
+		Fare:               "100EUR",
+	}
+}
+
+func mockTransactional(ctx context.Context, f func(ctx context.Context) error) error {
+	return f(ctx)
+}
+
+type mockRepository struct {
+	items   []entity.Schedule
+	flights []entity.Flight
+	booked  map[string]bool
+	taken   map[string]bool // flights whose seats are held or booked after the booked flights were read
+	locked  []string        // IDs of the schedules locked
+}
+
+func (m mockRepository) Get(ctx context.Context, id string) (entity.Schedule, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.Schedule{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Lock(ctx context.Context, id string) (entity.Schedule, error) {
+	m.locked = append(m.locked, id)
+	return m.Get(ctx, id)
+}
+
+func (m mockRepository) Count(ctx context.Context) (int, error) {
+	return len(m.items), nil
+}
+
+func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.Schedule, error) {
+	if offset >= len(m.items) {
+		return nil, nil
+	}
+	return m.items[offset:], nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, schedule entity.Schedule) error {
+	if schedule.Name == "error" {
+		return errCRUD
+	}
+	m.items = append(m.items, schedule)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, schedule entity.Schedule) error {
+	if schedule.Name == "error" {
+		return errCRUD
+	}
+	for i, item := range m.items {
+		if item.ID == schedule.ID {
+			m.items[i] = schedule
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string, after time.Time) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items[i] = m.items[len(m.items)-1]
+			m.items = m.items[:len(m.items)-1]
+			break
+		}
+	}
+	var flights []entity.Flight
+	for _, flight := range m.flights {
+		if flight.ScheduleID == nil || *flight.ScheduleID != id {
+			flights = append(flights, flight)
+		} else if !flight.DepartureTime.After(after) || m.booked[flight.ID] {
+			flight.ScheduleID = nil
+			flights = append(flights, flight)
+		}
+	}
+	m.flights = flights
+	return nil
+}
+
+func (m mockRepository) Instances(ctx context.Context, scheduleID string, after time.Time) ([]entity.Flight, error) {
+	var flights []entity.Flight
+	for _, flight := range m.flights {
+		if flight.ScheduleID != nil && *flight.ScheduleID == scheduleID && flight.DepartureTime.After(after) {
+			flights = append(flights, flight)
+		}
+	}
+	return flights, nil
+}
+
+func (m mockRepository) BookedInstances(ctx context.Context, scheduleID string, after time.Time) ([]string, error) {
+	flights, _ := m.Instances(ctx, scheduleID, after)
+	var ids []string
+	for _, flight := range flights {
+		if m.booked[flight.ID] {
+			ids = append(ids, flight.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *mockRepository) CreateInstance(ctx context.Context, flight entity.Flight) error {
+	m.flights = append(m.flights, flight)
+	return nil
+}
+
+func (m *mockRepository) UpdateInstance(ctx context.Context, flight entity.Flight) error {
+	if m.taken[flight.ID] {
+		return aircraft.ErrSeatsTaken
+	}
+	for i, item := range m.flights {
+		if item.ID == flight.ID {
+			m.flights[i] = flight
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) DeleteInstance(ctx context.Context, id string) error {
+	if m.taken[id] {
+		return aircraft.ErrSeatsTaken
+	}
+	for i, item := range m.flights {
+		if item.ID == id {
+			m.flights = append(m.flights[:i], m.flights[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
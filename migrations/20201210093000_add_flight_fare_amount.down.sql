@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS flight_fare_idx;
+ALTER TABLE flight
+    DROP CONSTRAINT IF EXISTS flight_fare_currency,
+    DROP CONSTRAINT IF EXISTS flight_fare_format,
+    DROP COLUMN fare_amount,
+    DROP COLUMN fare_currency;
+DROP FUNCTION IF EXISTS fare_pattern(VARCHAR);
+DROP FUNCTION IF EXISTS currency_digits(VARCHAR);
@@ -0,0 +1,65 @@
+-- the number of minor unit digits of the supported ISO 4217 currencies, which must match entity.currencies;
+-- entity.TestCurrencyDigits fails when the latest definition of this function and the Go table differ
+CREATE FUNCTION currency_digits(code VARCHAR) RETURNS INTEGER
+    IMMUTABLE
+    LANGUAGE SQL AS
+$$
+SELECT CASE
+           WHEN code IN ('CLP', 'ISK', 'JPY', 'KRW') THEN 0
+           WHEN code IN ('BHD', 'JOD', 'KWD', 'OMR', 'TND') THEN 3
+           WHEN code IN ('AED', 'AUD', 'BGN', 'BRL', 'BYN', 'CAD', 'CHF', 'CNY', 'CZK', 'DKK', 'EGP', 'EUR',
+                         'GBP', 'GEL', 'HKD', 'HUF', 'IDR', 'ILS', 'INR', 'KZT', 'MXN', 'MYR', 'NOK', 'NZD',
+                         'PHP', 'PLN', 'QAR', 'RON', 'RSD', 'RUB', 'SAR', 'SEK', 'SGD', 'THB', 'TRY', 'TWD',
+                         'UAH', 'USD', 'ZAR') THEN 2
+           END
+$$;
+
+-- the pattern of a fare in the compact form written by entity.Money, e.g. '100EUR', '99.90EUR' or '1500JPY'
+CREATE FUNCTION fare_pattern(code VARCHAR) RETURNS VARCHAR
+    IMMUTABLE
+    LANGUAGE SQL AS
+$$
+SELECT '^\d+' || CASE WHEN currency_digits(code) > 0 THEN '(\.\d{' || currency_digits(code) || '})?' ELSE '' END ||
+       code || '$'
+$$;
+
+ALTER TABLE flight
+    ADD COLUMN fare_amount   BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN fare_currency VARCHAR(3) NOT NULL DEFAULT '';
+
+-- parse the existing free-form fares such as '100EUR', '200 EUR' or 'EUR 99.90' the way entity.ParseMoney does:
+-- a supported currency either before or after the amount, with no more decimals than the currency has
+WITH parsed AS (
+    SELECT id,
+           upper(coalesce(substring(fare FROM '([A-Za-z]{3})\s*$'), substring(fare FROM '^\s*([A-Za-z]{3})'))) AS currency,
+           substring(fare FROM '(\d+)')                                                                  AS units,
+           coalesce(substring(fare FROM '\d+[.,](\d+)'), '')                                             AS fraction
+    FROM flight
+    WHERE fare ~ '^\s*([A-Za-z]{3})?\s*\d+([.,]\d+)?\s*([A-Za-z]{3})?\s*$'
+      AND (fare ~ '^\s*[A-Za-z]{3}') <> (fare ~ '[A-Za-z]{3}\s*$')
+)
+UPDATE flight
+SET fare_currency = parsed.currency,
+    fare_amount   = (parsed.units || rpad(parsed.fraction, currency_digits(parsed.currency), '0'))::BIGINT
+FROM parsed
+WHERE flight.id = parsed.id
+  AND currency_digits(parsed.currency) >= length(parsed.fraction);
+
+-- rewrite the parsed fares in the compact form
+UPDATE flight
+SET fare = CASE
+               WHEN fare_amount % (10 ^ currency_digits(fare_currency))::BIGINT = 0
+                   THEN (fare_amount / (10 ^ currency_digits(fare_currency))::BIGINT)::TEXT
+               ELSE (fare_amount / (10 ^ currency_digits(fare_currency))::BIGINT)::TEXT || '.' ||
+                    lpad((fare_amount % (10 ^ currency_digits(fare_currency))::BIGINT)::TEXT,
+                         currency_digits(fare_currency), '0')
+               END || fare_currency
+WHERE currency_digits(fare_currency) IS NOT NULL;
+
+-- the same rules as entity.ParseMoney, so that every fare written can be read back;
+-- NOT VALID keeps the legacy rows whose fares couldn't be parsed readable until they are fixed
+ALTER TABLE flight
+    ADD CONSTRAINT flight_fare_currency CHECK (currency_digits(fare_currency) IS NOT NULL) NOT VALID,
+    ADD CONSTRAINT flight_fare_format CHECK (fare ~ fare_pattern(fare_currency)) NOT VALID;
+
+CREATE INDEX flight_fare_idx ON flight (fare_currency, fare_amount);
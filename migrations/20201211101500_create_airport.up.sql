@@ -0,0 +1,14 @@
+CREATE TABLE airport
+(
+    code      VARCHAR(3) PRIMARY KEY,
+    icao      VARCHAR(4) NOT NULL,
+    name      VARCHAR NOT NULL,
+    city      VARCHAR NOT NULL,
+    country   VARCHAR NOT NULL,
+    latitude  DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    timezone  VARCHAR NOT NULL
+);
+
+CREATE UNIQUE INDEX airport_icao_idx ON airport (icao);
+CREATE INDEX airport_city_idx ON airport (lower(city) varchar_pattern_ops);
@@ -0,0 +1,5 @@
+ALTER TABLE flight
+    ALTER COLUMN departure_time TYPE TIMESTAMP USING departure_time AT TIME ZONE 'UTC',
+    ALTER COLUMN arrival_time TYPE TIMESTAMP USING arrival_time AT TIME ZONE 'UTC',
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at AT TIME ZONE 'UTC';
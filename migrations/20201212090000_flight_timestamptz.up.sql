@@ -0,0 +1,6 @@
+-- the existing timestamps were written without a zone and hold UTC wall clock times
+ALTER TABLE flight
+    ALTER COLUMN departure_time TYPE TIMESTAMPTZ USING departure_time AT TIME ZONE 'UTC',
+    ALTER COLUMN arrival_time TYPE TIMESTAMPTZ USING arrival_time AT TIME ZONE 'UTC',
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE 'UTC';
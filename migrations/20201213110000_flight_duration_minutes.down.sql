@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS flight_duration_minutes_idx;
+
+ALTER TABLE flight ADD COLUMN duration VARCHAR;
+
+UPDATE flight SET duration = (duration_minutes / 60) || 'h' || (duration_minutes % 60) || 'm';
+
+ALTER TABLE flight
+    ALTER COLUMN duration SET NOT NULL,
+    DROP COLUMN duration_minutes;
@@ -0,0 +1,9 @@
+ALTER TABLE flight ADD COLUMN duration_minutes INTEGER;
+
+UPDATE flight SET duration_minutes = round(extract(EPOCH FROM arrival_time - departure_time) / 60);
+
+ALTER TABLE flight
+    ALTER COLUMN duration_minutes SET NOT NULL,
+    DROP COLUMN duration;
+
+CREATE INDEX flight_duration_minutes_idx ON flight (duration_minutes);
@@ -0,0 +1,5 @@
+ALTER TABLE flight
+    DROP CONSTRAINT flight_arrival_after_departure,
+    DROP CONSTRAINT flight_max_duration,
+    DROP CONSTRAINT flight_distinct_airports,
+    DROP CONSTRAINT flight_non_negative_fare;
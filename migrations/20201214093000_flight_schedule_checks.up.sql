@@ -0,0 +1,6 @@
+-- NOT VALID keeps legacy rows readable while enforcing the rules for all new and updated rows
+ALTER TABLE flight
+    ADD CONSTRAINT flight_arrival_after_departure CHECK (arrival_time > departure_time) NOT VALID,
+    ADD CONSTRAINT flight_max_duration CHECK (arrival_time <= departure_time + INTERVAL '24 hours') NOT VALID,
+    ADD CONSTRAINT flight_distinct_airports CHECK (departure <> destination) NOT VALID,
+    ADD CONSTRAINT flight_non_negative_fare CHECK (fare_amount >= 0) NOT VALID;
@@ -0,0 +1 @@
+ALTER TABLE flight ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS airport_search_text_trgm_idx;
+DROP INDEX IF EXISTS flight_search_text_trgm_idx;
+DROP INDEX IF EXISTS flight_search_vector_idx;
+
+ALTER TABLE flight
+    DROP COLUMN IF EXISTS search_vector,
+    DROP COLUMN IF EXISTS search_text;
+
+DROP FUNCTION IF EXISTS f_unaccent(TEXT);
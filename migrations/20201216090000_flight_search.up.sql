@@ -0,0 +1,19 @@
+CREATE EXTENSION IF NOT EXISTS unaccent;
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- unaccent() is only STABLE, so it is wrapped to be usable in generated columns and indexes.
+CREATE OR REPLACE FUNCTION f_unaccent(TEXT) RETURNS TEXT AS
+$$ SELECT public.unaccent('public.unaccent'::regdictionary, $1) $$
+LANGUAGE SQL IMMUTABLE PARALLEL SAFE STRICT;
+
+ALTER TABLE flight
+    ADD COLUMN search_text TEXT GENERATED ALWAYS AS (
+        lower(f_unaccent(name || ' ' || number || ' ' || departure || ' ' || destination))
+    ) STORED,
+    ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+        to_tsvector('simple', lower(f_unaccent(name || ' ' || number || ' ' || departure || ' ' || destination)))
+    ) STORED;
+
+CREATE INDEX flight_search_vector_idx ON flight USING GIN (search_vector);
+CREATE INDEX flight_search_text_trgm_idx ON flight USING GIN (search_text gin_trgm_ops);
+CREATE INDEX airport_search_text_trgm_idx ON airport USING GIN (lower(f_unaccent(city || ' ' || name)) gin_trgm_ops);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS flight_schedule_idx;
+
+ALTER TABLE flight DROP COLUMN IF EXISTS edited_at;
+
+ALTER TABLE flight DROP COLUMN IF EXISTS schedule_id;
+
+DROP TABLE IF EXISTS schedule;
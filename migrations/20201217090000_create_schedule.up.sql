@@ -0,0 +1,28 @@
+CREATE TABLE schedule
+(
+    id                   VARCHAR PRIMARY KEY,
+    name                 VARCHAR NOT NULL,
+    number               VARCHAR NOT NULL,
+    departure            VARCHAR(3) NOT NULL,
+    destination          VARCHAR(3) NOT NULL,
+    days_of_week         VARCHAR(7) NOT NULL,
+    local_departure_time VARCHAR(5) NOT NULL,
+    duration_minutes     INTEGER NOT NULL,
+    valid_from           DATE NOT NULL,
+    valid_to             DATE NOT NULL,
+    fare                 VARCHAR NOT NULL,
+    fare_amount          BIGINT NOT NULL,
+    fare_currency        VARCHAR(3) NOT NULL,
+    created_at           TIMESTAMPTZ NOT NULL,
+    updated_at           TIMESTAMPTZ NOT NULL,
+    CONSTRAINT schedule_route_check CHECK (departure <> destination),
+    CONSTRAINT schedule_validity_check CHECK (valid_from <= valid_to),
+    CONSTRAINT schedule_duration_check CHECK (duration_minutes BETWEEN 1 AND 1440)
+);
+
+ALTER TABLE flight ADD COLUMN schedule_id VARCHAR;
+
+-- set when a flight is edited by hand, the schedule no longer changes it afterwards
+ALTER TABLE flight ADD COLUMN edited_at TIMESTAMPTZ;
+
+CREATE INDEX flight_schedule_idx ON flight (schedule_id, departure_time);
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS flight_status_change;
+
+DROP INDEX IF EXISTS flight_status_idx;
+
+ALTER TABLE flight
+    DROP CONSTRAINT IF EXISTS flight_status_check,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS status_reason,
+    DROP COLUMN IF EXISTS estimated_departure_time,
+    DROP COLUMN IF EXISTS estimated_arrival_time,
+    DROP COLUMN IF EXISTS actual_departure_time,
+    DROP COLUMN IF EXISTS actual_arrival_time;
@@ -0,0 +1,27 @@
+ALTER TABLE flight
+    ADD COLUMN status                   VARCHAR NOT NULL DEFAULT 'scheduled',
+    ADD COLUMN status_reason            VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN estimated_departure_time TIMESTAMPTZ,
+    ADD COLUMN estimated_arrival_time   TIMESTAMPTZ,
+    ADD COLUMN actual_departure_time    TIMESTAMPTZ,
+    ADD COLUMN actual_arrival_time      TIMESTAMPTZ,
+    ADD CONSTRAINT flight_status_check
+        CHECK (status IN ('scheduled', 'delayed', 'boarding', 'departed', 'arrived', 'cancelled'));
+
+CREATE INDEX flight_status_idx ON flight (status);
+
+CREATE TABLE flight_status_change
+(
+    id                       VARCHAR PRIMARY KEY,
+    flight_id                VARCHAR NOT NULL REFERENCES flight (id) ON DELETE CASCADE,
+    previous_status          VARCHAR NOT NULL,
+    status                   VARCHAR NOT NULL,
+    reason                   VARCHAR NOT NULL,
+    estimated_departure_time TIMESTAMPTZ,
+    estimated_arrival_time   TIMESTAMPTZ,
+    actual_departure_time    TIMESTAMPTZ,
+    actual_arrival_time      TIMESTAMPTZ,
+    created_at               TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX flight_status_change_flight_idx ON flight_status_change (flight_id, created_at);
@@ -0,0 +1,5 @@
+ALTER TABLE schedule DROP COLUMN IF EXISTS aircraft_id;
+ALTER TABLE flight DROP COLUMN IF EXISTS aircraft_id;
+
+DROP TABLE IF EXISTS seat;
+DROP TABLE IF EXISTS aircraft;
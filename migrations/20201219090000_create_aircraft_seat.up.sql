@@ -0,0 +1,27 @@
+CREATE TABLE aircraft
+(
+    id         VARCHAR PRIMARY KEY,
+    name       VARCHAR NOT NULL,
+    cabins     JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE seat
+(
+    flight_id VARCHAR NOT NULL,
+    number    VARCHAR NOT NULL,
+    cabin     VARCHAR NOT NULL,
+    "row"     INTEGER NOT NULL,
+    letter    VARCHAR(1) NOT NULL,
+    status    VARCHAR NOT NULL DEFAULT 'available',
+    PRIMARY KEY (flight_id, number)
+);
+
+CREATE INDEX seat_available_idx ON seat (flight_id) WHERE status = 'available';
+
+ALTER TABLE flight ADD COLUMN aircraft_id VARCHAR REFERENCES aircraft (id);
+ALTER TABLE schedule ADD COLUMN aircraft_id VARCHAR REFERENCES aircraft (id);
+
+CREATE INDEX flight_aircraft_idx ON flight (aircraft_id);
+CREATE INDEX schedule_aircraft_idx ON schedule (aircraft_id);
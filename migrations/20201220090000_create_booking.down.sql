@@ -0,0 +1,3 @@
+ALTER TABLE seat DROP CONSTRAINT IF EXISTS seat_status_check;
+ALTER TABLE seat DROP COLUMN IF EXISTS booking_id;
+DROP TABLE IF EXISTS booking;
@@ -0,0 +1,18 @@
+CREATE TABLE booking
+(
+    id         VARCHAR PRIMARY KEY,
+    user_id    VARCHAR NOT NULL,
+    flight_id  VARCHAR NOT NULL,
+    seats      JSONB NOT NULL,
+    status     VARCHAR NOT NULL,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT booking_status_check CHECK (status IN ('held', 'confirmed', 'cancelled', 'expired'))
+);
+
+CREATE INDEX booking_user_idx ON booking (user_id);
+CREATE INDEX booking_held_idx ON booking (expires_at) WHERE status = 'held';
+
+ALTER TABLE seat ADD COLUMN booking_id VARCHAR;
+ALTER TABLE seat ADD CONSTRAINT seat_status_check CHECK (status IN ('available', 'held', 'booked'));
@@ -0,0 +1,16 @@
+CREATE TABLE passenger
+(
+    id              VARCHAR PRIMARY KEY,
+    flight_id       VARCHAR NOT NULL REFERENCES flight (id),
+    first_name      VARCHAR NOT NULL,
+    last_name       VARCHAR NOT NULL,
+    date_of_birth   DATE NOT NULL,
+    document_type   VARCHAR NOT NULL,
+    document_number VARCHAR NOT NULL,
+    nationality     VARCHAR(2) NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL,
+    updated_at      TIMESTAMPTZ NOT NULL,
+    CONSTRAINT passenger_document_type_check CHECK (document_type IN ('passport', 'id_card'))
+);
+
+CREATE UNIQUE INDEX passenger_document_idx ON passenger (flight_id, document_type, document_number);
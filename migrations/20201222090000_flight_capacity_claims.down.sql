@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS seat_claim;
+
+ALTER TABLE flight DROP CONSTRAINT IF EXISTS flight_capacity_check;
+ALTER TABLE flight DROP COLUMN IF EXISTS taken_seats;
+ALTER TABLE flight DROP COLUMN IF EXISTS claimed_seats;
+ALTER TABLE flight DROP COLUMN IF EXISTS overbooking_percent;
+ALTER TABLE flight DROP COLUMN IF EXISTS capacity;
@@ -0,0 +1,23 @@
+ALTER TABLE flight ADD COLUMN capacity INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE flight ADD COLUMN overbooking_percent INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE flight ADD COLUMN claimed_seats INTEGER NOT NULL DEFAULT 0;
+-- the number of held or booked seats, so that the seat claims and the bookings share the capacity
+ALTER TABLE flight ADD COLUMN taken_seats INTEGER NOT NULL DEFAULT 0;
+UPDATE flight SET taken_seats = (SELECT COUNT(*) FROM seat WHERE seat.flight_id = flight.id AND seat.status <> 'available');
+ALTER TABLE flight ADD CONSTRAINT flight_capacity_check
+    CHECK (capacity >= 0 AND overbooking_percent >= 0 AND claimed_seats >= 0 AND taken_seats >= 0);
+
+CREATE TABLE seat_claim
+(
+    id         VARCHAR PRIMARY KEY,
+    flight_id  VARCHAR NOT NULL REFERENCES flight (id) ON DELETE CASCADE,
+    user_id    VARCHAR NOT NULL,
+    seats      INTEGER NOT NULL,
+    status     VARCHAR NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT seat_claim_status_check CHECK (status IN ('claimed', 'waitlisted', 'released'))
+);
+
+CREATE INDEX seat_claim_flight_idx ON seat_claim (flight_id, user_id);
+CREATE INDEX seat_claim_waitlist_idx ON seat_claim (flight_id, created_at) WHERE status = 'waitlisted';
@@ -0,0 +1,14 @@
+CREATE TABLE refresh_token
+(
+    id         VARCHAR PRIMARY KEY,
+    family_id  VARCHAR NOT NULL,
+    user_id    VARCHAR NOT NULL,
+    token_hash VARCHAR NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX refresh_token_family_idx ON refresh_token (family_id);
+CREATE INDEX refresh_token_user_idx ON refresh_token (user_id);
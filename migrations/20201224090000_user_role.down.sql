@@ -0,0 +1,2 @@
+ALTER TABLE "user" DROP CONSTRAINT IF EXISTS user_role_check;
+ALTER TABLE "user" DROP COLUMN IF EXISTS role;
@@ -0,0 +1,2 @@
+ALTER TABLE "user" ADD COLUMN role VARCHAR NOT NULL DEFAULT 'customer';
+ALTER TABLE "user" ADD CONSTRAINT user_role_check CHECK (role IN ('admin', 'operator', 'customer'));
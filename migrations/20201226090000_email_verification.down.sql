@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS email_verification;
+ALTER TABLE "user" DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,16 @@
+ALTER TABLE "user" ADD COLUMN email_verified_at TIMESTAMPTZ;
+-- the users registered before the verification was introduced are not locked out
+UPDATE "user" SET email_verified_at = NOW();
+
+CREATE TABLE email_verification
+(
+    id         VARCHAR PRIMARY KEY,
+    user_id    VARCHAR NOT NULL,
+    email      VARCHAR NOT NULL,
+    token_hash VARCHAR NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX email_verification_user_idx ON email_verification (user_id);
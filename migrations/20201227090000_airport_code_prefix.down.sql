@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS airport_icao_prefix_idx;
+DROP INDEX IF EXISTS airport_code_prefix_idx;
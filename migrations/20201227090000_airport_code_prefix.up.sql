@@ -0,0 +1,3 @@
+-- the prefix searches of the airport codes, like the one of the city by airport_city_idx
+CREATE INDEX airport_code_prefix_idx ON airport (code varchar_pattern_ops);
+CREATE INDEX airport_icao_prefix_idx ON airport (icao varchar_pattern_ops);
@@ -0,0 +1 @@
+ALTER TABLE flight DROP CONSTRAINT IF EXISTS flight_claim_limit_check;
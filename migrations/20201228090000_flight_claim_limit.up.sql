@@ -0,0 +1,4 @@
+-- the claimed and taken seats can't exceed the capacity plus the overbooking allowance, see entity.Flight.ClaimLimit;
+-- not validated for the existing flights whose taken seats were counted before they had a capacity
+ALTER TABLE flight ADD CONSTRAINT flight_claim_limit_check
+    CHECK (claimed_seats + taken_seats <= capacity + capacity * overbooking_percent / 100) NOT VALID;
@@ -45,7 +45,12 @@ func (db *DB) With(ctx context.Context) dbx.Builder {
 
 // Transactional starts a transaction and calls the given function with a context storing the transaction.
 // The transaction associated with the context can be accesse via With().
+// If the given context stores a transaction already, the function joins it instead of starting a new one,
+// so that the callers can make several transactional calls atomic.
 func (db *DB) Transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey).(*dbx.Tx); ok {
+		return f(ctx)
+	}
 	return db.db.TransactionalContext(ctx, nil, func(tx *dbx.Tx) error {
 		return f(context.WithValue(ctx, txKey, tx))
 	})
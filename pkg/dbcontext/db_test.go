@@ -60,6 +60,18 @@ func TestDB_Transactional(t *testing.T) {
 		})
 		assert.Equal(t, sql.ErrNoRows, err)
 		assert.Equal(t, 4, runCountQuery(t, db))
+
+		// nested transaction joining the failed outer one
+		err = dbc.Transactional(context.Background(), func(ctx context.Context) error {
+			err := dbc.Transactional(ctx, func(ctx context.Context) error {
+				_, err := dbc.With(ctx).Insert("dbcontexttest", dbx.Params{"id": "5", "name": "name1"}).Execute()
+				return err
+			})
+			assert.Nil(t, err)
+			return sql.ErrNoRows
+		})
+		assert.Equal(t, sql.ErrNoRows, err)
+		assert.Equal(t, 4, runCountQuery(t, db))
 	})
 }
 
@@ -0,0 +1,65 @@
+// Package mail provides the sending of email messages.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+)
+
+// Message represents a plain text email message.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// String returns the message in the Internet Message Format (RFC 5322) without the sender.
+func (m Message) String() string {
+	return fmt.Sprintf("To: %v\r\nSubject: %v\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%v",
+		m.To, m.Subject, strings.Replace(m.Body, "\n", "\r\n", -1))
+}
+
+// Mailer sends email messages.
+type Mailer interface {
+	// Send sends the message.
+	Send(ctx context.Context, msg Message) error
+}
+
+type localMailer struct {
+	dir       string
+	logBodies bool
+	logger    log.Logger
+}
+
+// NewLocalMailer creates a mailer for local development that doesn't send the messages anywhere.
+// If dir is not empty, each message is written to a new .eml file in the directory, and logged otherwise.
+// The logged messages contain their bodies, which may carry tokens, only if logBodies is true.
+func NewLocalMailer(dir string, logBodies bool, logger log.Logger) Mailer {
+	return localMailer{dir, logBodies, logger}
+}
+
+// Send writes the message to a file or to the log.
+func (m localMailer) Send(ctx context.Context, msg Message) error {
+	logger := m.logger.With(ctx, "to", msg.To)
+	if m.dir == "" {
+		if m.logBodies {
+			logger.Infof("mail %q:\n%v", msg.Subject, msg.Body)
+		} else {
+			logger.Infof("mail %q", msg.Subject)
+		}
+		return nil
+	}
+	file := filepath.Join(m.dir, fmt.Sprintf("%v-%v.eml", time.Now().UTC().Format("20060102T150405"), uuid.New().String()))
+	if err := ioutil.WriteFile(file, []byte(msg.String()), 0600); err != nil {
+		return err
+	}
+	logger.Infof("mail %q written to %v", msg.Subject, file)
+	return nil
+}
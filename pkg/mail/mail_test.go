@@ -0,0 +1,49 @@
+package mail
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nvnoskov/dynamo-backend/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage_String(t *testing.T) {
+	msg := Message{To: "demo@demo.com", Subject: "Hello", Body: "line 1\nline 2"}
+	assert.Equal(t, "To: demo@demo.com\r\nSubject: Hello\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nline 1\r\nline 2", msg.String())
+}
+
+func TestLocalMailer(t *testing.T) {
+	logger, entries := log.NewForTest()
+	msg := Message{To: "demo@demo.com", Subject: "Hello", Body: "the token"}
+
+	// without a directory the message is logged without its body
+	assert.Nil(t, NewLocalMailer("", false, logger).Send(context.Background(), msg))
+	if assert.Equal(t, 1, entries.Len()) {
+		assert.Equal(t, `mail "Hello"`, entries.All()[0].Message)
+		assert.Equal(t, "demo@demo.com", entries.All()[0].ContextMap()["to"])
+	}
+	entries.TakeAll()
+
+	// unless the bodies are logged as well
+	assert.Nil(t, NewLocalMailer("", true, logger).Send(context.Background(), msg))
+	if assert.Equal(t, 1, entries.Len()) {
+		assert.Contains(t, entries.All()[0].Message, "the token")
+	}
+
+	// with a directory the message is written to a file
+	dir, _ := ioutil.TempDir("", "mail")
+	defer os.RemoveAll(dir)
+	assert.Nil(t, NewLocalMailer(dir, false, logger).Send(context.Background(), msg))
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if assert.Equal(t, 1, len(files)) {
+		data, _ := ioutil.ReadFile(files[0])
+		assert.Equal(t, msg.String(), string(data))
+	}
+
+	// a missing directory is an error
+	assert.NotNil(t, NewLocalMailer(filepath.Join(dir, "none"), false, logger).Send(context.Background(), msg))
+}
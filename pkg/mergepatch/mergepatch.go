@@ -0,0 +1,56 @@
+// Package mergepatch implements JSON Merge Patch as defined in RFC 7396.
+package mergepatch
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// ContentType is the media type of JSON merge patch documents.
+const ContentType = "application/merge-patch+json"
+
+// Apply applies the merge patch to the JSON document and returns the patched document.
+// Members of the patch set to null are removed from the document, objects are merged recursively
+// and any other value replaces the corresponding value in the document.
+func Apply(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decode(patch)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(merge(target, p))
+}
+
+// decode decodes the JSON data keeping the numbers intact.
+func decode(data []byte) (interface{}, error) {
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// merge implements the MergePatch function described in RFC 7396.
+func merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+		} else {
+			t[name] = merge(t[name], value)
+		}
+	}
+	return t
+}
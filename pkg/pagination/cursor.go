@@ -0,0 +1,49 @@
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCursor is returned when a cursor is malformed or its signature does not match.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor returns an opaque cursor holding the given values, typically the sort key of the last
+// item of a page. The cursor is signed with the key so that clients cannot forge it.
+func EncodeCursor(key []byte, values ...string) string {
+	payload, _ := json.Marshal(values)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(key, encoded))
+}
+
+// DecodeCursor verifies the signature of the cursor created by EncodeCursor and returns the values it holds.
+func DecodeCursor(key []byte, cursor string) ([]string, error) {
+	parts := strings.Split(cursor, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, sign(key, parts[0])) {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var values []string
+	if err := json.Unmarshal(payload, &values); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return values, nil
+}
+
+// sign returns the HMAC-SHA256 signature of the encoded cursor payload.
+func sign(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
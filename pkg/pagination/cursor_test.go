@@ -0,0 +1,24 @@
+package pagination
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor(t *testing.T) {
+	key := []byte("secret")
+	cursor := EncodeCursor(key, "departure_time", "2020-10-01T14:36:38Z", "123")
+	values, err := DecodeCursor(key, cursor)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"departure_time", "2020-10-01T14:36:38Z", "123"}, values)
+
+	_, err = DecodeCursor([]byte("other"), cursor)
+	assert.Equal(t, ErrInvalidCursor, err)
+	_, err = DecodeCursor(key, EncodeCursor(key, "a")[1:])
+	assert.Equal(t, ErrInvalidCursor, err)
+	_, err = DecodeCursor(key, "abc")
+	assert.Equal(t, ErrInvalidCursor, err)
+	_, err = DecodeCursor(key, "")
+	assert.Equal(t, ErrInvalidCursor, err)
+}
@@ -4,6 +4,7 @@ package pagination
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 )
@@ -17,6 +18,10 @@ var (
 	PageVar = "page"
 	// PageSizeVar specifies the query parameter name for page size
 	PageSizeVar = "per_page"
+	// SortVar specifies the query parameter name for sort order
+	SortVar = "sort"
+	// CursorVar specifies the query parameter name for the cursor of the cursor-based pagination
+	CursorVar = "cursor"
 )
 
 // Pages represents a paginated list of data items.
@@ -25,6 +30,9 @@ type Pages struct {
 	PerPage    int         `json:"per_page"`
 	PageCount  int         `json:"page_count"`
 	TotalCount int         `json:"total_count"`
+	Sort       string      `json:"sort,omitempty"`
+	Cursor     string      `json:"cursor,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 	Items      interface{} `json:"items"`
 }
 
@@ -64,7 +72,10 @@ func New(page, perPage, total int) *Pages {
 func NewFromRequest(req *http.Request, count int) *Pages {
 	page := parseInt(req.URL.Query().Get(PageVar), 1)
 	perPage := parseInt(req.URL.Query().Get(PageSizeVar), DefaultPageSize)
-	return New(page, perPage, count)
+	p := New(page, perPage, count)
+	p.Sort = req.URL.Query().Get(SortVar)
+	p.Cursor = req.URL.Query().Get(CursorVar)
+	return p
 }
 
 // parseInt parses a string into an integer. If parsing is failed, defaultValue will be returned.
@@ -79,7 +90,11 @@ func parseInt(value string, defaultValue int) int {
 }
 
 // Offset returns the OFFSET value that can be used in a SQL statement.
+// It is zero when the pagination is cursor-based, as the cursor already marks where the page starts.
 func (p *Pages) Offset() int {
+	if p.Cursor != "" {
+		return 0
+	}
 	return (p.Page - 1) * p.PerPage
 }
 
@@ -91,27 +106,21 @@ func (p *Pages) Limit() int {
 // BuildLinkHeader returns an HTTP header containing the links about the pagination.
 func (p *Pages) BuildLinkHeader(baseURL string, defaultPerPage int) string {
 	links := p.BuildLinks(baseURL, defaultPerPage)
-	header := ""
-	if links[0] != "" {
-		header += fmt.Sprintf("<%v>; rel=\"first\", ", links[0])
-		header += fmt.Sprintf("<%v>; rel=\"prev\"", links[1])
-	}
-	if links[2] != "" {
-		if header != "" {
-			header += ", "
-		}
-		header += fmt.Sprintf("<%v>; rel=\"next\"", links[2])
-		if links[3] != "" {
-			header += fmt.Sprintf(", <%v>; rel=\"last\"", links[3])
+	var parts []string
+	for i, rel := range []string{"first", "prev", "next", "last"} {
+		if links[i] != "" {
+			parts = append(parts, fmt.Sprintf("<%v>; rel=\"%v\"", links[i], rel))
 		}
 	}
-	return header
+	return strings.Join(parts, ", ")
 }
 
 // BuildLinks returns the first, prev, next, and last links corresponding to the pagination.
+// The sort order, if any, is kept in the links.
 // A link could be an empty string if it is not needed.
 // For example, if the pagination is at the first page, then both first and prev links
 // will be empty.
+// If the pagination is cursor-based, only the first link and the next link built from NextCursor are returned.
 func (p *Pages) BuildLinks(baseURL string, defaultPerPage int) [4]string {
 	var links [4]string
 	pageCount := p.PageCount
@@ -124,15 +133,22 @@ func (p *Pages) BuildLinks(baseURL string, defaultPerPage int) [4]string {
 	} else {
 		baseURL += "?"
 	}
-	if page > 1 {
+	if p.Cursor != "" {
 		links[0] = fmt.Sprintf("%v%v=%v", baseURL, PageVar, 1)
-		links[1] = fmt.Sprintf("%v%v=%v", baseURL, PageVar, page-1)
-	}
-	if pageCount >= 0 && page < pageCount {
-		links[2] = fmt.Sprintf("%v%v=%v", baseURL, PageVar, page+1)
-		links[3] = fmt.Sprintf("%v%v=%v", baseURL, PageVar, pageCount)
-	} else if pageCount < 0 {
-		links[2] = fmt.Sprintf("%v%v=%v", baseURL, PageVar, page+1)
+		if p.NextCursor != "" {
+			links[2] = fmt.Sprintf("%v%v=%v", baseURL, CursorVar, url.QueryEscape(p.NextCursor))
+		}
+	} else {
+		if page > 1 {
+			links[0] = fmt.Sprintf("%v%v=%v", baseURL, PageVar, 1)
+			links[1] = fmt.Sprintf("%v%v=%v", baseURL, PageVar, page-1)
+		}
+		if pageCount >= 0 && page < pageCount {
+			links[2] = fmt.Sprintf("%v%v=%v", baseURL, PageVar, page+1)
+			links[3] = fmt.Sprintf("%v%v=%v", baseURL, PageVar, pageCount)
+		} else if pageCount < 0 {
+			links[2] = fmt.Sprintf("%v%v=%v", baseURL, PageVar, page+1)
+		}
 	}
 	if perPage := p.PerPage; perPage != defaultPerPage {
 		for i := 0; i < 4; i++ {
@@ -141,6 +157,13 @@ func (p *Pages) BuildLinks(baseURL string, defaultPerPage int) [4]string {
 			}
 		}
 	}
+	if p.Sort != "" {
+		for i := 0; i < 4; i++ {
+			if links[i] != "" {
+				links[i] += fmt.Sprintf("&%v=%v", SortVar, url.QueryEscape(p.Sort))
+			}
+		}
+	}
 
 	return links
 }
@@ -67,6 +67,15 @@ func TestPages_BuildLinkHeader(t *testing.T) {
 	baseURL = "/tokens?from=10"
 	p := New(1, 20, 50)
 	assert.Equal(t, "</tokens?from=10&page=2&per_page=20>; rel=\"next\", </tokens?from=10&page=3&per_page=20>; rel=\"last\"", p.BuildLinkHeader(baseURL, defaultPerPage))
+
+	p.Sort = "departure_time,-fare"
+	assert.Equal(t, "</tokens?from=10&page=2&per_page=20&sort=departure_time%2C-fare>; rel=\"next\", </tokens?from=10&page=3&per_page=20&sort=departure_time%2C-fare>; rel=\"last\"", p.BuildLinkHeader(baseURL, defaultPerPage))
+
+	p = New(1, 20, 50)
+	p.Cursor, p.NextCursor = "abc", "def+"
+	assert.Equal(t, "</tokens?from=10&page=1&per_page=20>; rel=\"first\", </tokens?from=10&cursor=def%2B&per_page=20>; rel=\"next\"", p.BuildLinkHeader(baseURL, defaultPerPage))
+	p.NextCursor = ""
+	assert.Equal(t, "</tokens?from=10&page=1&per_page=20>; rel=\"first\"", p.BuildLinkHeader(baseURL, defaultPerPage))
 }
 
 func Test_parseInt(t *testing.T) {
@@ -99,4 +108,15 @@ func TestNewFromRequest(t *testing.T) {
 	assert.Equal(t, 20, p.PerPage)
 	assert.Equal(t, 100, p.TotalCount)
 	assert.Equal(t, 5, p.PageCount)
+	assert.Equal(t, "", p.Sort)
+
+	req, _ = http.NewRequest("GET", "http://example.com?page=2&per_page=20&sort=-name", bytes.NewBufferString(""))
+	p = NewFromRequest(req, 100)
+	assert.Equal(t, "-name", p.Sort)
+	assert.Equal(t, 20, p.Offset())
+
+	req, _ = http.NewRequest("GET", "http://example.com?page=2&cursor=abc", bytes.NewBufferString(""))
+	p = NewFromRequest(req, 100)
+	assert.Equal(t, "abc", p.Cursor)
+	assert.Equal(t, 0, p.Offset())
 }
@@ -7,7 +7,9 @@ INSERT INTO flight (
     destination,
     arrival_time,
     fare,
-    duration,
+    fare_amount,
+    fare_currency,
+    duration_minutes,
     created_at,
     updated_at
 )
@@ -15,24 +17,30 @@ VALUES (
     '967d5bb5-3a7a-4d5e-8a6c-febc8c5b3f13', 
     'BOEING 737-400 ', 
     'UR-CSV', 
-    'MALMÖ, SWEDEN', 
-    '2019-10-01 15:36:38'::timestamp, 
-    'MERZIFON, TURKEY', 
-    '2019-10-01 15:36:38'::timestamp, 
+    'MMX', 
+    '2019-10-01 15:36:38+00'::timestamptz, 
+    'MZH', 
+    '2019-10-01 18:56:38+00'::timestamptz, 
     '100EUR', 
-    '3h20m', 
-    '2019-10-02 11:16:12'::timestamp, 
-    '2019-10-02 11:16:12'::timestamp
+    10000,
+    'EUR',
+    200,
+    '2019-10-02 11:16:12+00'::timestamptz, 
+    '2019-10-02 11:16:12+00'::timestamptz
 );
 
 INSERT INTO "user" (
     id,
     name,
     password,
-    email
+    email,
+    role,
+    email_verified_at
 ) VALUES (
     'd67d5bb5-3a7a-4d5e-8a6c-febc8c5b3f13', 
     'nvnoskov',
     '$2a$10$eDUmXWENcjQGnsPy87xfw.QjSkltZUr4nvIxOUWJutEdkNvmMikQS',
-    'me@noskov.dev'
+    'me@noskov.dev',
+    'admin',
+    '2020-12-03 10:24:28+00'
 )
\ No newline at end of file